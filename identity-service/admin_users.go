@@ -0,0 +1,490 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// Characters used for admin-generated codes (no 0/O or 1/I/L to misread)
+const resetCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// updateUserHandler changes a user's name, email or venue (admin only)
+func updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdminUpdateUserRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Name == "" && req.Email == "" && req.VenueID == 0 {
+		httpkit.SendError(w, "Name, email or venue_id is required", 400)
+		return
+	}
+
+	before, err := loadUser(userID)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	after := *before
+	if req.Name != "" {
+		after.Name = req.Name
+	}
+	if req.Email != "" {
+		if !strings.EqualFold(req.Email, before.Email) && !emailAvailable(w, req.Email, userID) {
+			return
+		}
+		after.Email = req.Email
+	}
+	if req.VenueID != 0 {
+		venueID, msg := resolveVenue(req.VenueID)
+		if msg != "" {
+			httpkit.SendError(w, msg, 400)
+			return
+		}
+		after.VenueID = venueID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET name = ?, email = ?, venue_id = ? WHERE id = ?
+	`, after.Name, after.Email, after.VenueID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			httpkit.SendError(w, "Email already registered", 409)
+		} else {
+			httpkit.SendError(w, "Failed to update user", 500)
+		}
+		return
+	}
+
+	if before.Email != after.Email {
+		if err := recordEmailChange(tx, userID, before.Email); err != nil {
+			httpkit.SendError(w, "Failed to update user", 500)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		httpkit.SendError(w, "Failed to update user", 500)
+		return
+	}
+
+	recordAudit(r, "user.update", "user", userID, map[string]interface{}{
+		"name":     []string{before.Name, after.Name},
+		"email":    []string{before.Email, after.Email},
+		"venue_id": []int{before.VenueID, after.VenueID},
+	})
+	publishUserEvent(auth.EventUserUpdated, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
+
+// disableUserHandler blocks a user from logging in and ends their
+// sessions (admin only)
+func disableUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromPath(w, r)
+	if !ok || !notSelf(w, r, userID) {
+		return
+	}
+
+	result, err := db.Exec(`
+		UPDATE users SET disabled_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND disabled_at IS NULL
+	`, userID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to disable user", 500)
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		httpkit.SendError(w, "User not found or already disabled", 404)
+		return
+	}
+
+	publishUserEvent(auth.EventUserDisabled, userID)
+	if err := revokeUserSessions(userID); err != nil {
+		log.Printf("Warning: Could not end sessions for user %d: %v", userID, err)
+	}
+
+	recordAudit(r, "user.disable", "user", userID, nil)
+	log.Printf("🚫 User %d disabled", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "User disabled",
+	})
+}
+
+// enableUserHandler lets a disabled user log in again (admin only)
+func enableUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Deleted and merged accounts stay disabled
+	result, err := db.Exec(`
+		UPDATE users SET disabled_at = NULL
+		WHERE id = ? AND disabled_at IS NOT NULL AND deleted_at IS NULL
+	`, userID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to enable user", 500)
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		httpkit.SendError(w, "User not found or not disabled", 404)
+		return
+	}
+
+	recordAudit(r, "user.enable", "user", userID, nil)
+	publishUserEvent(auth.EventUserEnabled, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "User enabled",
+	})
+}
+
+// deleteUserHandler anonymises a user. The row is kept so game history
+// and audit entries still point somewhere, but personal data is removed
+// and the account can't be used again (admin only).
+func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromPath(w, r)
+	if !ok || !notSelf(w, r, userID) {
+		return
+	}
+
+	user, err := loadUser(userID)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := anonymiseUser(tx, userID, 0); err != nil {
+		log.Printf("Failed to anonymise user %d: %v", userID, err)
+		httpkit.SendError(w, "Failed to delete user", 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		httpkit.SendError(w, "Failed to delete user", 500)
+		return
+	}
+	if err := revokeUserSessions(userID); err != nil {
+		log.Printf("Warning: Could not end sessions for user %d: %v", userID, err)
+	}
+
+	// The former email is kept in the audit log only
+	recordAudit(r, "user.delete", "user", userID, map[string]interface{}{
+		"email": user.Email,
+	})
+	log.Printf("🗑️  User %d deleted (anonymised)", userID)
+	publishEvent(auth.Event{Type: auth.EventUserDeleted, UserID: userID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "User deleted",
+	})
+}
+
+// resetCodeHandler sets a new random login code, ends the user's sessions
+// and clears any lockout. The code is returned once for the admin to pass
+// on (admin only).
+func resetCodeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := loadUser(userID)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	code, err := generateCode(6)
+	if err != nil {
+		httpkit.SendError(w, "Failed to generate code", 500)
+		return
+	}
+
+	hashedCode, err := bcrypt.GenerateFromPassword([]byte(code), 12)
+	if err != nil {
+		httpkit.SendError(w, "Failed to process code", 500)
+		return
+	}
+
+	if _, err := db.Exec("UPDATE users SET code = ? WHERE id = ?", string(hashedCode), userID); err != nil {
+		httpkit.SendError(w, "Failed to reset code", 500)
+		return
+	}
+
+	if err := revokeUserSessions(userID); err != nil {
+		log.Printf("Warning: Could not end sessions for user %d: %v", userID, err)
+	}
+	accountKey, _ := throttleKeys(user.Email, r)
+	clearLoginFailures(accountKey)
+
+	recordAudit(r, "user.reset_code", "user", userID, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"code":    code,
+		"message": "Code reset - give this code to the user",
+	})
+}
+
+// mergeUserHandler folds a duplicate account into the user in the path:
+// activity and roles move across, and the duplicate is anonymised with
+// merged_into pointing at the kept account (admin only)
+func mergeUserHandler(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req MergeUsersRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	if req.SourceID == 0 || req.SourceID == targetID {
+		httpkit.SendError(w, "source_id must be a different user", 400)
+		return
+	}
+	if !notSelf(w, r, req.SourceID) {
+		return
+	}
+
+	target, err := loadUser(targetID)
+	if err != nil {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+	source, err := loadUser(req.SourceID)
+	if err != nil {
+		httpkit.SendError(w, "Duplicate user not found", 404)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer tx.Rollback()
+
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE user_activity SET user_id = ? WHERE user_id = ?", []interface{}{targetID, source.ID}},
+		{`INSERT OR IGNORE INTO user_roles (user_id, role, app_id, granted_by)
+			SELECT ?, role, app_id, granted_by FROM user_roles WHERE user_id = ?`, []interface{}{targetID, source.ID}},
+		// The duplicate's email counts as one of the kept user's former
+		// addresses, so apps keyed on email still find its history
+		{`INSERT INTO user_email_history (user_id, email)
+			SELECT ?, email FROM user_email_history WHERE user_id = ?
+			UNION ALL SELECT ?, ?`, []interface{}{targetID, source.ID, targetID, source.Email}},
+		{`UPDATE users SET is_admin = EXISTS (
+			SELECT 1 FROM user_roles WHERE user_id = ? AND role = ?
+		) WHERE id = ?`, []interface{}{targetID, ROLE_ADMIN, targetID}},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			log.Printf("Failed to merge user %d into %d: %v", source.ID, targetID, err)
+			httpkit.SendError(w, "Failed to merge users", 500)
+			return
+		}
+	}
+
+	if err := anonymiseUser(tx, source.ID, targetID); err != nil {
+		log.Printf("Failed to merge user %d into %d: %v", source.ID, targetID, err)
+		httpkit.SendError(w, "Failed to merge users", 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		httpkit.SendError(w, "Failed to merge users", 500)
+		return
+	}
+	if err := revokeUserSessions(source.ID); err != nil {
+		log.Printf("Warning: Could not end sessions for user %d: %v", source.ID, err)
+	}
+
+	recordAudit(r, "user.merge", "user", targetID, map[string]interface{}{
+		"merged_user_id": source.ID,
+		"merged_email":   source.Email,
+	})
+	log.Printf("🔀 User %d merged into user %d", source.ID, targetID)
+	publishEvent(auth.Event{Type: auth.EventUserDeleted, UserID: source.ID, MergedInto: targetID})
+
+	merged, _ := loadUser(targetID)
+	if merged == nil {
+		merged = target
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"user":         merged,
+		"merged_email": source.Email,
+		"message":      "Users merged",
+	})
+}
+
+// anonymiseUser strips personal data from a user, including their former
+// emails and sign-in codes, and removes their roles and passkey. Callers
+// end the user's sessions with revokeUserSessions once the transaction is
+// committed. mergedInto is 0 for a plain delete.
+func anonymiseUser(tx *sql.Tx, userID, mergedInto int) error {
+	// Unusable code - nobody knows the plaintext
+	secret, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedCode, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+
+	var mergedIntoValue interface{}
+	if mergedInto != 0 {
+		mergedIntoValue = mergedInto
+	}
+
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE users SET
+			email = ?, name = ?, code = ?, is_admin = 0,
+			passkey_id = NULL, passkey_public_key = NULL, passkey_counter = 0,
+			passkey_transports = NULL, passkey_created_at = NULL,
+			disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP),
+			deleted_at = CURRENT_TIMESTAMP, merged_into = ?
+		WHERE id = ?`, []interface{}{
+			fmt.Sprintf("deleted-%d@deleted.invalid", userID), "Deleted user",
+			string(hashedCode), mergedIntoValue, userID,
+		}},
+		{"DELETE FROM user_roles WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM user_email_history WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM email_login_codes WHERE user_id = ?", []interface{}{userID}},
+		{"UPDATE pairing_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND used_at IS NULL", []interface{}{userID}},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadUser loads a user's profile by ID
+func loadUser(userID int) (*User, error) {
+	var user User
+	var disabledAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT id, email, name, is_admin, created_at, disabled_at, COALESCE(venue_id, 1)
+		FROM users
+		WHERE id = ?
+	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.IsAdmin, &user.CreatedAt, &disabledAt, &user.VenueID)
+	if err != nil {
+		return nil, err
+	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+	return &user, nil
+}
+
+// isUserDisabled reports whether a user has been disabled or deleted, or
+// is a guest whose time has run out
+func isUserDisabled(userID int) bool {
+	var disabled bool
+	var guestExpiresAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT disabled_at IS NOT NULL, guest_expires_at FROM users WHERE id = ?
+	`, userID).Scan(&disabled, &guestExpiresAt)
+	return err != nil || disabled || (guestExpiresAt.Valid && time.Now().After(guestExpiresAt.Time))
+}
+
+// userIDFromPath parses {id}, writing a 400 if it isn't a number
+func userIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		httpkit.SendError(w, "Invalid user ID", 400)
+		return 0, false
+	}
+	return userID, true
+}
+
+// notSelf stops admins disabling, deleting or merging away their own
+// account, writing a 400 if they try
+func notSelf(w http.ResponseWriter, r *http.Request, userID int) bool {
+	admin := r.Context().Value(userContextKey).(*User)
+	if admin.ID == userID {
+		httpkit.SendError(w, "You cannot do this to your own account", 400)
+		return false
+	}
+	return true
+}
+
+// generateCode returns a random login code of length n
+func generateCode(n int) (string, error) {
+	max := big.NewInt(int64(len(resetCodeAlphabet)))
+	code := make([]byte, n)
+	for i := range code {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = resetCodeAlphabet[idx.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pubgames/shared/httpkit"
+)
+
+// Every launch from the app launcher is recorded in user_activity. The
+// admin analytics endpoints summarise it; each accepts ?days=N (default 30)
+// to limit how far back to look.
+
+const (
+	ANALYTICS_DEFAULT_DAYS = 30
+	ANALYTICS_MAX_DAYS     = 366
+)
+
+// ActiveUsersRow is the active user count for one app in one day or week
+type ActiveUsersRow struct {
+	Period      string `json:"period"`
+	AppID       int    `json:"app_id"`
+	AppName     string `json:"app_name"`
+	ActiveUsers int    `json:"active_users"`
+	Launches    int    `json:"launches"`
+}
+
+// UserActivitySummary is when a user was first and last seen in any app
+type UserActivitySummary struct {
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Launches  int       `json:"launches"`
+	AppsUsed  int       `json:"apps_used"`
+}
+
+// TopApp is an app ranked by how much it was played
+type TopApp struct {
+	AppID       int    `json:"app_id"`
+	AppName     string `json:"app_name"`
+	Icon        string `json:"icon"`
+	Launches    int    `json:"launches"`
+	UniqueUsers int    `json:"unique_users"`
+}
+
+// launchAppHandler records that the user opened an app. The launcher calls
+// it just before redirecting.
+func launchAppHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(*User)
+
+	appID, ok := appIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var app App
+	err := db.QueryRow("SELECT id, name, url FROM apps WHERE id = ? AND is_active = 1", appID).
+		Scan(&app.ID, &app.Name, &app.URL)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "App not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	if _, err := db.Exec("INSERT INTO user_activity (user_id, app_id) VALUES (?, ?)", user.ID, app.ID); err != nil {
+		log.Printf("Warning: Could not record launch of app %d by user %d: %v", app.ID, user.ID, err)
+		httpkit.SendError(w, "Failed to record launch", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"app_id":  app.ID,
+		"url":     app.URL,
+	})
+}
+
+// getActiveUsersHandler returns distinct active users per app per day, or
+// per week with ?period=week (admin only)
+func getActiveUsersHandler(w http.ResponseWriter, r *http.Request) {
+	format := "%Y-%m-%d"
+	switch r.URL.Query().Get("period") {
+	case "", "day":
+	case "week":
+		format = "%Y-W%W"
+	default:
+		httpkit.SendError(w, "period must be day or week", 400)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT strftime(?, ua.accessed_at) AS period, ua.app_id, COALESCE(a.name, 'Deleted app'),
+			COUNT(DISTINCT ua.user_id), COUNT(*)
+		FROM user_activity ua
+		LEFT JOIN apps a ON a.id = ua.app_id
+		WHERE ua.accessed_at >= ?
+		GROUP BY period, ua.app_id
+		ORDER BY period DESC, COUNT(DISTINCT ua.user_id) DESC
+	`, format, analyticsSince(r))
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	results := []ActiveUsersRow{}
+	for rows.Next() {
+		var row ActiveUsersRow
+		if err := rows.Scan(&row.Period, &row.AppID, &row.AppName, &row.ActiveUsers, &row.Launches); err != nil {
+			continue
+		}
+		results = append(results, row)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// getUserActivityHandler returns first-seen and last-seen for each user who
+// has launched an app, most recently active first (admin only). ?days only
+// limits which users are listed; first_seen is always all-time.
+func getUserActivityHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+		SELECT u.id, u.name, u.email, MIN(ua.accessed_at), MAX(ua.accessed_at),
+			COUNT(*), COUNT(DISTINCT ua.app_id)
+		FROM user_activity ua
+		JOIN users u ON u.id = ua.user_id
+		GROUP BY u.id
+		HAVING MAX(ua.accessed_at) >= ?
+		ORDER BY MAX(ua.accessed_at) DESC
+	`, analyticsSince(r))
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	results := []UserActivitySummary{}
+	for rows.Next() {
+		var s UserActivitySummary
+		var firstSeen, lastSeen string
+		if err := rows.Scan(&s.UserID, &s.Name, &s.Email, &firstSeen, &lastSeen, &s.Launches, &s.AppsUsed); err != nil {
+			continue
+		}
+		// MIN/MAX lose the column type, so the timestamps come back as text
+		s.FirstSeen, _ = time.Parse(time.DateTime, firstSeen)
+		s.LastSeen, _ = time.Parse(time.DateTime, lastSeen)
+		results = append(results, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// getTopAppsHandler ranks apps by launches (admin only)
+func getTopAppsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+		SELECT ua.app_id, COALESCE(a.name, 'Deleted app'), COALESCE(a.icon, ''),
+			COUNT(*), COUNT(DISTINCT ua.user_id)
+		FROM user_activity ua
+		LEFT JOIN apps a ON a.id = ua.app_id
+		WHERE ua.accessed_at >= ?
+		GROUP BY ua.app_id
+		ORDER BY COUNT(*) DESC
+	`, analyticsSince(r))
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	results := []TopApp{}
+	for rows.Next() {
+		var app TopApp
+		if err := rows.Scan(&app.AppID, &app.AppName, &app.Icon, &app.Launches, &app.UniqueUsers); err != nil {
+			continue
+		}
+		results = append(results, app)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// analyticsSince returns the start of the ?days window, formatted to compare
+// with accessed_at (stored by SQLite as UTC text)
+func analyticsSince(r *http.Request) string {
+	days := ANALYTICS_DEFAULT_DAYS
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && d > 0 && d <= ANALYTICS_MAX_DAYS {
+		days = d
+	}
+	return time.Now().UTC().AddDate(0, 0, -days).Format(time.DateTime)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The prober calls each active app's GET /api/config (every app serves
+// one) and records whether it answered, how quickly and what version it
+// reported. The launcher uses the result to flag apps that are down.
+
+const (
+	APP_HEALTH_INTERVAL = 30 * time.Second
+	APP_HEALTH_TIMEOUT  = 3 * time.Second
+
+	APP_STATUS_UP      = "up"
+	APP_STATUS_DOWN    = "down"
+	APP_STATUS_UNKNOWN = "unknown"
+)
+
+var healthClient = &http.Client{Timeout: APP_HEALTH_TIMEOUT}
+
+// startHealthProber probes every active app now and then on an interval
+func startHealthProber() {
+	go func() {
+		for {
+			probeAllApps()
+			time.Sleep(APP_HEALTH_INTERVAL)
+		}
+	}()
+}
+
+func probeAllApps() {
+	apps, err := loadApps(true)
+	if err != nil {
+		log.Printf("Warning: Could not load apps to probe: %v", err)
+		return
+	}
+
+	for _, app := range apps {
+		before := APP_STATUS_UNKNOWN
+		if app.Health != nil {
+			before = app.Health.Status
+		}
+
+		health := probeAndStore(app)
+		if health.Status != before && before != APP_STATUS_UNKNOWN {
+			if health.Status == APP_STATUS_UP {
+				log.Printf("💚 App %s is back up", app.Name)
+			} else {
+				log.Printf("💔 App %s is %s: %s", app.Name, health.Status, health.Error)
+			}
+		}
+	}
+}
+
+// probeAndStore probes an app and saves the result to app_health
+func probeAndStore(app App) *AppHealth {
+	health := probeApp(app)
+
+	_, err := db.Exec(`
+		INSERT INTO app_health (app_id, status, latency_ms, version, error, checked_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(app_id) DO UPDATE SET
+			status = excluded.status,
+			latency_ms = excluded.latency_ms,
+			version = excluded.version,
+			error = excluded.error,
+			checked_at = excluded.checked_at
+	`, app.ID, health.Status, health.LatencyMS, health.Version, health.Error, health.CheckedAt)
+	if err != nil {
+		log.Printf("Warning: Could not save health for app %d: %v", app.ID, err)
+	}
+
+	return health
+}
+
+// probeApp fetches the app's /api/config. Apps registered without an
+// api_url can't be probed and are reported as unknown.
+func probeApp(app App) *AppHealth {
+	health := &AppHealth{Status: APP_STATUS_UNKNOWN, CheckedAt: time.Now().UTC()}
+	if app.APIURL == "" {
+		health.Error = "no api_url registered"
+		return health
+	}
+
+	start := time.Now()
+	resp, err := healthClient.Get(strings.TrimRight(app.APIURL, "/") + "/api/config")
+	health.LatencyMS = int(time.Since(start).Milliseconds())
+	if err != nil {
+		health.Status = APP_STATUS_DOWN
+		health.Error = err.Error()
+		return health
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		health.Status = APP_STATUS_DOWN
+		health.Error = fmt.Sprintf("config returned HTTP %d", resp.StatusCode)
+		return health
+	}
+
+	var config struct {
+		Version string `json:"version"`
+	}
+	json.NewDecoder(resp.Body).Decode(&config)
+
+	health.Status = APP_STATUS_UP
+	health.Version = config.Version
+	return health
+}
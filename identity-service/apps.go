@@ -0,0 +1,354 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"pubgames/shared/httpkit"
+)
+
+// loadApps reads the app registry with each app's latest health probe, in
+// display order
+func loadApps(activeOnly bool) ([]App, error) {
+	query := `
+		SELECT a.id, a.name, a.url, COALESCE(a.api_url, ''), COALESCE(a.description, ''),
+			COALESCE(a.icon, ''), a.is_active, COALESCE(a.sort_order, 0), a.created_at,
+			COALESCE(a.redirect_uris, ''), a.venue_id, COALESCE(a.webhook_url, ''), h.status, h.latency_ms, h.version, h.error, h.checked_at
+		FROM apps a
+		LEFT JOIN app_health h ON h.app_id = a.id
+	`
+	if activeOnly {
+		query += " WHERE a.is_active = 1"
+	}
+	query += " ORDER BY a.sort_order, a.name"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apps := []App{}
+	for rows.Next() {
+		var app App
+		var redirectURIs string
+		var venueID sql.NullInt64
+		var status, version, probeErr sql.NullString
+		var latency sql.NullInt64
+		var checkedAt sql.NullTime
+		err := rows.Scan(&app.ID, &app.Name, &app.URL, &app.APIURL, &app.Description,
+			&app.Icon, &app.IsActive, &app.SortOrder, &app.CreatedAt,
+			&redirectURIs, &venueID, &app.WebhookURL, &status, &latency, &version, &probeErr, &checkedAt)
+		if err != nil {
+			continue
+		}
+		if redirectURIs != "" {
+			json.Unmarshal([]byte(redirectURIs), &app.RedirectURIs)
+		}
+		if venueID.Valid {
+			id := int(venueID.Int64)
+			app.VenueID = &id
+		}
+		if status.Valid {
+			app.Health = &AppHealth{
+				Status:    status.String,
+				LatencyMS: int(latency.Int64),
+				Version:   version.String,
+				Error:     probeErr.String,
+				CheckedAt: checkedAt.Time,
+			}
+		}
+		apps = append(apps, app)
+	}
+	return apps, rows.Err()
+}
+
+// loadApp reads a single app by ID
+func loadApp(appID int) (*App, error) {
+	apps, err := loadApps(false)
+	if err != nil {
+		return nil, err
+	}
+	for i := range apps {
+		if apps[i].ID == appID {
+			return &apps[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// updateAppHandler edits an app's registry entry (admin only). Setting
+// is_active to false hides the app from players without deleting it.
+func updateAppHandler(w http.ResponseWriter, r *http.Request) {
+	appID, ok := appIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateAppRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	app, err := loadApp(appID)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "App not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	changes := map[string]interface{}{}
+	setString := func(field string, value *string, target *string) {
+		if value != nil && strings.TrimSpace(*value) != *target {
+			*target = strings.TrimSpace(*value)
+			changes[field] = *target
+		}
+	}
+	setString("name", req.Name, &app.Name)
+	setString("url", req.URL, &app.URL)
+	setString("api_url", req.APIURL, &app.APIURL)
+	setString("description", req.Description, &app.Description)
+	setString("icon", req.Icon, &app.Icon)
+	setString("webhook_url", req.WebhookURL, &app.WebhookURL)
+	if req.IsActive != nil && *req.IsActive != app.IsActive {
+		app.IsActive = *req.IsActive
+		changes["is_active"] = app.IsActive
+	}
+	if req.SortOrder != nil && *req.SortOrder != app.SortOrder {
+		app.SortOrder = *req.SortOrder
+		changes["sort_order"] = app.SortOrder
+	}
+	if req.RedirectURIs != nil {
+		app.RedirectURIs = *req.RedirectURIs
+		changes["redirect_uris"] = app.RedirectURIs
+	}
+	if req.VenueID != nil {
+		app.VenueID = nil
+		if *req.VenueID != 0 {
+			app.VenueID = req.VenueID
+		}
+		changes["venue_id"] = app.VenueID
+	}
+
+	if msg := validateApp(app); msg != "" {
+		httpkit.SendError(w, msg, 400)
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE apps
+		SET name = ?, url = ?, api_url = ?, description = ?, icon = ?, is_active = ?, sort_order = ?,
+			redirect_uris = ?, venue_id = ?, webhook_url = ?
+		WHERE id = ?
+	`, app.Name, app.URL, app.APIURL, app.Description, app.Icon, app.IsActive, app.SortOrder,
+		redirectURIsValue(app.RedirectURIs), app.VenueID, app.WebhookURL, appID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to update app", 500)
+		return
+	}
+
+	if len(changes) > 0 {
+		recordAudit(r, "app.update", "app", appID, changes)
+		log.Printf("🧩 App %d (%s) updated", appID, app.Name)
+	}
+
+	// Probe straight away if the backend moved
+	if _, moved := changes["api_url"]; moved || changes["is_active"] == true {
+		app.Health = probeAndStore(*app)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app)
+}
+
+// deleteAppHandler removes an app from the registry (admin only). Launch
+// history in user_activity is kept; per-app role grants are removed.
+func deleteAppHandler(w http.ResponseWriter, r *http.Request) {
+	appID, ok := appIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	app, err := loadApp(appID)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "App not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM app_health WHERE app_id = ?",
+		"DELETE FROM user_roles WHERE app_id = ?",
+		"DELETE FROM apps WHERE id = ?",
+	} {
+		if _, err := tx.Exec(query, appID); err != nil {
+			httpkit.SendError(w, "Failed to delete app", 500)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		httpkit.SendError(w, "Failed to delete app", 500)
+		return
+	}
+
+	recordAudit(r, "app.delete", "app", appID, map[string]interface{}{"name": app.Name})
+	log.Printf("🗑️  App %d (%s) deleted", appID, app.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "App deleted",
+	})
+}
+
+// reorderAppsHandler sets the display order of apps (admin only). Apps not
+// listed keep their position after the listed ones.
+func reorderAppsHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReorderAppsRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	if len(req.IDs) == 0 {
+		httpkit.SendError(w, "ids is required", 400)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer tx.Rollback()
+
+	// Push everything after the listed apps, then number the listed ones
+	if _, err := tx.Exec("UPDATE apps SET sort_order = sort_order + ?", len(req.IDs)); err != nil {
+		httpkit.SendError(w, "Failed to reorder apps", 500)
+		return
+	}
+	for i, id := range req.IDs {
+		result, err := tx.Exec("UPDATE apps SET sort_order = ? WHERE id = ?", i+1, id)
+		if err != nil {
+			httpkit.SendError(w, "Failed to reorder apps", 500)
+			return
+		}
+		if count, _ := result.RowsAffected(); count == 0 {
+			httpkit.SendError(w, "App not found: "+strconv.Itoa(id), 404)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		httpkit.SendError(w, "Failed to reorder apps", 500)
+		return
+	}
+
+	recordAudit(r, "app.reorder", "app", 0, map[string]interface{}{"ids": req.IDs})
+
+	apps, err := loadApps(false)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apps)
+}
+
+// probeAppHandler checks an app's health now rather than waiting for the
+// next background probe (admin only)
+func probeAppHandler(w http.ResponseWriter, r *http.Request) {
+	appID, ok := appIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	app, err := loadApp(appID)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "App not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	app.Health = probeAndStore(*app)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app)
+}
+
+// validateApp checks the fields an app needs, returning an error message or
+// "" if it is valid
+func validateApp(app *App) string {
+	if app.Name == "" {
+		return "Name is required"
+	}
+	if !isHTTPURL(app.URL) {
+		return "url must be an http(s) URL"
+	}
+	if app.APIURL != "" && !isHTTPURL(app.APIURL) {
+		return "api_url must be an http(s) URL"
+	}
+	for _, uri := range app.RedirectURIs {
+		if !isHTTPURL(uri) {
+			return "redirect_uris must be http(s) URLs"
+		}
+	}
+	if app.WebhookURL != "" && !isHTTPURL(app.WebhookURL) {
+		return "webhook_url must be an http(s) URL"
+	}
+	if app.WebhookURL != "" && !webhookURLAllowed(app.WebhookURL) {
+		return "webhook_url must be on one of the Identity Service's webhook_hosts"
+	}
+	if app.VenueID != nil {
+		if _, msg := resolveVenue(*app.VenueID); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// redirectURIsValue encodes redirect URIs for the apps table
+func redirectURIsValue(uris []string) interface{} {
+	if len(uris) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(uris)
+	return string(data)
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// appIDFromPath reads {id} from the route, writing a 400 if it isn't a number
+func appIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	appID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		httpkit.SendError(w, "Invalid app ID", 400)
+		return 0, false
+	}
+	return appID, true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pubgames/shared/httpkit"
+)
+
+// AuditEntry is one recorded admin action
+type AuditEntry struct {
+	ID         int                    `json:"id"`
+	ActorID    int                    `json:"actor_id"`
+	ActorName  string                 `json:"actor_name,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   int                    `json:"target_id"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	IPAddress  string                 `json:"ip_address"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// recordAudit writes an admin action to the audit log. Failures are
+// logged rather than returned so they never undo the action itself.
+func recordAudit(r *http.Request, action, targetType string, targetID int, details map[string]interface{}) {
+	actorID := 0
+	if actor, ok := r.Context().Value(userContextKey).(*User); ok {
+		actorID = actor.ID
+	}
+
+	var detailsJSON interface{}
+	if len(details) > 0 {
+		data, err := json.Marshal(details)
+		if err == nil {
+			detailsJSON = string(data)
+		}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, details, ip_address)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, actorID, action, targetType, targetID, detailsJSON, clientIP(r))
+	if err != nil {
+		log.Printf("Warning: Failed to write audit log (%s %s %d): %v", action, targetType, targetID, err)
+	}
+}
+
+// getAuditLogHandler returns recent audit entries, newest first (admin only).
+// Optional filters: ?target_type=user&target_id=5, ?actor_id=1, ?limit=100
+func getAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	query := `
+		SELECT a.id, a.actor_id, COALESCE(u.name, ''), a.action, a.target_type,
+			a.target_id, a.details, COALESCE(a.ip_address, ''), a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.actor_id
+		WHERE 1 = 1
+	`
+	args := []interface{}{}
+
+	params := r.URL.Query()
+	if targetType := params.Get("target_type"); targetType != "" {
+		query += " AND a.target_type = ?"
+		args = append(args, targetType)
+	}
+	if targetID, err := strconv.Atoi(params.Get("target_id")); err == nil {
+		query += " AND a.target_id = ?"
+		args = append(args, targetID)
+	}
+	if actorID, err := strconv.Atoi(params.Get("actor_id")); err == nil {
+		query += " AND a.actor_id = ?"
+		args = append(args, actorID)
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(params.Get("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+	query += " ORDER BY a.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var details sql.NullString
+		err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType,
+			&e.TargetID, &details, &e.IPAddress, &e.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if details.Valid {
+			json.Unmarshal([]byte(details.String), &e.Details)
+		}
+		entries = append(entries, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -6,6 +6,9 @@ import (
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
 )
 
 type contextKey string
@@ -17,13 +20,13 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tokenString := extractToken(r)
 		if tokenString == "" {
-			sendError(w, "Missing authorization header", http.StatusUnauthorized)
+			httpkit.SendError(w, "Missing authorization header", http.StatusUnauthorized)
 			return
 		}
 
 		user, err := validateToken(tokenString)
 		if err != nil {
-			sendError(w, "Invalid or expired token", http.StatusUnauthorized)
+			httpkit.SendError(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
@@ -38,12 +41,12 @@ func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, ok := r.Context().Value(userContextKey).(*User)
 		if !ok {
-			sendError(w, "User not found in context", http.StatusUnauthorized)
+			httpkit.SendError(w, "User not found in context", http.StatusUnauthorized)
 			return
 		}
 
 		if !user.IsAdmin {
-			sendError(w, "Admin access required", http.StatusForbidden)
+			httpkit.SendError(w, "Admin access required", http.StatusForbidden)
 			return
 		}
 
@@ -70,10 +73,16 @@ func extractToken(r *http.Request) string {
 func validateToken(tokenString string) (*User, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
 			return nil, jwt.ErrSignatureInvalid
 		}
-		return []byte(JWT_SECRET), nil
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keyStore.Lookup(kid)
+		if !ok {
+			return nil, jwt.ErrTokenUnverifiable
+		}
+		return key.privateKey.Public(), nil
 	})
 
 	if err != nil {
@@ -89,12 +98,48 @@ func validateToken(tokenString string) (*User, error) {
 		return nil, jwt.ErrTokenInvalidClaims
 	}
 
+	// ID tokens are signed with the same keys but aren't for API calls
+	if typ, _ := claims["typ"].(string); typ != auth.TokenTypeAccess {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	// Tokens belong to a session; reject them once it is revoked
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" || !isSessionActive(sessionID) {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	isAdmin, _ := claims["is_admin"].(bool)
+	isGuest, _ := claims["is_guest"].(bool)
+	venueID, _ := claims["venue_id"].(float64)
 	user := &User{
-		ID:      int(claims["user_id"].(float64)),
-		Email:   claims["email"].(string),
-		Name:    claims["name"].(string),
-		IsAdmin: claims["is_admin"].(bool),
+		ID:        int(userID),
+		Email:     email,
+		Name:      name,
+		IsAdmin:   isAdmin,
+		IsGuest:   isGuest,
+		VenueID:   int(venueID),
+		Roles:     rolesFromClaims(claims),
+		SessionID: sessionID,
 	}
 
 	return user, nil
 }
+
+// rolesFromClaims reads the roles claim (a JSON array of strings)
+func rolesFromClaims(claims jwt.MapClaims) []string {
+	raw, _ := claims["roles"].([]interface{})
+	roles := make([]string, 0, len(raw))
+	for _, r := range raw {
+		if role, ok := r.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"pubgames/shared/config"
+	"pubgames/shared/httpkit"
+)
+
+// The CORS rules every backend checks origins against live in the shared
+// config file. Admins edit them here; the file is rewritten and each
+// service's watcher (config.WatchCORSConfig) reloads it within a few
+// seconds, so nothing needs restarting.
+
+// getCORSConfigHandler returns the CORS rules in force (admin only)
+func getCORSConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corsConfig.Current())
+}
+
+// testCORSOriginHandler explains whether ?origin= is allowed by the rules
+// in force, and which rule matched or why each one didn't (admin only)
+func testCORSOriginHandler(w http.ResponseWriter, r *http.Request) {
+	origin := strings.TrimSpace(r.URL.Query().Get("origin"))
+	if origin == "" {
+		httpkit.SendError(w, "origin is required", 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corsConfig.Current().ExplainOrigin(origin))
+}
+
+// updateCORSConfigHandler replaces the CORS rules (admin only). The pub
+// details and environment are kept when left out of the request.
+func updateCORSConfigHandler(w http.ResponseWriter, r *http.Request) {
+	admin := r.Context().Value(userContextKey).(*User)
+	before := corsConfig.Current()
+
+	var updated config.CORSConfig
+	if err := httpkit.Decode(w, r, &updated); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	if updated.Environment == "" {
+		updated.Environment = before.Environment
+	}
+	if updated.PubID == "" {
+		updated.PubID = before.PubID
+	}
+	if updated.PubName == "" {
+		updated.PubName = before.PubName
+	}
+	updated.CORS.Mode = strings.TrimSpace(updated.CORS.Mode)
+	if updated.CORS.Patterns == nil {
+		updated.CORS.Patterns = []string{}
+	}
+	if updated.CORS.ExplicitOrigins == nil {
+		updated.CORS.ExplicitOrigins = []string{}
+	}
+	updated.UpdatedBy = admin.Email
+
+	if err := updated.Validate(); err != nil {
+		httpkit.SendError(w, "Invalid CORS config: "+err.Error(), 400)
+		return
+	}
+
+	if err := config.SaveCORSConfig(&updated); err != nil {
+		log.Printf("Failed to save CORS config: %v", err)
+		httpkit.SendError(w, "Failed to save CORS config", 500)
+		return
+	}
+
+	// Apply it here straight away; other services follow on their next check
+	if err := corsConfig.Reload(); err != nil {
+		log.Printf("Warning: Could not reload CORS config: %v", err)
+	}
+
+	recordAudit(r, "cors.update", "config", 0, map[string]interface{}{
+		"mode":    []string{before.CORS.Mode, updated.CORS.Mode},
+		"origins": [][]string{before.GetAllowedOrigins(), updated.GetAllowedOrigins()},
+	})
+	log.Printf("🌐 User %d updated the CORS rules: mode=%s, origins=%v", admin.ID, updated.CORS.Mode, updated.GetAllowedOrigins())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corsConfig.Current())
+}
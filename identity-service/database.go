@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -13,14 +14,14 @@ import (
 // initDB initializes the database connection and creates tables
 func initDB() {
 	// Ensure data directory exists
-	dataDir := filepath.Dir(DB_PATH)
+	dataDir := filepath.Dir(serviceConfig.DBPath)
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
 	// Open database connection
 	var err error
-	db, err = sql.Open("sqlite3", DB_PATH)
+	db, err = sql.Open("sqlite3", serviceConfig.DBPath)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -39,12 +40,27 @@ func initDB() {
 		name TEXT NOT NULL,
 		code TEXT NOT NULL,
 		is_admin INTEGER DEFAULT 0,
-		-- Passkey fields (for future WebAuthn support)
+		-- Passkey (WebAuthn) credential, one per user
 		passkey_id TEXT,
 		passkey_public_key TEXT,
 		passkey_counter INTEGER DEFAULT 0,
 		passkey_transports TEXT,
 		passkey_created_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		disabled_at TIMESTAMP,
+		deleted_at TIMESTAMP,
+		merged_into INTEGER,
+		-- Set for guest accounts, which stop working after this time
+		guest_expires_at TIMESTAMP,
+		-- The pub the user plays at
+		venue_id INTEGER DEFAULT 1
+	);
+
+	-- Pubs sharing this install; venue 1 is the default
+	CREATE TABLE IF NOT EXISTS venues (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		slug TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -56,9 +72,27 @@ func initDB() {
 		description TEXT,
 		icon TEXT,
 		is_active BOOLEAN DEFAULT 1,
+		api_url TEXT,
+		sort_order INTEGER DEFAULT 0,
+		redirect_uris TEXT,
+		-- NULL for apps offered at every venue
+		venue_id INTEGER,
+		-- Where identity events are POSTed; empty for none
+		webhook_url TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
+	-- Latest health probe result per app
+	CREATE TABLE IF NOT EXISTS app_health (
+		app_id INTEGER PRIMARY KEY,
+		status TEXT NOT NULL,
+		latency_ms INTEGER,
+		version TEXT,
+		error TEXT,
+		checked_at TIMESTAMP NOT NULL,
+		FOREIGN KEY (app_id) REFERENCES apps(id)
+	);
+
 	-- User activity tracking table
 	CREATE TABLE IF NOT EXISTS user_activity (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -68,6 +102,162 @@ func initDB() {
 		FOREIGN KEY (user_id) REFERENCES users(id),
 		FOREIGN KEY (app_id) REFERENCES apps(id)
 	);
+
+	CREATE INDEX IF NOT EXISTS idx_activity_app_time ON user_activity(app_id, accessed_at);
+	CREATE INDEX IF NOT EXISTS idx_activity_user ON user_activity(user_id);
+
+	-- Login sessions (one per device), each holding a rotating refresh token
+	CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		refresh_token_hash TEXT NOT NULL,
+		previous_token_hash TEXT,
+		-- OIDC client the session was issued to; NULL for the launcher
+		client_id TEXT,
+		user_agent TEXT,
+		ip_address TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+	CREATE INDEX IF NOT EXISTS idx_sessions_revoked ON sessions(revoked_at);
+
+	-- Emailed sign-in codes; only a hash of each code is kept
+	CREATE TABLE IF NOT EXISTS email_login_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		attempts INTEGER DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_email_login_codes_user ON email_login_codes(user_id);
+
+	-- One-time tokens for logging in a second device by QR code
+	CREATE TABLE IF NOT EXISTS pairing_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		created_by INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (created_by) REFERENCES users(id)
+	);
+
+	-- Role definitions; per_app roles are granted for a single app
+	CREATE TABLE IF NOT EXISTS roles (
+		name TEXT PRIMARY KEY,
+		description TEXT,
+		per_app INTEGER DEFAULT 0
+	);
+
+	-- Roles held by each user (app_id 0 for global roles)
+	CREATE TABLE IF NOT EXISTS user_roles (
+		user_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		app_id INTEGER NOT NULL DEFAULT 0,
+		granted_by INTEGER,
+		granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, role, app_id),
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (role) REFERENCES roles(name)
+	);
+
+	-- Email addresses users have changed away from
+	CREATE TABLE IF NOT EXISTS user_email_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		email TEXT NOT NULL,
+		changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_email_history_user ON user_email_history(user_id);
+
+	-- Admin actions
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id INTEGER,
+		details TEXT,
+		ip_address TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_target ON audit_log(target_type, target_id);
+
+	-- App backend credentials for signed service-to-service calls
+	CREATE TABLE IF NOT EXISTS app_clients (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		app_id INTEGER,
+		scopes TEXT,
+		created_by INTEGER,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY (app_id) REFERENCES apps(id)
+	);
+
+	-- OAuth authorization codes awaiting exchange at /oauth/token
+	CREATE TABLE IF NOT EXISTS oauth_codes (
+		code_hash TEXT PRIMARY KEY,
+		client_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		redirect_uri TEXT NOT NULL,
+		scope TEXT,
+		nonce TEXT,
+		code_challenge TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);
+
+	-- Failed login counters and lockouts, keyed by account or client IP
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT UNIQUE NOT NULL,
+		failures INTEGER NOT NULL DEFAULT 0,
+		last_failure_at TIMESTAMP NOT NULL,
+		locked_until TIMESTAMP
+	);
+
+	-- Fixed-window request counters, keyed by action and client IP
+	CREATE TABLE IF NOT EXISTS rate_limits (
+		key TEXT PRIMARY KEY,
+		window_start TIMESTAMP NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0
+	);
+
+	-- Identity events queued for, or delivered to, app webhooks
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		app_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_code INTEGER,
+		error TEXT,
+		next_attempt_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		delivered_at TIMESTAMP,
+		FOREIGN KEY (app_id) REFERENCES apps(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
 	`
 
 	_, err = db.Exec(schema)
@@ -75,10 +265,54 @@ func initDB() {
 		log.Fatalf("Failed to create schema: %v", err)
 	}
 
-	log.Println("✅ Database initialized at", DB_PATH)
+	ensureTableIntegrity()
+
+	log.Println("✅ Database initialized at", serviceConfig.DBPath)
 
 	// Seed initial data if needed
+	seedRoles()
 	seedData()
+	confirmLegacyAdmins()
+}
+
+// ensureTableIntegrity adds missing columns for older databases
+func ensureTableIntegrity() {
+	columns := []struct {
+		table  string
+		column string
+		def    string
+	}{
+		{"users", "disabled_at", "TIMESTAMP"},
+		{"users", "deleted_at", "TIMESTAMP"},
+		{"users", "merged_into", "INTEGER"},
+		{"users", "guest_expires_at", "TIMESTAMP"},
+		{"users", "venue_id", "INTEGER DEFAULT 1"},
+		{"apps", "api_url", "TEXT"},
+		{"apps", "sort_order", "INTEGER DEFAULT 0"},
+		{"apps", "redirect_uris", "TEXT"},
+		{"apps", "venue_id", "INTEGER"},
+		{"apps", "webhook_url", "TEXT"},
+		{"sessions", "previous_token_hash", "TEXT"},
+		{"sessions", "client_id", "TEXT"},
+		{"app_clients", "scopes", "TEXT"},
+	}
+
+	for _, col := range columns {
+		var count int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name='%s'", col.table, col.column)
+		err := db.QueryRow(query).Scan(&count)
+		if err != nil {
+			continue
+		}
+
+		if count == 0 {
+			alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.def)
+			_, err := db.Exec(alterSQL)
+			if err == nil {
+				log.Printf("✅ Added column: %s.%s", col.table, col.column)
+			}
+		}
+	}
 }
 
 // seedData adds initial admin user and sample apps if database is empty
@@ -92,11 +326,19 @@ func seedData() {
 		
 		// Create admin with code "123456"
 		hashedCode, _ := bcrypt.GenerateFromPassword([]byte("123456"), 12)
-		_, err := db.Exec(`
+		result, err := db.Exec(`
 			INSERT INTO users (email, name, code, is_admin) 
 			VALUES (?, ?, ?, ?)
 		`, "admin@pubgames.local", "Admin User", string(hashedCode), 1)
 		
+		if err == nil {
+			adminID, _ := result.LastInsertId()
+			for _, role := range []string{ROLE_PLAYER, ROLE_ADMIN} {
+				if err = grantRole(int(adminID), RoleGrant{Role: role}, 0); err != nil {
+					break
+				}
+			}
+		}
 		if err != nil {
 			log.Printf("Warning: Failed to create admin user: %v", err)
 		} else {
@@ -111,31 +353,46 @@ func seedData() {
 	if appCount == 0 {
 		log.Println("   Creating sample apps...")
 		
+		// Apps run on the same machine as this service unless app_host says
+		// otherwise; the launcher swaps localhost for the browser's hostname
+		host := serviceConfig.AppHost
+
 		apps := []struct {
-			name        string
-			url         string
-			description string
-			icon        string
+			name         string
+			frontendPort string
+			backendPort  string
+			description  string
+			icon         string
 		}{
 			{
-				name:        "Last Man Standing",
-				url:         "http://localhost:30010",
-				description: "Tournament prediction game",
-				icon:        "🏆",
+				name:         "Last Man Standing",
+				frontendPort: "30020",
+				backendPort:  "30021",
+				description:  "Tournament prediction game",
+				icon:         "🏆",
+			},
+			{
+				name:         "Sweepstakes",
+				frontendPort: "30030",
+				backendPort:  "30031",
+				description:  "Blind box competition draws",
+				icon:         "🎰",
 			},
 			{
-				name:        "Sweepstakes",
-				url:         "http://localhost:30020",
-				description: "Blind box competition draws",
-				icon:        "🎰",
+				name:         "Tic Tac Toe",
+				frontendPort: "30040",
+				backendPort:  "30041",
+				description:  "Challenge other players to a game",
+				icon:         "⭕",
 			},
 		}
 
-		for _, app := range apps {
+		for i, app := range apps {
 			_, err := db.Exec(`
-				INSERT INTO apps (name, url, description, icon, is_active) 
-				VALUES (?, ?, ?, ?, ?)
-			`, app.name, app.url, app.description, app.icon, true)
+				INSERT INTO apps (name, url, api_url, description, icon, is_active, sort_order) 
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, app.name, "http://"+host+":"+app.frontendPort, "http://"+host+":"+app.backendPort,
+				app.description, app.icon, true, i+1)
 			
 			if err != nil {
 				log.Printf("Warning: Failed to insert app %s: %v", app.name, err)
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+
+	"pubgames/shared/httpkit"
+)
+
+// The user directory lets app backends turn the user IDs they store into
+// display names and avatars. Lookups are signed with the app's client
+// credentials (see service_clients.go) and only return public details,
+// never emails, of users that haven't been deleted or merged. Avatars are
+// generated from the user's initials and served from signed links, valid
+// for an hour or two, that only lookups hand out, so user IDs can't be
+// walked to collect everyone's initials.
+//
+// Apps that stored data by email before they stored user IDs can also ask
+// which user an email belongs to, if their client was granted the
+// users:emails scope; otherwise any app could test which addresses have
+// accounts. An address resolves only if exactly one live account has ever
+// used it, as its current or a former email, so data is never handed to
+// someone who took over a reused address.
+
+const (
+	MAX_LOOKUP_IDS = 500
+
+	// Avatar links expire between one and two hours after they're issued.
+	// Expiry is rounded to the hour so a user's link stays the same, and
+	// cacheable, for an hour at a time.
+	AVATAR_LINK_TTL = time.Hour
+)
+
+// avatarColors are the backgrounds avatars are drawn on, picked by user ID
+var avatarColors = []string{
+	"#e74c3c", "#e67e22", "#f1c40f", "#2ecc71", "#1abc9c",
+	"#3498db", "#9b59b6", "#34495e", "#16a085", "#d35400",
+}
+
+// DirectoryUser is the public view of a user
+type DirectoryUser struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// UserLookupRequest lists the user IDs, and emails, to resolve
+type UserLookupRequest struct {
+	IDs    []int    `json:"ids"`
+	Emails []string `json:"emails"`
+}
+
+// EmailOwner is the user an email resolved to
+type EmailOwner struct {
+	Email  string `json:"email"`
+	UserID int    `json:"user_id"`
+}
+
+// lookupUsersHandler returns names and avatars for a batch of user IDs,
+// and, for clients with the users:emails scope, the owners of a batch of
+// emails (service route). Unknown IDs and emails that don't resolve are
+// left out of the response.
+func lookupUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var req UserLookupRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	if len(req.IDs) > MAX_LOOKUP_IDS || len(req.Emails) > MAX_LOOKUP_IDS {
+		httpkit.SendError(w, fmt.Sprintf("At most %d IDs or emails can be looked up at once", MAX_LOOKUP_IDS), 400)
+		return
+	}
+	client := r.Context().Value(serviceClientContextKey).(*ServiceClient)
+	if len(req.Emails) > 0 && !client.hasScope(SCOPE_LOOKUP_EMAILS) {
+		httpkit.SendError(w, "This client may not look up emails; it needs the "+SCOPE_LOOKUP_EMAILS+" scope", http.StatusForbidden)
+		return
+	}
+
+	owners, err := emailOwners(req.Emails)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	users := []DirectoryUser{}
+	if len(req.IDs) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"users": users, "emails": owners})
+		return
+	}
+
+	placeholders := make([]string, len(req.IDs))
+	args := make([]interface{}, len(req.IDs))
+	for i, id := range req.IDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	rows, err := db.Query(`
+		SELECT id, name FROM users
+		WHERE id IN (`+strings.Join(placeholders, ", ")+`) AND deleted_at IS NULL
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u DirectoryUser
+		if err := rows.Scan(&u.ID, &u.Name); err != nil {
+			continue
+		}
+		u.AvatarURL = avatarURL(u.ID)
+		users = append(users, u)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"users": users, "emails": owners})
+}
+
+// emailOwners resolves emails to the one live user who has held each of
+// them. Emails held by nobody, or by more than one user over time, are
+// left out.
+func emailOwners(emails []string) ([]EmailOwner, error) {
+	owners := []EmailOwner{}
+	if len(emails) == 0 {
+		return owners, nil
+	}
+
+	placeholders := make([]string, len(emails))
+	args := make([]interface{}, 0, 2*len(emails))
+	for i, email := range emails {
+		placeholders[i] = "?"
+		args = append(args, strings.ToLower(strings.TrimSpace(email)))
+	}
+	args = append(args, args...)
+	in := "(" + strings.Join(placeholders, ", ") + ")"
+
+	rows, err := db.Query(`
+		SELECT lower(email), id FROM users
+		WHERE deleted_at IS NULL AND lower(email) IN `+in+`
+		UNION
+		SELECT lower(h.email), h.user_id FROM user_email_history h
+		JOIN users u ON u.id = h.user_id
+		WHERE u.deleted_at IS NULL AND lower(h.email) IN `+in, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holders := make(map[string][]int)
+	for rows.Next() {
+		var email string
+		var userID int
+		if err := rows.Scan(&email, &userID); err != nil {
+			return nil, err
+		}
+		holders[email] = append(holders[email], userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for email, ids := range holders {
+		if len(ids) == 1 {
+			owners = append(owners, EmailOwner{Email: email, UserID: ids[0]})
+		}
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].Email < owners[j].Email })
+	return owners, nil
+}
+
+// avatarHandler draws a user's avatar as an SVG of their initials. The
+// route is public so it can be used in img tags, but needs the signature
+// from a link avatarURL made.
+func avatarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		httpkit.SendError(w, "Invalid user ID", 400)
+		return
+	}
+	if !validAvatarLink(userID, r.URL.Query()) {
+		httpkit.SendError(w, "Invalid or expired avatar link", 403)
+		return
+	}
+
+	var name string
+	err = db.QueryRow("SELECT name FROM users WHERE id = ? AND deleted_at IS NULL", userID).Scan(&name)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	color := avatarColors[userID%len(avatarColors)]
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64" viewBox="0 0 64 64">`+
+		`<circle cx="32" cy="32" r="32" fill="%s"/>`+
+		`<text x="32" y="32" dy=".35em" text-anchor="middle" font-family="sans-serif" font-size="26" font-weight="bold" fill="#fff">%s</text>`+
+		`</svg>`, color, html.EscapeString(initials(name)))
+}
+
+// avatarURL is a signed link to a user's avatar, relative to the Identity
+// Service. Links are signed with the active JWT signing key.
+func avatarURL(userID int) string {
+	key := keyStore.Active()
+	if key == nil {
+		return ""
+	}
+	expires := time.Now().Truncate(AVATAR_LINK_TTL).Add(2 * AVATAR_LINK_TTL).Unix()
+	sig := ed25519.Sign(key.privateKey, avatarLinkMessage(userID, expires))
+
+	query := url.Values{}
+	query.Set("kid", key.KID)
+	query.Set("exp", strconv.FormatInt(expires, 10))
+	query.Set("sig", base64.RawURLEncoding.EncodeToString(sig))
+	return fmt.Sprintf("/api/users/%d/avatar.svg?%s", userID, query.Encode())
+}
+
+// validAvatarLink checks the signature and expiry of an avatar link. Links
+// signed with a key that has since been retired work until the key is
+// removed.
+func validAvatarLink(userID int, query url.Values) bool {
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(query.Get("sig"))
+	if err != nil {
+		return false
+	}
+	key, ok := keyStore.Lookup(query.Get("kid"))
+	if !ok {
+		return false
+	}
+	publicKey := key.privateKey.Public().(ed25519.PublicKey)
+	return ed25519.Verify(publicKey, avatarLinkMessage(userID, expires), sig)
+}
+
+// avatarLinkMessage is what an avatar link's signature covers
+func avatarLinkMessage(userID int, expires int64) []byte {
+	return []byte(fmt.Sprintf("avatar:%d:%d", userID, expires))
+}
+
+// initials returns up to two initials for a name, e.g. "Lucky Otter 42"
+// gives "LO"
+func initials(name string) string {
+	var out []rune
+	for _, word := range strings.Fields(name) {
+		first := []rune(word)[0]
+		if !unicode.IsLetter(first) {
+			continue
+		}
+		out = append(out, unicode.ToUpper(first))
+		if len(out) == 2 {
+			break
+		}
+	}
+	if len(out) == 0 {
+		return "?"
+	}
+	return string(out)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pubgames/shared/httpkit"
+)
+
+// Email login: instead of their fixed code, a user can ask for a one-time
+// code to be emailed to them and exchange it for a session. Codes are
+// single use, expire after a few minutes and only the latest one works.
+// Wrong codes count towards the same lockout as normal logins.
+
+const (
+	EMAIL_CODE_TTL = 10 * time.Minute
+
+	// Wrong guesses allowed against one code before it stops working
+	EMAIL_CODE_MAX_ATTEMPTS = 5
+
+	// Codes one address can be sent before requests are throttled
+	EMAIL_CODE_FREE_SENDS = 5
+)
+
+// EmailCodeRequest asks for a login code to be emailed
+type EmailCodeRequest struct {
+	Email string `json:"email"`
+}
+
+// EmailCodeLoginRequest exchanges an emailed code for a session
+type EmailCodeLoginRequest struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+// requestEmailCodeHandler emails a one-time login code (public route). The
+// response is the same whether or not the email is registered, so it can't
+// be used to find out who has an account.
+func requestEmailCodeHandler(w http.ResponseWriter, r *http.Request) {
+	var req EmailCodeRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		httpkit.SendError(w, "Email is required", 400)
+		return
+	}
+
+	sendKey := "email-code:" + strings.ToLower(req.Email)
+	_, ipKey := throttleKeys(req.Email, r)
+	if wait := checkLoginThrottle(sendKey, ipKey); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		httpkit.SendError(w, "Too many codes requested. Please wait and try again.", http.StatusTooManyRequests)
+		return
+	}
+
+	// Count every send so nobody can flood an inbox, or step through
+	// addresses from one IP
+	recordLoginFailure(sendKey, EMAIL_CODE_FREE_SENDS)
+	recordLoginFailure(ipKey, IP_FREE_ATTEMPTS)
+
+	// Emails match case-insensitively, as the throttle keys do
+	var userID int
+	var email, name string
+	err := db.QueryRow(`
+		SELECT id, email, name FROM users
+		WHERE lower(email) = lower(?) AND deleted_at IS NULL AND guest_expires_at IS NULL
+		ORDER BY email = ? DESC, id LIMIT 1
+	`, req.Email, req.Email).Scan(&userID, &email, &name)
+	if err != nil && err != sql.ErrNoRows {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	if err == nil && !isUserDisabled(userID) {
+		code, err := createEmailCode(userID)
+		if err != nil {
+			log.Printf("Failed to create email code for user %d: %v", userID, err)
+			httpkit.SendError(w, "Failed to send code", 500)
+			return
+		}
+
+		// Send in the background so slow mail servers don't hold up the
+		// response or reveal that the account exists
+		msg := Mail{
+			To:      email,
+			Subject: "Your PubGames login code",
+			Body: fmt.Sprintf("Hi %s,\n\nYour PubGames login code is %s\n\nIt expires in %d minutes. If you didn't ask for it you can ignore this email.\n",
+				name, code, int(EMAIL_CODE_TTL.Minutes())),
+		}
+		go func() {
+			if err := mailer.Send(msg); err != nil {
+				log.Printf("⚠️  Failed to email login code to user %d: %v", userID, err)
+			}
+		}()
+		log.Printf("📧 Login code sent to user %d", userID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "If that email is registered, a login code is on its way",
+		"expires_in": int(EMAIL_CODE_TTL.Seconds()),
+	})
+}
+
+// emailCodeLoginHandler trades an emailed code for a session (public route)
+func emailCodeLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req EmailCodeLoginRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	req.Code = strings.TrimSpace(req.Code)
+
+	accountKey, ipKey := throttleKeys(req.Email, r)
+	if wait := checkLoginThrottle(accountKey, ipKey); wait > 0 {
+		sendThrottled(w, wait)
+		return
+	}
+
+	fail := func() {
+		recordLoginFailure(accountKey, ACCOUNT_FREE_ATTEMPTS)
+		recordLoginFailure(ipKey, IP_FREE_ATTEMPTS)
+		httpkit.SendError(w, "Invalid or expired code", 401)
+	}
+
+	var user User
+	err := db.QueryRow(`
+		SELECT id, email, name, is_admin, created_at
+		FROM users
+		WHERE lower(email) = lower(?) AND deleted_at IS NULL
+		ORDER BY email = ? DESC, id LIMIT 1
+	`, req.Email, req.Email).Scan(&user.ID, &user.Email, &user.Name, &user.IsAdmin, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		fail()
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	ok, err := useEmailCode(user.ID, req.Code)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	if !ok {
+		fail()
+		return
+	}
+	clearLoginFailures(accountKey)
+
+	log.Printf("📧 User %d logged in with an emailed code", user.ID)
+
+	// Start a session and return tokens with user data
+	issueLogin(w, r, &user)
+}
+
+// createEmailCode stores a new login code for a user, replacing any
+// earlier unused one, and returns it
+func createEmailCode(userID int) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	now := time.Now().UTC()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE email_login_codes SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO email_login_codes (user_id, code_hash, expires_at)
+		VALUES (?, ?, ?)
+	`, userID, emailCodeHash(userID, code), now.Add(EMAIL_CODE_TTL))
+	if err != nil {
+		return "", err
+	}
+
+	return code, tx.Commit()
+}
+
+// useEmailCode checks a code against the user's current one and marks it
+// used if it matches. A wrong guess counts against the code.
+func useEmailCode(userID int, code string) (bool, error) {
+	now := time.Now().UTC()
+
+	var id, attempts int
+	var codeHash string
+	err := db.QueryRow(`
+		SELECT id, code_hash, attempts FROM email_login_codes
+		WHERE user_id = ? AND used_at IS NULL AND expires_at > ?
+		ORDER BY id DESC LIMIT 1
+	`, userID, now).Scan(&id, &codeHash, &attempts)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if attempts >= EMAIL_CODE_MAX_ATTEMPTS {
+		return false, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(emailCodeHash(userID, code))) != 1 {
+		_, err := db.Exec("UPDATE email_login_codes SET attempts = attempts + 1 WHERE id = ?", id)
+		return false, err
+	}
+
+	// Mark it used in the same statement that checks it, so two requests
+	// racing with the same code can't both get in
+	result, err := db.Exec(`
+		UPDATE email_login_codes SET used_at = ?
+		WHERE id = ? AND used_at IS NULL
+	`, now, id)
+	if err != nil {
+		return false, err
+	}
+	count, _ := result.RowsAffected()
+	return count > 0, nil
+}
+
+// emailCodeHash is what's stored for a code. Including the user ID means
+// the same code for two users doesn't hash the same.
+func emailCodeHash(userID int, code string) string {
+	return hashToken(fmt.Sprintf("%d:%s", userID, code))
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// Guest accounts let someone at the venue play straight away without
+// registering. A guest is a normal users row with a generated name, a
+// placeholder email, the guest role and a guest_expires_at after which it
+// stops working. Upgrading turns the same row into a full account, so game
+// history recorded against the user ID carries over.
+
+const (
+	GUEST_TTL          = 24 * time.Hour
+	GUEST_EMAIL_DOMAIN = "guest.pubgames.local"
+
+	// Guest accounts one IP can create per minute. Everyone in a pub shares
+	// the Wi-Fi's IP, so this only stops a single device minting guests in
+	// bulk, and the limit lifts when the minute is up.
+	GUEST_PER_IP_PER_MINUTE = 10
+)
+
+var (
+	guestAdjectives = []string{
+		"Lucky", "Jolly", "Brave", "Clever", "Cheeky", "Mighty", "Sneaky", "Speedy",
+		"Witty", "Dizzy", "Bold", "Merry", "Quiet", "Rapid", "Sunny", "Wild",
+	}
+	guestAnimals = []string{
+		"Otter", "Badger", "Fox", "Hedgehog", "Owl", "Hare", "Puffin", "Stag",
+		"Heron", "Weasel", "Robin", "Pike", "Newt", "Magpie", "Mole", "Wren",
+	}
+)
+
+// CreateGuestRequest optionally picks the venue a guest plays at
+type CreateGuestRequest struct {
+	VenueID int `json:"venue_id"`
+}
+
+// UpgradeGuestRequest turns a guest into a full account
+type UpgradeGuestRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Code  string `json:"code"`
+}
+
+// createGuestHandler creates a guest account and logs it in
+func createGuestHandler(w http.ResponseWriter, r *http.Request) {
+	if wait := takeRateLimit("guest-ip:"+clientIP(r), GUEST_PER_IP_PER_MINUTE, time.Minute); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		httpkit.SendError(w, "Too many guest accounts from this network. Please try again in a minute.", http.StatusTooManyRequests)
+		return
+	}
+
+	// The body is optional; without one the guest joins the default venue
+	var req CreateGuestRequest
+	if err := httpkit.Decode(w, r, &req); err != nil && err != httpkit.ErrEmptyBody {
+		httpkit.WriteError(w, err)
+		return
+	}
+	venueID, msg := resolveVenue(req.VenueID)
+	if msg != "" {
+		httpkit.SendError(w, msg, 400)
+		return
+	}
+
+	name, err := generateGuestName()
+	if err != nil {
+		httpkit.SendError(w, "Failed to create guest", 500)
+		return
+	}
+	emailPart, err := randomToken(9)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create guest", 500)
+		return
+	}
+	email := "guest-" + strings.ToLower(emailPart) + "@" + GUEST_EMAIL_DOMAIN
+
+	// Guests sign in with their session only; nobody knows this code
+	secret, err := randomToken(32)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create guest", 500)
+		return
+	}
+	hashedCode, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create guest", 500)
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO users (email, name, code, is_admin, guest_expires_at, venue_id)
+		VALUES (?, ?, ?, 0, ?, ?)
+	`, email, name, string(hashedCode), time.Now().UTC().Add(GUEST_TTL), venueID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create guest", 500)
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	if err := grantRole(int(id), RoleGrant{Role: ROLE_GUEST}, 0); err != nil {
+		httpkit.SendError(w, "Failed to create guest", 500)
+		return
+	}
+
+	user, err := loadUser(int(id))
+	if err != nil {
+		httpkit.SendError(w, "Failed to create guest", 500)
+		return
+	}
+
+	log.Printf("🎟️  Guest %d (%s) created", user.ID, user.Name)
+	publishUserEvent(auth.EventUserCreated, user.ID)
+	issueLogin(w, r, user)
+}
+
+// upgradeGuestHandler turns the current guest into a full account with
+// their chosen email, name and code. The user ID stays the same so their
+// game history is kept, and the session is extended to a normal lifetime.
+func upgradeGuestHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+	if !current.IsGuest {
+		httpkit.SendError(w, "Only guest accounts can be upgraded", 400)
+		return
+	}
+
+	var req UpgradeGuestRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	req.Name = strings.TrimSpace(req.Name)
+
+	if req.Email == "" || req.Code == "" {
+		httpkit.SendError(w, "Email and code are required", 400)
+		return
+	}
+	if len(req.Code) != 6 {
+		httpkit.SendError(w, "Code must be exactly 6 characters", 400)
+		return
+	}
+
+	user, err := loadUser(current.ID)
+	if err != nil {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+	if !emailAvailable(w, req.Email, user.ID) {
+		return
+	}
+	guestEmail := user.Email
+	user.Email = req.Email
+	if req.Name != "" {
+		user.Name = req.Name
+	}
+
+	hashedCode, err := bcrypt.GenerateFromPassword([]byte(req.Code), 12)
+	if err != nil {
+		httpkit.SendError(w, "Failed to process code", 500)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET email = ?, name = ?, code = ?, guest_expires_at = NULL
+		WHERE id = ?
+	`, user.Email, user.Name, string(hashedCode), user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			httpkit.SendError(w, "Email already registered", 409)
+		} else {
+			httpkit.SendError(w, "Failed to upgrade account", 500)
+		}
+		return
+	}
+
+	// Apps that key on email can still find what was played as a guest
+	if err := recordEmailChange(tx, user.ID, guestEmail); err != nil {
+		httpkit.SendError(w, "Failed to upgrade account", 500)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role = ?", user.ID, ROLE_GUEST); err != nil {
+		httpkit.SendError(w, "Failed to upgrade account", 500)
+		return
+	}
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO user_roles (user_id, role, app_id, granted_by)
+		VALUES (?, ?, 0, 0)
+	`, user.ID, ROLE_PLAYER)
+	if err != nil {
+		httpkit.SendError(w, "Failed to upgrade account", 500)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET expires_at = ? WHERE id = ?",
+		time.Now().UTC().Add(REFRESH_TOKEN_TTL), current.SessionID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to upgrade account", 500)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		httpkit.SendError(w, "Failed to upgrade account", 500)
+		return
+	}
+
+	log.Printf("🎟️  Guest %d upgraded to a full account", user.ID)
+	publishUserEvent(auth.EventUserUpdated, user.ID)
+
+	token, err := generateToken(user, current.SessionID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to generate token", 500)
+		return
+	}
+	user.SessionID = current.SessionID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token": token,
+		"user":  user,
+	})
+}
+
+// noGuestsMiddleware keeps guests away from account settings until they
+// upgrade
+func noGuestsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(userContextKey).(*User)
+		if !ok {
+			httpkit.SendError(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if user.IsGuest {
+			httpkit.SendError(w, "Create a full account to use this", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// sessionExpiry is when a new session for the user should end: the usual
+// refresh token lifetime, or sooner for a guest whose account runs out
+func sessionExpiry(userID int) time.Time {
+	expiresAt := time.Now().UTC().Add(REFRESH_TOKEN_TTL)
+
+	var guestExpiresAt sql.NullTime
+	db.QueryRow("SELECT guest_expires_at FROM users WHERE id = ?", userID).Scan(&guestExpiresAt)
+	if guestExpiresAt.Valid && guestExpiresAt.Time.Before(expiresAt) {
+		expiresAt = guestExpiresAt.Time.UTC()
+	}
+	return expiresAt
+}
+
+// generateGuestName picks a friendly display name like "Lucky Otter 42"
+func generateGuestName() (string, error) {
+	pick := func(n int) (int, error) {
+		v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+		if err != nil {
+			return 0, err
+		}
+		return int(v.Int64()), nil
+	}
+
+	adjective, err := pick(len(guestAdjectives))
+	if err != nil {
+		return "", err
+	}
+	animal, err := pick(len(guestAnimals))
+	if err != nil {
+		return "", err
+	}
+	number, err := pick(90)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %d", guestAdjectives[adjective], guestAnimals[animal], number+10), nil
+}
@@ -3,71 +3,99 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
 )
 
 // registerHandler creates a new user account
 func registerHandler(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, "Invalid request body", 400)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 
 	// Validate input
 	if req.Email == "" || req.Name == "" || req.Code == "" {
-		sendError(w, "Email, name, and code are required", 400)
+		httpkit.SendError(w, "Email, name, and code are required", 400)
 		return
 	}
 
 	if len(req.Code) != 6 {
-		sendError(w, "Code must be exactly 6 characters", 400)
+		httpkit.SendError(w, "Code must be exactly 6 characters", 400)
+		return
+	}
+
+	venueID, msg := resolveVenue(req.VenueID)
+	if msg != "" {
+		httpkit.SendError(w, msg, 400)
+		return
+	}
+
+	if !emailAvailable(w, req.Email, 0) {
 		return
 	}
 
 	// Hash the code
 	hashedCode, err := bcrypt.GenerateFromPassword([]byte(req.Code), 12)
 	if err != nil {
-		sendError(w, "Failed to process code", 500)
+		httpkit.SendError(w, "Failed to process code", 500)
 		return
 	}
 
-	// Insert user
+	// Insert user - new accounts are always players; other roles are
+	// granted by an admin
 	result, err := db.Exec(`
-		INSERT INTO users (email, name, code, is_admin) 
-		VALUES (?, ?, ?, ?)
-	`, req.Email, req.Name, string(hashedCode), req.IsAdmin)
+		INSERT INTO users (email, name, code, is_admin, venue_id) 
+		VALUES (?, ?, ?, 0, ?)
+	`, req.Email, req.Name, string(hashedCode), venueID)
 
 	if err != nil {
 		if err.Error() == "UNIQUE constraint failed: users.email" {
-			sendError(w, "Email already registered", 409)
+			httpkit.SendError(w, "Email already registered", 409)
 		} else {
-			sendError(w, "Failed to create user", 500)
+			httpkit.SendError(w, "Failed to create user", 500)
 		}
 		return
 	}
 
 	id, _ := result.LastInsertId()
+	if err := grantRole(int(id), RoleGrant{Role: ROLE_PLAYER}, 0); err != nil {
+		log.Printf("Warning: Failed to grant player role to user %d: %v", id, err)
+	}
+	publishUserEvent(auth.EventUserCreated, int(id))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":      id,
-		"email":   req.Email,
-		"name":    req.Name,
-		"message": "User registered successfully",
+		"id":       id,
+		"email":    req.Email,
+		"name":     req.Name,
+		"venue_id": venueID,
+		"message":  "User registered successfully",
 	})
 }
 
 // loginHandler authenticates a user and returns a JWT token
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, "Invalid request body", 400)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	// Refuse early while the account or IP is locked out
+	accountKey, ipKey := throttleKeys(req.Email, r)
+	if wait := checkLoginThrottle(accountKey, ipKey); wait > 0 {
+		sendThrottled(w, wait)
 		return
 	}
 
@@ -81,45 +109,39 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	`, req.Email).Scan(&user.ID, &user.Email, &user.Name, &storedCode, &user.IsAdmin, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
-		sendError(w, "Invalid credentials", 401)
+		recordLoginFailure(accountKey, ACCOUNT_FREE_ATTEMPTS)
+		recordLoginFailure(ipKey, IP_FREE_ATTEMPTS)
+		httpkit.SendError(w, "Invalid credentials", 401)
 		return
 	} else if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 
 	// Verify code
 	if err := bcrypt.CompareHashAndPassword([]byte(storedCode), []byte(req.Code)); err != nil {
-		sendError(w, "Invalid credentials", 401)
-		return
-	}
-
-	// Generate JWT token
-	token, err := generateToken(&user)
-	if err != nil {
-		sendError(w, "Failed to generate token", 500)
+		recordLoginFailure(accountKey, ACCOUNT_FREE_ATTEMPTS)
+		recordLoginFailure(ipKey, IP_FREE_ATTEMPTS)
+		httpkit.SendError(w, "Invalid credentials", 401)
 		return
 	}
+	clearLoginFailures(accountKey)
 
-	// Return user data and token
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(LoginResponse{
-		Token: token,
-		User:  user,
-	})
+	// Start a session and return tokens with user data
+	issueLogin(w, r, &user)
 }
 
 // validateTokenHandler validates a JWT token and returns user data
 func validateTokenHandler(w http.ResponseWriter, r *http.Request) {
 	tokenString := extractToken(r)
 	if tokenString == "" {
-		sendError(w, "Missing authorization header", 401)
+		httpkit.SendError(w, "Missing authorization header", 401)
 		return
 	}
 
 	user, err := validateToken(tokenString)
 	if err != nil {
-		sendError(w, "Invalid or expired token", 401)
+		httpkit.SendError(w, "Invalid or expired token", 401)
 		return
 	}
 
@@ -134,76 +156,82 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
-// getAppsHandler returns list of available apps
+// getAppsHandler returns list of available apps, with their latest health
+// so the launcher can flag apps that are down
 func getAppsHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(`
-		SELECT id, name, url, description, icon, is_active 
-		FROM apps 
-		WHERE is_active = 1 
-		ORDER BY name
-	`)
+	apps, err := loadApps(true)
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
-	defer rows.Close()
 
-	apps := []App{}
-	for rows.Next() {
-		var app App
-		err := rows.Scan(&app.ID, &app.Name, &app.URL, &app.Description, &app.Icon, &app.IsActive)
-		if err != nil {
+	// ?venue_id= limits the list to apps offered at that venue
+	venueID, _ := strconv.Atoi(r.URL.Query().Get("venue_id"))
+
+	// Players don't need probe errors or backend URLs
+	visible := []App{}
+	for _, app := range apps {
+		if venueID != 0 && !appAtVenue(app, venueID) {
 			continue
 		}
-		apps = append(apps, app)
+		app.APIURL = ""
+		app.RedirectURIs = nil
+		app.WebhookURL = ""
+		if app.Health != nil {
+			app.Health.Error = ""
+		}
+		visible = append(visible, app)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(apps)
+	json.NewEncoder(w).Encode(visible)
 }
 
 // getAdminAppsHandler returns all apps (including inactive) for admin
 func getAdminAppsHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(`
-		SELECT id, name, url, description, icon, is_active, created_at 
-		FROM apps 
-		ORDER BY created_at DESC
-	`)
+	apps, err := loadApps(false)
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
-	defer rows.Close()
-
-	apps := []App{}
-	for rows.Next() {
-		var app App
-		err := rows.Scan(&app.ID, &app.Name, &app.URL, &app.Description, &app.Icon, &app.IsActive, &app.CreatedAt)
-		if err != nil {
-			continue
-		}
-		apps = append(apps, app)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(apps)
 }
 
-// createAppHandler creates a new app entry
+// createAppHandler creates a new app entry, placed last unless sort_order
+// is given
 func createAppHandler(w http.ResponseWriter, r *http.Request) {
 	var app App
-	if err := json.NewDecoder(r.Body).Decode(&app); err != nil {
-		sendError(w, "Invalid request body", 400)
+	if err := httpkit.Decode(w, r, &app); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
+	app.Name = strings.TrimSpace(app.Name)
+	app.URL = strings.TrimSpace(app.URL)
+	app.APIURL = strings.TrimSpace(app.APIURL)
+	app.WebhookURL = strings.TrimSpace(app.WebhookURL)
+
+	if msg := validateApp(&app); msg != "" {
+		httpkit.SendError(w, msg, 400)
+		return
+	}
+
+	if app.SortOrder == 0 {
+		db.QueryRow("SELECT COALESCE(MAX(sort_order), 0) + 1 FROM apps").Scan(&app.SortOrder)
+	}
+	if app.VenueID != nil && *app.VenueID == 0 {
+		app.VenueID = nil
+	}
 
 	result, err := db.Exec(`
-		INSERT INTO apps (name, url, description, icon, is_active) 
-		VALUES (?, ?, ?, ?, ?)
-	`, app.Name, app.URL, app.Description, app.Icon, app.IsActive)
+		INSERT INTO apps (name, url, api_url, description, icon, is_active, sort_order, redirect_uris, venue_id, webhook_url) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, app.Name, app.URL, app.APIURL, app.Description, app.Icon, app.IsActive, app.SortOrder,
+		redirectURIsValue(app.RedirectURIs), app.VenueID, app.WebhookURL)
 
 	if err != nil {
-		sendError(w, "Failed to create app", 500)
+		httpkit.SendError(w, "Failed to create app", 500)
 		return
 	}
 
@@ -211,6 +239,11 @@ func createAppHandler(w http.ResponseWriter, r *http.Request) {
 	app.ID = int(id)
 	app.CreatedAt = time.Now()
 
+	recordAudit(r, "app.create", "app", app.ID, map[string]interface{}{"name": app.Name})
+	if app.IsActive {
+		app.Health = probeAndStore(app)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(app)
@@ -218,13 +251,27 @@ func createAppHandler(w http.ResponseWriter, r *http.Request) {
 
 // getUsersHandler returns all users (admin only)
 func getUsersHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(`
-		SELECT id, email, name, is_admin, created_at 
+	query := `
+		SELECT id, email, name, is_admin, created_at, disabled_at, guest_expires_at IS NOT NULL,
+			COALESCE(venue_id, 1)
 		FROM users 
-		ORDER BY created_at DESC
-	`)
+		WHERE deleted_at IS NULL
+	`
+	args := []interface{}{}
+	if venue := r.URL.Query().Get("venue_id"); venue != "" {
+		venueID, err := strconv.Atoi(venue)
+		if err != nil {
+			httpkit.SendError(w, "Invalid venue ID", 400)
+			return
+		}
+		query += " AND COALESCE(venue_id, 1) = ?"
+		args = append(args, venueID)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	defer rows.Close()
@@ -232,10 +279,15 @@ func getUsersHandler(w http.ResponseWriter, r *http.Request) {
 	users := []User{}
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.IsAdmin, &user.CreatedAt)
+		var disabledAt sql.NullTime
+		err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.IsAdmin, &user.CreatedAt, &disabledAt, &user.IsGuest,
+			&user.VenueID)
 		if err != nil {
 			continue
 		}
+		if disabledAt.Valid {
+			user.DisabledAt = &disabledAt.Time
+		}
 		users = append(users, user)
 	}
 
@@ -243,26 +295,51 @@ func getUsersHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(users)
 }
 
-// sendError sends a JSON error response
-func sendError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{
-		Error: message,
-		Code:  code,
-	})
-}
+// generateToken creates a short-lived access token for a user's session,
+// signed with the active key
+func generateToken(user *User, sessionID string) (string, error) {
+	key := keyStore.Active()
+	if key == nil {
+		return "", jwt.ErrInvalidKey
+	}
+
+	// Roles and venue are read fresh so a refreshed token picks up changes
+	roles, err := loadUserRoles(user.ID)
+	if err != nil {
+		return "", err
+	}
+	venueID, err := loadUserVenue(user.ID)
+	if err != nil {
+		return "", err
+	}
+	user.Roles = roles
+	user.IsAdmin = hasRole(roles, ROLE_ADMIN)
+	user.IsGuest = hasRole(roles, ROLE_GUEST)
+	user.VenueID = venueID
+
+	// A unique ID per token lets apps log or deny a single token
+	tokenID, err := randomToken(12)
+	if err != nil {
+		return "", err
+	}
 
-// generateToken creates a JWT token for a user
-func generateToken(user *User) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
+		"typ":      auth.TokenTypeAccess,
+		"jti":      tokenID,
 		"user_id":  user.ID,
 		"email":    user.Email,
 		"name":     user.Name,
 		"is_admin": user.IsAdmin,
-		"exp":      time.Now().Add(24 * time.Hour).Unix(),
+		"is_guest": user.IsGuest,
+		"roles":    roles,
+		"venue_id": venueID,
+		"sid":      sessionID,
+		"iat":      now.Unix(),
+		"exp":      now.Add(ACCESS_TOKEN_TTL).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(JWT_SECRET))
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.privateKey)
 }
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"pubgames/shared/httpkit"
+)
+
+// SigningKey is an Ed25519 key used to sign JWTs, identified by its kid
+type SigningKey struct {
+	KID       string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+
+	privateKey ed25519.PrivateKey
+}
+
+// JWK is the public half of a signing key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// KeyStore keeps signing keys on disk: one PKCS#8 PEM file per key plus
+// a keys.json manifest recording when each key was created and retired
+type KeyStore struct {
+	dir  string
+	mu   sync.RWMutex
+	keys []*SigningKey // oldest first; the last entry is the active key
+}
+
+var keyStore *KeyStore
+
+// initKeys loads signing keys from disk, creating the first key if needed
+func initKeys() {
+	var err error
+	keyStore, err = loadKeyStore(keysDir())
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	if keyStore.Active() == nil {
+		log.Println("   Generating initial signing key...")
+		if _, err := keyStore.Rotate(); err != nil {
+			log.Fatalf("Failed to generate signing key: %v", err)
+		}
+	}
+
+	log.Printf("🔑 Active signing key: %s", keyStore.Active().KID)
+}
+
+// loadKeyStore reads the manifest and private keys from dir
+func loadKeyStore(dir string) (*KeyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create keys directory: %w", err)
+	}
+
+	ks := &KeyStore{dir: dir}
+
+	data, err := os.ReadFile(ks.manifestPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read key manifest: %w", err)
+	}
+
+	var keys []*SigningKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("could not parse key manifest: %w", err)
+	}
+
+	for _, key := range keys {
+		privateKey, err := readPrivateKey(ks.keyPath(key.KID))
+		if err != nil {
+			log.Printf("Warning: Skipping signing key %s: %v", key.KID, err)
+			continue
+		}
+		key.privateKey = privateKey
+		ks.keys = append(ks.keys, key)
+	}
+
+	ks.prune()
+	return ks, nil
+}
+
+// Active returns the key new tokens are signed with
+func (ks *KeyStore) Active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if len(ks.keys) == 0 {
+		return nil
+	}
+	active := ks.keys[len(ks.keys)-1]
+	if active.RetiredAt != nil {
+		return nil
+	}
+	return active
+}
+
+// Lookup returns a key that may still verify tokens: the active key or a
+// retired key whose tokens have not yet expired
+func (ks *KeyStore) Lookup(kid string) (*SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.KID == kid && key.usable(time.Now()) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns metadata for all keys still on disk
+func (ks *KeyStore) Keys() []SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]SigningKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, SigningKey{
+			KID:       key.KID,
+			Algorithm: key.Algorithm,
+			CreatedAt: key.CreatedAt,
+			RetiredAt: key.RetiredAt,
+		})
+	}
+	return keys
+}
+
+// Rotate generates a new active key and retires the current one. Retired
+// keys keep verifying tokens until the longest-lived token could expire.
+func (ks *KeyStore) Rotate() (*SigningKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	key := &SigningKey{
+		KID:        now.Format("20060102") + "-" + hex.EncodeToString(suffix),
+		Algorithm:  "EdDSA",
+		CreatedAt:  now,
+		privateKey: privateKey,
+	}
+
+	if err := writePrivateKey(ks.keyPath(key.KID), privateKey); err != nil {
+		return nil, err
+	}
+
+	ks.mu.Lock()
+	for _, existing := range ks.keys {
+		if existing.RetiredAt == nil {
+			retiredAt := now
+			existing.RetiredAt = &retiredAt
+		}
+	}
+	ks.keys = append(ks.keys, key)
+	err = ks.saveManifestLocked()
+	ks.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ks.prune()
+	log.Printf("🔑 Rotated signing key: new kid %s", key.KID)
+	return key, nil
+}
+
+// JWKS returns the public keys that can currently verify tokens
+func (ks *KeyStore) JWKS() []JWK {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	jwks := []JWK{}
+	for _, key := range ks.keys {
+		if !key.usable(now) {
+			continue
+		}
+		publicKey := key.privateKey.Public().(ed25519.PublicKey)
+		jwks = append(jwks, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(publicKey),
+			Kid: key.KID,
+			Alg: key.Algorithm,
+			Use: "sig",
+		})
+	}
+	return jwks
+}
+
+// prune deletes retired keys whose tokens can no longer be valid
+func (ks *KeyStore) prune() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	kept := ks.keys[:0]
+	removed := false
+	for _, key := range ks.keys {
+		if key.usable(now) {
+			kept = append(kept, key)
+			continue
+		}
+		if err := os.Remove(ks.keyPath(key.KID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: Could not remove expired signing key %s: %v", key.KID, err)
+		}
+		log.Printf("🗑️  Removed expired signing key %s", key.KID)
+		removed = true
+	}
+	ks.keys = kept
+
+	if removed {
+		if err := ks.saveManifestLocked(); err != nil {
+			log.Printf("Warning: Could not save key manifest: %v", err)
+		}
+	}
+}
+
+// usable reports whether the key can still verify tokens at now
+func (k *SigningKey) usable(now time.Time) bool {
+	return k.RetiredAt == nil || now.Before(k.RetiredAt.Add(ACCESS_TOKEN_TTL))
+}
+
+func (ks *KeyStore) manifestPath() string {
+	return filepath.Join(ks.dir, "keys.json")
+}
+
+func (ks *KeyStore) keyPath(kid string) string {
+	return filepath.Join(ks.dir, kid+".pem")
+}
+
+// saveManifestLocked writes keys.json. Caller must hold ks.mu.
+func (ks *KeyStore) saveManifestLocked() error {
+	data, err := json.MarshalIndent(ks.keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal key manifest: %w", err)
+	}
+	if err := os.WriteFile(ks.manifestPath(), data, 0600); err != nil {
+		return fmt.Errorf("could not write key manifest: %w", err)
+	}
+	return nil
+}
+
+func readPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	return privateKey, nil
+}
+
+func writePrivateKey(path string, privateKey ed25519.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return os.WriteFile(path, data, 0600)
+}
+
+// jwksHandler publishes the public signing keys (public endpoint)
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": keyStore.JWKS(),
+	})
+}
+
+// getKeysHandler lists signing key metadata (admin only)
+func getKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keyStore.Keys())
+}
+
+// rotateKeyHandler generates a new signing key (admin only)
+func rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := keyStore.Rotate()
+	if err != nil {
+		log.Printf("Key rotation failed: %v", err)
+		httpkit.SendError(w, "Failed to rotate signing key", 500)
+		return
+	}
+
+	recordAudit(r, "key.rotate", "signing_key", 0, map[string]interface{}{"kid": key.KID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kid":        key.KID,
+		"alg":        key.Algorithm,
+		"created_at": key.CreatedAt,
+		"message":    "Signing key rotated",
+	})
+}
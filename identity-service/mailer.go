@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outgoing email (one-time login codes) goes through a Mailer chosen at
+// startup from the service config:
+//
+//	mail_driver smtp  smtp_host, smtp_port (587), smtp_username, smtp_password
+//	mail_driver file  mail_file (./data/mail.log) - appends each message
+//	mail_driver log   writes each message to the service log
+//
+// mail_from sets the sender. Without mail_driver, smtp is used when
+// smtp_host is set and log otherwise, so codes show up in the console
+// during local development.
+
+const (
+	DEFAULT_MAIL_FROM = "PubGames <no-reply@pubgames.local>"
+	DEFAULT_MAIL_FILE = "./data/mail.log"
+	DEFAULT_SMTP_PORT = "587"
+)
+
+// Mail is a plain-text email
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email
+type Mailer interface {
+	Send(msg Mail) error
+}
+
+var mailer Mailer
+
+// initMailer picks the mailer from the service config
+func initMailer() {
+	cfg := serviceConfig
+
+	driver := cfg.MailDriver
+	if driver == "" {
+		driver = "log"
+		if cfg.SMTPHost != "" {
+			driver = "smtp"
+		}
+	}
+
+	switch driver {
+	case "smtp":
+		mailer = &smtpMailer{
+			host:     cfg.SMTPHost,
+			port:     cfg.SMTPPort,
+			username: cfg.SMTPUsername,
+			password: cfg.SMTPPassword,
+			from:     cfg.MailFrom,
+		}
+		log.Printf("📧 Mail: SMTP via %s:%s", cfg.SMTPHost, cfg.SMTPPort)
+	case "file":
+		mailer = &fileMailer{path: cfg.MailFile, from: cfg.MailFrom}
+		log.Printf("📧 Mail: writing to %s", cfg.MailFile)
+	default:
+		mailer = &logMailer{from: cfg.MailFrom}
+		log.Println("📧 Mail: writing to the log (set smtp_host to send real email)")
+	}
+}
+
+// formatMail renders a message with the headers every mailer writes
+func formatMail(from string, msg Mail) (string, error) {
+	// Refuse anything that could smuggle in extra headers
+	for _, v := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return "", fmt.Errorf("invalid mail header value %q", v)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.String(), nil
+}
+
+// smtpMailer sends through an SMTP server, using STARTTLS when the server
+// offers it and PLAIN auth when a username is set
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func (m *smtpMailer) Send(msg Mail) error {
+	data, err := formatMail(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	sender := m.from
+	if i := strings.LastIndex(sender, "<"); i >= 0 {
+		sender = strings.TrimSuffix(sender[i+1:], ">")
+	}
+
+	return smtp.SendMail(net.JoinHostPort(m.host, m.port), auth, sender, []string{msg.To}, []byte(data))
+}
+
+// fileMailer appends each message to a file, for local testing without a
+// mail server
+type fileMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func (m *fileMailer) Send(msg Mail) error {
+	data, err := formatMail(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\r\n\r\n", data)
+	return err
+}
+
+// logMailer writes each message to the service log
+type logMailer struct {
+	from string
+}
+
+func (m *logMailer) Send(msg Mail) error {
+	if _, err := formatMail(m.from, msg); err != nil {
+		return err
+	}
+	log.Printf("📧 Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -12,52 +15,162 @@ import (
 
 var db *sql.DB
 
+// corsConfig holds the shared CORS rules, kept up to date with the file
+var corsConfig *config.CORSWatcher
+
+// serviceConfig holds the ports and paths this instance runs with
+var serviceConfig *config.ServiceConfig
+
 const (
-	BACKEND_PORT  = "3001"
-	FRONTEND_PORT = "30000"
-	DB_PATH       = "./data/identity.db"
-	JWT_SECRET    = "your-secret-key-change-in-production" // TODO: Use environment variable
+	// Access tokens are short-lived; refresh tokens keep a device logged in
+	ACCESS_TOKEN_TTL  = 1 * time.Hour
+	REFRESH_TOKEN_TTL = 30 * 24 * time.Hour
 )
 
 func main() {
 	log.Println("🚀 Starting PubGames Identity Service...")
 
+	// Settings: these defaults, then a config file, environment and flags
+	var err error
+	serviceConfig, err = config.LoadServiceConfig(config.ServiceConfig{
+		Name:         "identity",
+		Port:         "3001",
+		FrontendPort: "30000",
+		DBPath:       "./data/identity.db",
+		Issuer:       "http://localhost:3001",
+		WebhookHosts: []string{"localhost"},
+		AppHost:      "localhost",
+		MailFrom:     DEFAULT_MAIL_FROM,
+		MailFile:     DEFAULT_MAIL_FILE,
+		SMTPPort:     DEFAULT_SMTP_PORT,
+	}, os.Args[1:])
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	// The issuer must come from config, never from the request's Host
+	if serviceConfig.Issuer == "" {
+		log.Fatalf("❌ oidc_issuer is required")
+	}
+
 	// Initialize database
 	initDB()
 	defer db.Close()
 
+	// Load (or create) token signing keys
+	initKeys()
+
+	// Pick how one-time login codes are emailed
+	initMailer()
+
+	// Check app health in the background so the launcher can flag apps that are down
+	startHealthProber()
+
+	// Deliver identity events to app webhooks, retrying failures
+	startWebhookWorker()
+
 	// Setup router
 	r := mux.NewRouter()
 
 	// Serve static files (shared CSS)
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 
+	// Public signing keys for apps verifying tokens locally
+	r.HandleFunc("/.well-known/jwks.json", jwksHandler).Methods("GET")
+
+	// OpenID Connect provider (authorization-code flow with PKCE)
+	r.HandleFunc("/.well-known/openid-configuration", openIDConfigurationHandler).Methods("GET")
+	r.HandleFunc("/oauth/authorize", authorizeHandler).Methods("GET")
+	r.HandleFunc("/oauth/token", tokenHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/oauth/userinfo", authMiddleware(userInfoHandler)).Methods("GET", "POST")
+
 	// API routes
 	api := r.PathPrefix("/api").Subrouter()
 
 	// Public routes
 	api.HandleFunc("/register", registerHandler).Methods("POST", "OPTIONS")
 	api.HandleFunc("/login", loginHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/login/email", requestEmailCodeHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/login/email/verify", emailCodeLoginHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/guest", createGuestHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/token/refresh", refreshTokenHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/revoked-sessions", getRevokedSessionsHandler).Methods("GET")
+	api.HandleFunc("/passkey/login/begin", passkeyBeginLoginHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/passkey/login/finish", passkeyFinishLoginHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/pairing/exchange", exchangePairingHandler).Methods("POST", "OPTIONS")
+	api.HandleFunc("/pairing/{token}/qr.{format:png|svg}", pairingQRHandler).Methods("GET")
 	api.HandleFunc("/apps", getAppsHandler).Methods("GET")
+	api.HandleFunc("/venues", getVenuesHandler).Methods("GET")
+	api.HandleFunc("/users/{id:[0-9]+}/avatar.svg", avatarHandler).Methods("GET")
 	api.HandleFunc("/server-info", getServerInfoHandler).Methods("GET")
+	api.HandleFunc("/config", getConfigHandler).Methods("GET")
 
 	// Protected routes
 	api.HandleFunc("/validate-token", validateTokenHandler).Methods("GET")
 	api.HandleFunc("/user", authMiddleware(getUserHandler)).Methods("GET")
+	api.HandleFunc("/user", authMiddleware(noGuestsMiddleware(updateProfileHandler))).Methods("PUT")
+	api.HandleFunc("/user/code", authMiddleware(noGuestsMiddleware(changeCodeHandler))).Methods("PUT")
+	api.HandleFunc("/user/emails", authMiddleware(getUserEmailsHandler)).Methods("GET")
+	api.HandleFunc("/guest/upgrade", authMiddleware(upgradeGuestHandler)).Methods("POST")
+	api.HandleFunc("/logout", authMiddleware(logoutHandler)).Methods("POST")
+	api.HandleFunc("/sessions", authMiddleware(getSessionsHandler)).Methods("GET")
+	api.HandleFunc("/sessions/{id}", authMiddleware(revokeSessionHandler)).Methods("DELETE")
+	api.HandleFunc("/passkey/register/begin", authMiddleware(noGuestsMiddleware(passkeyBeginRegistrationHandler))).Methods("POST")
+	api.HandleFunc("/passkey/register/finish", authMiddleware(noGuestsMiddleware(passkeyFinishRegistrationHandler))).Methods("POST")
+	api.HandleFunc("/passkey", authMiddleware(deletePasskeyHandler)).Methods("DELETE")
+	api.HandleFunc("/pairing", authMiddleware(createPairingHandler)).Methods("POST")
+	api.HandleFunc("/oauth/authorize", authMiddleware(approveAuthorizeHandler)).Methods("POST")
+	api.HandleFunc("/apps/{id:[0-9]+}/launch", authMiddleware(launchAppHandler)).Methods("POST")
+
+	// Service routes (signed with an app's client credentials)
+	api.HandleFunc("/service/apps", serviceMiddleware(registerServiceAppHandler)).Methods("PUT")
+	api.HandleFunc("/users/lookup", serviceMiddleware(lookupUsersHandler)).Methods("POST")
 
 	// Admin routes
 	api.HandleFunc("/admin/apps", authMiddleware(adminMiddleware(getAdminAppsHandler))).Methods("GET")
 	api.HandleFunc("/admin/apps", authMiddleware(adminMiddleware(createAppHandler))).Methods("POST")
+	api.HandleFunc("/admin/apps/order", authMiddleware(adminMiddleware(reorderAppsHandler))).Methods("PUT")
+	api.HandleFunc("/admin/apps/{id:[0-9]+}", authMiddleware(adminMiddleware(updateAppHandler))).Methods("PUT")
+	api.HandleFunc("/admin/apps/{id:[0-9]+}", authMiddleware(adminMiddleware(deleteAppHandler))).Methods("DELETE")
+	api.HandleFunc("/admin/apps/{id:[0-9]+}/probe", authMiddleware(adminMiddleware(probeAppHandler))).Methods("POST")
+	api.HandleFunc("/admin/clients", authMiddleware(adminMiddleware(getServiceClientsHandler))).Methods("GET")
+	api.HandleFunc("/admin/clients", authMiddleware(adminMiddleware(createServiceClientHandler))).Methods("POST")
+	api.HandleFunc("/admin/clients/{id}", authMiddleware(adminMiddleware(revokeServiceClientHandler))).Methods("DELETE")
+	api.HandleFunc("/admin/webhooks", authMiddleware(adminMiddleware(getWebhookDeliveriesHandler))).Methods("GET")
+	api.HandleFunc("/admin/webhooks/{id:[0-9]+}/retry", authMiddleware(adminMiddleware(retryWebhookDeliveryHandler))).Methods("POST")
+	api.HandleFunc("/admin/venues", authMiddleware(adminMiddleware(createVenueHandler))).Methods("POST")
+	api.HandleFunc("/admin/venues/{id:[0-9]+}", authMiddleware(adminMiddleware(updateVenueHandler))).Methods("PUT")
 	api.HandleFunc("/admin/users", authMiddleware(adminMiddleware(getUsersHandler))).Methods("GET")
+	api.HandleFunc("/admin/users/{id}", authMiddleware(adminMiddleware(updateUserHandler))).Methods("PUT")
+	api.HandleFunc("/admin/users/{id}", authMiddleware(adminMiddleware(deleteUserHandler))).Methods("DELETE")
+	api.HandleFunc("/admin/users/{id}/disable", authMiddleware(adminMiddleware(disableUserHandler))).Methods("POST")
+	api.HandleFunc("/admin/users/{id}/enable", authMiddleware(adminMiddleware(enableUserHandler))).Methods("POST")
+	api.HandleFunc("/admin/users/{id}/reset-code", authMiddleware(adminMiddleware(resetCodeHandler))).Methods("POST")
+	api.HandleFunc("/admin/users/{id}/merge", authMiddleware(adminMiddleware(mergeUserHandler))).Methods("POST")
+	api.HandleFunc("/admin/roles", authMiddleware(adminMiddleware(getRolesHandler))).Methods("GET")
+	api.HandleFunc("/admin/users/{id}/roles", authMiddleware(adminMiddleware(getUserRolesHandler))).Methods("GET")
+	api.HandleFunc("/admin/users/{id}/roles", authMiddleware(adminMiddleware(grantRoleHandler))).Methods("POST")
+	api.HandleFunc("/admin/users/{id}/roles/{role}", authMiddleware(adminMiddleware(revokeRoleHandler))).Methods("DELETE")
+	api.HandleFunc("/admin/keys", authMiddleware(adminMiddleware(getKeysHandler))).Methods("GET")
+	api.HandleFunc("/admin/keys/rotate", authMiddleware(adminMiddleware(rotateKeyHandler))).Methods("POST")
+	api.HandleFunc("/admin/lockouts", authMiddleware(adminMiddleware(getLockoutsHandler))).Methods("GET")
+	api.HandleFunc("/admin/lockouts/{id}", authMiddleware(adminMiddleware(clearLockoutHandler))).Methods("DELETE")
+	api.HandleFunc("/admin/cors", authMiddleware(adminMiddleware(getCORSConfigHandler))).Methods("GET")
+	api.HandleFunc("/admin/cors", authMiddleware(adminMiddleware(updateCORSConfigHandler))).Methods("PUT")
+	api.HandleFunc("/admin/cors/test", authMiddleware(adminMiddleware(testCORSOriginHandler))).Methods("GET")
+	api.HandleFunc("/admin/audit", authMiddleware(adminMiddleware(getAuditLogHandler))).Methods("GET")
+	api.HandleFunc("/admin/analytics/active-users", authMiddleware(adminMiddleware(getActiveUsersHandler))).Methods("GET")
+	api.HandleFunc("/admin/analytics/users", authMiddleware(adminMiddleware(getUserActivityHandler))).Methods("GET")
+	api.HandleFunc("/admin/analytics/top-apps", authMiddleware(adminMiddleware(getTopAppsHandler))).Methods("GET")
 
-	// Load CORS configuration from shared config
-	corsConfig, err := config.LoadCORSConfig()
-	if err != nil {
-		log.Printf("Warning: CORS config load error: %v", err)
-	}
-	log.Printf("📋 CORS Mode: %s", corsConfig.CORS.Mode)
+	// Load CORS configuration from shared config, reloading it when the
+	// file changes (e.g. after PUT /api/admin/cors)
+	corsConfig = config.WatchCORSConfig()
+	log.Printf("📋 CORS Mode: %s", corsConfig.Current().CORS.Mode)
 	log.Printf("📋 Allowed Origins: %v", corsConfig.GetAllowedOrigins())
 
+	// The configured pub becomes the default venue
+	ensureDefaultVenue(corsConfig.Current().PubID, corsConfig.Current().PubName)
+
 	// CORS configuration using shared config
 	corsHandler := handlers.CORS(
 		handlers.AllowedOriginValidator(func(origin string) bool {
@@ -72,7 +185,12 @@ func main() {
 		handlers.AllowCredentials(),
 	)
 
-	log.Printf("✅ Identity Service backend running on :%s", BACKEND_PORT)
-	log.Printf("   Frontend should be at :%s", FRONTEND_PORT)
-	log.Fatal(http.ListenAndServe(":"+BACKEND_PORT, corsHandler(r)))
+	log.Printf("✅ Identity Service backend running on :%s", serviceConfig.Port)
+	log.Printf("   Frontend should be at :%s", serviceConfig.FrontendPort)
+	log.Fatal(http.ListenAndServe(":"+serviceConfig.Port, corsHandler(r)))
+}
+
+// keysDir is where token signing keys are kept, next to the database
+func keysDir() string {
+	return filepath.Join(filepath.Dir(serviceConfig.DBPath), "keys")
 }
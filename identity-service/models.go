@@ -1,25 +1,76 @@
 package main
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // User represents a user in the system
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	IsAdmin   bool      `json:"is_admin"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	Name       string     `json:"name"`
+	IsAdmin    bool       `json:"is_admin"`
+	IsGuest    bool       `json:"is_guest,omitempty"`
+	VenueID    int        `json:"venue_id"`
+	Roles      []string   `json:"roles,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	SessionID  string     `json:"session_id,omitempty"`
 }
 
 // App represents an application in the ecosystem
 type App struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	URL         string    `json:"url"`
-	Description string    `json:"description"`
-	Icon        string    `json:"icon"`
-	IsActive    bool      `json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	URL         string     `json:"url"`
+	APIURL      string     `json:"api_url,omitempty"`
+	Description string     `json:"description"`
+	Icon        string     `json:"icon"`
+	IsActive    bool       `json:"is_active"`
+	SortOrder   int        `json:"sort_order"`
+	VenueID     *int       `json:"venue_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Health      *AppHealth `json:"health,omitempty"`
+
+	// RedirectURIs are where the OAuth authorize endpoint may send codes
+	// for this app; when empty the app's url is allowed
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+
+	// WebhookURL receives identity events for this app (see webhooks.go)
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// AppHealth is the latest probe result for an app
+type AppHealth struct {
+	Status    string    `json:"status"`
+	LatencyMS int       `json:"latency_ms"`
+	Version   string    `json:"version,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// UpdateAppRequest changes an app's registry entry; omitted fields are
+// left unchanged
+type UpdateAppRequest struct {
+	Name        *string `json:"name"`
+	URL         *string `json:"url"`
+	APIURL      *string `json:"api_url"`
+	Description *string `json:"description"`
+	Icon        *string `json:"icon"`
+	IsActive    *bool   `json:"is_active"`
+	SortOrder   *int    `json:"sort_order"`
+
+	// VenueID limits the app to one venue; 0 offers it everywhere
+	VenueID *int `json:"venue_id"`
+
+	RedirectURIs *[]string `json:"redirect_uris"`
+	WebhookURL   *string   `json:"webhook_url"`
+}
+
+// ReorderAppsRequest lists app IDs in their new display order
+type ReorderAppsRequest struct {
+	IDs []int `json:"ids"`
 }
 
 // RegisterRequest represents a registration request
@@ -27,7 +78,7 @@ type RegisterRequest struct {
 	Email   string `json:"email"`
 	Name    string `json:"name"`
 	Code    string `json:"code"`
-	IsAdmin bool   `json:"is_admin"`
+	VenueID int    `json:"venue_id"`
 }
 
 // LoginRequest represents a login request
@@ -38,13 +89,77 @@ type LoginRequest struct {
 
 // LoginResponse represents a login response
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         User   `json:"user"`
+}
+
+// RefreshRequest represents a token refresh request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Session represents a logged-in device
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// PasskeyLoginRequest starts a passkey login; Email is optional
+type PasskeyLoginRequest struct {
+	Email string `json:"email"`
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Details string `json:"details,omitempty"`
+// PasskeyFinishRequest completes a passkey ceremony with the browser's
+// PublicKeyCredential response
+type PasskeyFinishRequest struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// UpdateProfileRequest changes the current user's details; empty fields
+// are left unchanged. Code is required when changing email.
+type UpdateProfileRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+// ChangeCodeRequest changes the current user's login code
+type ChangeCodeRequest struct {
+	CurrentCode string `json:"current_code"`
+	NewCode     string `json:"new_code"`
+}
+
+// AdminUpdateUserRequest changes a user's details; empty fields are left
+// unchanged
+type AdminUpdateUserRequest struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	VenueID int    `json:"venue_id"`
+}
+
+// MergeUsersRequest names the duplicate account to fold into another
+type MergeUsersRequest struct {
+	SourceID int `json:"source_id"`
+}
+
+// PairingResponse holds a new pairing token and where to get its QR code
+type PairingResponse struct {
+	Token     string `json:"token"`
+	PairURL   string `json:"pair_url"`
+	QRPNG     string `json:"qr_png"`
+	QRSVG     string `json:"qr_svg"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// PairingExchangeRequest trades a scanned pairing token for a session
+type PairingExchangeRequest struct {
+	Token string `json:"token"`
 }
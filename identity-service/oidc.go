@@ -0,0 +1,473 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// A minimal OpenID Connect provider so app frontends can sign users in
+// with the authorization-code flow instead of receiving tokens in URLs.
+//
+// Every app in the apps table is a public client whose client_id is its
+// app ID. PKCE (S256) is required. Because the user's session lives in
+// the launcher frontend rather than a cookie, /oauth/authorize validates
+// the request and hands it to the frontend, which asks the user to log
+// in if needed and then calls /api/oauth/authorize to get the code.
+
+const (
+	OAUTH_CODE_TTL = 2 * time.Minute
+)
+
+// authorizeRequest is an OAuth authorization request, from the query
+// string or the frontend's JSON
+type authorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// oauthError is an error in the format OAuth clients expect
+type oauthError struct {
+	Code        string
+	Description string
+}
+
+// openIDConfigurationHandler serves the discovery document
+func openIDConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := serviceConfig.Issuer
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"EdDSA"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+		"token_endpoint_auth_methods_supported": []string{"none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "email", "name", "roles", "venue_id", "nonce"},
+	})
+}
+
+// authorizeHandler checks an authorization request and sends the browser
+// to the launcher frontend to finish it. Errors with the client or
+// redirect URI are shown here; anything else goes back to the client.
+func authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := authorizeRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+
+	if _, ok := validateClient(w, req); !ok {
+		return
+	}
+	if oerr := validateAuthorizeRequest(req); oerr != nil {
+		http.Redirect(w, r, authorizeRedirect(req, oerr, ""), http.StatusFound)
+		return
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	frontend := url.URL{
+		Scheme:   "http",
+		Host:     net.JoinHostPort(host, serviceConfig.FrontendPort),
+		Path:     "/",
+		RawQuery: url.Values{"oauth": {r.URL.RawQuery}}.Encode(),
+	}
+	http.Redirect(w, r, frontend.String(), http.StatusFound)
+}
+
+// approveAuthorizeHandler issues an authorization code for the logged-in
+// user and returns where the frontend should send the browser
+func approveAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(*User)
+
+	// The frontend passes on the client's query string as is, and unknown
+	// OAuth parameters must be ignored
+	var req authorizeRequest
+	if err := httpkit.DecodeLenient(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	app, ok := validateClient(w, req)
+	if !ok {
+		return
+	}
+
+	respond := func(redirectTo string) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"redirect_to": redirectTo,
+			"app_name":    app.Name,
+		})
+	}
+
+	if oerr := validateAuthorizeRequest(req); oerr != nil {
+		respond(authorizeRedirect(req, oerr, ""))
+		return
+	}
+	if isUserDisabled(user.ID) {
+		respond(authorizeRedirect(req, &oauthError{"access_denied", "account disabled"}, ""))
+		return
+	}
+
+	code, err := randomToken(32)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create authorization code", 500)
+		return
+	}
+
+	// Codes only live for minutes; clear out old ones as new ones are made
+	db.Exec("DELETE FROM oauth_codes WHERE expires_at < ?", time.Now().UTC().Add(-time.Hour))
+
+	_, err = db.Exec(`
+		INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, hashToken(code), req.ClientID, user.ID, req.RedirectURI, req.Scope, req.Nonce,
+		req.CodeChallenge, time.Now().UTC().Add(OAUTH_CODE_TTL))
+	if err != nil {
+		httpkit.SendError(w, "Failed to create authorization code", 500)
+		return
+	}
+
+	log.Printf("🎫 User %d authorized %s", user.ID, app.Name)
+	respond(authorizeRedirect(req, nil, code))
+}
+
+// tokenHandler exchanges an authorization code or refresh token for
+// tokens. Requests are form-encoded as OAuth requires.
+func tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		sendOAuthError(w, &oauthError{"invalid_request", "malformed form body"}, 400)
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		exchangeAuthorizationCode(w, r)
+	case "refresh_token":
+		exchangeRefreshToken(w, r)
+	default:
+		sendOAuthError(w, &oauthError{"unsupported_grant_type", ""}, 400)
+	}
+}
+
+func exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request) {
+	form := r.PostForm
+	code := form.Get("code")
+	clientID := form.Get("client_id")
+	verifier := form.Get("code_verifier")
+	if code == "" || clientID == "" || verifier == "" {
+		sendOAuthError(w, &oauthError{"invalid_request", "code, client_id and code_verifier are required"}, 400)
+		return
+	}
+	if !activeClient(clientID) {
+		sendOAuthError(w, &oauthError{"invalid_client", "unknown client_id"}, 401)
+		return
+	}
+
+	var userID int
+	var storedClient, redirectURI, challenge string
+	var scope, nonce sql.NullString
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at, used_at
+		FROM oauth_codes WHERE code_hash = ?
+	`, hashToken(code)).Scan(&storedClient, &userID, &redirectURI, &scope, &nonce, &challenge, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		sendOAuthError(w, &oauthError{"invalid_grant", "unknown authorization code"}, 400)
+		return
+	} else if err != nil {
+		sendOAuthError(w, &oauthError{"server_error", ""}, 500)
+		return
+	}
+
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		sendOAuthError(w, &oauthError{"invalid_grant", "authorization code expired or already used"}, 400)
+		return
+	}
+	if storedClient != clientID || redirectURI != form.Get("redirect_uri") {
+		sendOAuthError(w, &oauthError{"invalid_grant", "client_id or redirect_uri does not match"}, 400)
+		return
+	}
+	if !verifyPKCE(verifier, challenge) {
+		sendOAuthError(w, &oauthError{"invalid_grant", "code_verifier does not match"}, 400)
+		return
+	}
+
+	// Codes are single use; a concurrent exchange loses here
+	result, err := db.Exec("UPDATE oauth_codes SET used_at = ? WHERE code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), hashToken(code))
+	if err != nil {
+		sendOAuthError(w, &oauthError{"server_error", ""}, 500)
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		sendOAuthError(w, &oauthError{"invalid_grant", "authorization code already used"}, 400)
+		return
+	}
+
+	user, err := loadUser(userID)
+	if err != nil || user.DisabledAt != nil {
+		sendOAuthError(w, &oauthError{"invalid_grant", "account not available"}, 400)
+		return
+	}
+
+	// Each app gets its own session so it can be signed out separately
+	sessionID, refreshToken, err := createSession(user.ID, clientID, r)
+	if err != nil {
+		sendOAuthError(w, &oauthError{"server_error", ""}, 500)
+		return
+	}
+
+	sendTokens(w, r, user, sessionID, refreshToken, clientID, nonce.String, scope.String)
+}
+
+// exchangeRefreshToken rotates a refresh token. Clients are public, so the
+// client is authenticated by its refresh token: it must be the one the
+// session was issued to.
+func exchangeRefreshToken(w http.ResponseWriter, r *http.Request) {
+	clientID := r.PostForm.Get("client_id")
+	if clientID == "" || r.PostForm.Get("refresh_token") == "" {
+		sendOAuthError(w, &oauthError{"invalid_request", "refresh_token and client_id are required"}, 400)
+		return
+	}
+	if !activeClient(clientID) {
+		sendOAuthError(w, &oauthError{"invalid_client", "unknown client_id"}, 401)
+		return
+	}
+
+	user, sessionID, refreshToken, err := refreshSession(r.PostForm.Get("refresh_token"), clientID, r)
+	switch err {
+	case nil:
+	case errInvalidRefreshToken, errSessionEnded, errWrongClient:
+		sendOAuthError(w, &oauthError{"invalid_grant", err.Error()}, 400)
+		return
+	default:
+		log.Printf("Failed to refresh session: %v", err)
+		sendOAuthError(w, &oauthError{"server_error", ""}, 500)
+		return
+	}
+
+	sendTokens(w, r, user, sessionID, refreshToken, clientID, "", r.PostForm.Get("scope"))
+}
+
+// sendTokens writes a token response. An ID token is included when the
+// client is known.
+func sendTokens(w http.ResponseWriter, r *http.Request, user *User, sessionID, refreshToken, clientID, nonce, scope string) {
+	accessToken, err := generateToken(user, sessionID)
+	if err != nil {
+		sendOAuthError(w, &oauthError{"server_error", ""}, 500)
+		return
+	}
+
+	response := map[string]interface{}{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(ACCESS_TOKEN_TTL.Seconds()),
+		"refresh_token": refreshToken,
+	}
+	if scope != "" {
+		response["scope"] = scope
+	}
+	if clientID != "" {
+		idToken, err := generateIDToken(user, clientID, nonce, sessionID)
+		if err != nil {
+			sendOAuthError(w, &oauthError{"server_error", ""}, 500)
+			return
+		}
+		response["id_token"] = idToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// userInfoHandler returns claims about the token's user
+func userInfoHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+
+	user, err := loadUser(current.ID)
+	if err != nil {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+	roles, _ := loadUserRoles(user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sub":      strconv.Itoa(user.ID),
+		"email":    user.Email,
+		"name":     user.Name,
+		"roles":    roles,
+		"is_admin": hasRole(roles, ROLE_ADMIN),
+		"venue_id": user.VenueID,
+	})
+}
+
+// generateIDToken creates an OpenID Connect ID token for a client
+func generateIDToken(user *User, clientID, nonce, sessionID string) (string, error) {
+	key := keyStore.Active()
+	if key == nil {
+		return "", jwt.ErrInvalidKey
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"typ":      auth.TokenTypeID,
+		"iss":      serviceConfig.Issuer,
+		"sub":      strconv.Itoa(user.ID),
+		"aud":      clientID,
+		"email":    user.Email,
+		"name":     user.Name,
+		"venue_id": user.VenueID,
+		"sid":      sessionID,
+		"iat":      now.Unix(),
+		"exp":      now.Add(ACCESS_TOKEN_TTL).Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.privateKey)
+}
+
+// validateClient looks up the client and checks the redirect URI against
+// the app's registered ones. These errors can't safely be redirected, so
+// they are written as a 400.
+func validateClient(w http.ResponseWriter, req authorizeRequest) (*App, bool) {
+	appID, err := strconv.Atoi(req.ClientID)
+	if err != nil {
+		httpkit.SendError(w, "Unknown client_id", 400)
+		return nil, false
+	}
+	app, err := loadApp(appID)
+	if err != nil || !app.IsActive {
+		httpkit.SendError(w, "Unknown client_id", 400)
+		return nil, false
+	}
+
+	if !redirectURIAllowed(app, req.RedirectURI) {
+		httpkit.SendError(w, "redirect_uri is not registered for this client", 400)
+		return nil, false
+	}
+	return app, true
+}
+
+// activeClient reports whether clientID is an active app
+func activeClient(clientID string) bool {
+	appID, err := strconv.Atoi(clientID)
+	if err != nil {
+		return false
+	}
+	app, err := loadApp(appID)
+	return err == nil && app.IsActive
+}
+
+// validateAuthorizeRequest checks the parts of a request whose errors are
+// reported back to the client
+func validateAuthorizeRequest(req authorizeRequest) *oauthError {
+	if req.ResponseType != "code" {
+		return &oauthError{"unsupported_response_type", "only response_type=code is supported"}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return &oauthError{"invalid_request", "PKCE with code_challenge_method=S256 is required"}
+	}
+	return nil
+}
+
+// redirectURIAllowed matches redirect URIs exactly. Apps that haven't
+// registered any may use their launcher URL.
+func redirectURIAllowed(app *App, redirectURI string) bool {
+	allowed := app.RedirectURIs
+	if len(allowed) == 0 {
+		base := strings.TrimRight(app.URL, "/")
+		allowed = []string{base, base + "/"}
+	}
+	for _, uri := range allowed {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeRedirect builds the client redirect carrying either a code or
+// an error, plus the client's state
+func authorizeRedirect(req authorizeRequest, oerr *oauthError, code string) string {
+	params := url.Values{}
+	if oerr != nil {
+		params.Set("error", oerr.Code)
+		if oerr.Description != "" {
+			params.Set("error_description", oerr.Description)
+		}
+	} else {
+		params.Set("code", code)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	separator := "?"
+	if strings.Contains(req.RedirectURI, "?") {
+		separator = "&"
+	}
+	return req.RedirectURI + separator + params.Encode()
+}
+
+// verifyPKCE checks a code_verifier against an S256 code_challenge
+func verifyPKCE(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func sendOAuthError(w http.ResponseWriter, oerr *oauthError, code int) {
+	body := map[string]string{"error": oerr.Code}
+	if oerr.Description != "" {
+		body["error_description"] = oerr.Description
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
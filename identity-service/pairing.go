@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+
+	"pubgames/shared/httpkit"
+)
+
+// Device pairing: a logged-in device shows a QR code holding a one-time
+// pairing token, and the phone that scans it exchanges the token for its
+// own session. A device can only pair others to its own account.
+
+const (
+	PAIRING_TOKEN_TTL = 2 * time.Minute
+	PAIRING_QR_SIZE   = 256
+)
+
+// createPairingHandler creates a pairing token for the current user
+// (protected route)
+func createPairingHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+
+	token, err := randomToken(16)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create pairing token", 500)
+		return
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO pairing_tokens (token_hash, user_id, created_by, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, hashToken(token), current.ID, current.ID, time.Now().UTC().Add(PAIRING_TOKEN_TTL))
+	if err != nil {
+		httpkit.SendError(w, "Failed to create pairing token", 500)
+		return
+	}
+
+	log.Printf("📱 Pairing token created for user %d", current.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PairingResponse{
+		Token:     token,
+		PairURL:   pairingURL(token),
+		QRPNG:     "/api/pairing/" + token + "/qr.png",
+		QRSVG:     "/api/pairing/" + token + "/qr.svg",
+		ExpiresIn: int(PAIRING_TOKEN_TTL.Seconds()),
+	})
+}
+
+// pairingQRHandler renders the QR code for a pairing token as PNG or SVG
+// (public route - img tags can't send auth headers, and the token in the
+// URL is the secret)
+func pairingQRHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	if !isPairingTokenValid(token) {
+		httpkit.SendError(w, "Pairing code expired", 404)
+		return
+	}
+
+	qr, err := qrcode.New(pairingURL(token), qrcode.Medium)
+	if err != nil {
+		httpkit.SendError(w, "Failed to render QR code", 500)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch vars["format"] {
+	case "png":
+		png, err := qr.PNG(PAIRING_QR_SIZE)
+		if err != nil {
+			httpkit.SendError(w, "Failed to render QR code", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(qrSVG(qr.Bitmap())))
+	default:
+		httpkit.SendError(w, "Unsupported format", 404)
+	}
+}
+
+// exchangePairingHandler trades a pairing token for a new session on the
+// scanning device (public route)
+func exchangePairingHandler(w http.ResponseWriter, r *http.Request) {
+	var req PairingExchangeRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	// Mark the token used in the same statement that checks it, so two
+	// devices racing with the same QR code can't both get in
+	result, err := db.Exec(`
+		UPDATE pairing_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+	`, hashToken(req.Token), time.Now().UTC())
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		httpkit.SendError(w, "Pairing code expired or already used", 401)
+		return
+	}
+
+	var user User
+	err = db.QueryRow(`
+		SELECT u.id, u.email, u.name, u.is_admin, u.created_at
+		FROM pairing_tokens p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.token_hash = ?
+	`, hashToken(req.Token)).Scan(&user.ID, &user.Email, &user.Name, &user.IsAdmin, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "User not found", 401)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	log.Printf("📱 User %d paired a new device", user.ID)
+
+	// Start a session and return tokens with user data
+	issueLogin(w, r, &user)
+}
+
+// isPairingTokenValid reports whether a pairing token is unused and unexpired
+func isPairingTokenValid(token string) bool {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM pairing_tokens
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+	`, hashToken(token), time.Now().UTC()).Scan(&count)
+	return err == nil && count > 0
+}
+
+// pairingURL is the frontend address a phone opens to complete pairing.
+// It uses the LAN IP so phones on the pub Wi-Fi can reach it.
+func pairingURL(token string) string {
+	return fmt.Sprintf("http://%s:%s/?pair=%s", getLocalIP(), serviceConfig.FrontendPort, token)
+}
+
+// qrSVG draws a QR bitmap as an SVG with one rect per dark module
+func qrSVG(bitmap [][]bool) string {
+	size := len(bitmap)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#ffffff"/>`, size, size)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="1" height="1" fill="#000000"/>`, x, y)
+			}
+		}
+	}
+	b.WriteString(`</svg>`)
+
+	return b.String()
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"pubgames/shared/httpkit"
+)
+
+// Passkeys (WebAuthn) let a user log in with their phone's fingerprint or
+// face unlock instead of typing their code. Each user can hold one passkey,
+// stored in the passkey_* columns of the users table; registering again
+// replaces it.
+//
+// Browsers only allow WebAuthn in a secure context (https, or localhost).
+// The relying party ID defaults to the hostname of the requesting page and
+// can be pinned with the webauthn_rp_id setting.
+//
+// Starting a login is public, so it is throttled per IP like logins, the
+// ceremonies waiting to finish are capped, and a login for an email with
+// no passkey looks just like one for an email that has one.
+
+const (
+	PASSKEY_RP_NAME      = "PubGames"
+	PASSKEY_CEREMONY_TTL = 5 * time.Minute
+	// Most ceremonies waiting to be finished at once
+	PASSKEY_MAX_CEREMONIES = 1000
+	// Passkey logins one IP can start per minute
+	PASSKEY_LOGINS_PER_IP_PER_MINUTE = 30
+
+	// noPasskeyUser marks a login started for an email without a passkey,
+	// which can never finish
+	noPasskeyUser = -1
+)
+
+var errTooManyCeremonies = errors.New("too many passkey ceremonies in progress")
+
+// passkeyCeremony is the server-side half of an in-progress registration
+// or login, kept between the begin and finish requests
+type passkeyCeremony struct {
+	session   webauthn.SessionData
+	origin    string
+	userID    int // 0 for discoverable (username-less) logins
+	expiresAt time.Time
+}
+
+var (
+	passkeyCeremonies   = make(map[string]passkeyCeremony)
+	passkeyCeremoniesMu sync.Mutex
+)
+
+// passkeyUser adapts a User and their stored passkey to webauthn.User
+type passkeyUser struct {
+	user       User
+	credential *webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(u.user.ID))
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *passkeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	if u.credential == nil {
+		return nil
+	}
+	return []webauthn.Credential{*u.credential}
+}
+
+// passkeyBeginRegistrationHandler starts adding a passkey to the current
+// user's account (protected route)
+func passkeyBeginRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+
+	wa, origin, err := webAuthnFor(r)
+	if err != nil {
+		httpkit.SendError(w, "Invalid or missing Origin header", 400)
+		return
+	}
+
+	pu, err := loadPasskeyUser(current.ID)
+	if err != nil {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+
+	var exclusions []protocol.CredentialDescriptor
+	if pu.credential != nil {
+		exclusions = append(exclusions, pu.credential.Descriptor())
+	}
+
+	options, session, err := wa.BeginRegistration(pu,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		log.Printf("Passkey registration begin failed for user %d: %v", current.ID, err)
+		httpkit.SendError(w, "Failed to start passkey registration", 500)
+		return
+	}
+
+	ceremonyID, err := saveCeremony(*session, origin, current.ID)
+	if err != nil {
+		sendCeremonyError(w, err, "Failed to start passkey registration")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ceremony_id": ceremonyID,
+		"options":     options,
+	})
+}
+
+// passkeyFinishRegistrationHandler verifies the authenticator's attestation
+// and stores the new passkey (protected route)
+func passkeyFinishRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+
+	var req PasskeyFinishRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	ceremony, ok := takeCeremony(req.CeremonyID)
+	if !ok || ceremony.userID != current.ID {
+		httpkit.SendError(w, "Passkey registration expired, please try again", 400)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		httpkit.SendError(w, "Invalid passkey response", 400)
+		return
+	}
+
+	pu, err := loadPasskeyUser(current.ID)
+	if err != nil {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+
+	wa, err := newWebAuthn(ceremony.origin)
+	if err != nil {
+		httpkit.SendError(w, "Invalid or missing Origin header", 400)
+		return
+	}
+
+	credential, err := wa.CreateCredential(pu, ceremony.session, parsed)
+	if err != nil {
+		log.Printf("Passkey attestation rejected for user %d: %v", current.ID, passkeyErrorDetail(err))
+		httpkit.SendError(w, "Passkey verification failed", 400)
+		return
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	_, err = db.Exec(`
+		UPDATE users
+		SET passkey_id = ?, passkey_public_key = ?, passkey_counter = ?,
+			passkey_transports = ?, passkey_created_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, base64.RawURLEncoding.EncodeToString(credential.ID),
+		base64.RawURLEncoding.EncodeToString(credential.PublicKey),
+		credential.Authenticator.SignCount,
+		strings.Join(transports, ","),
+		current.ID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to save passkey", 500)
+		return
+	}
+
+	log.Printf("🔐 Passkey registered for user %d", current.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Passkey registered",
+	})
+}
+
+// deletePasskeyHandler removes the current user's passkey (protected route)
+func deletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+
+	_, err := db.Exec(`
+		UPDATE users
+		SET passkey_id = NULL, passkey_public_key = NULL, passkey_counter = 0,
+			passkey_transports = NULL, passkey_created_at = NULL
+		WHERE id = ?
+	`, current.ID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to remove passkey", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Passkey removed",
+	})
+}
+
+// passkeyBeginLoginHandler starts a passkey login. With an email the
+// browser is asked for that user's passkey; without one the user picks
+// from the passkeys saved on their device (public route).
+func passkeyBeginLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginRequest
+	if r.ContentLength != 0 {
+		if err := httpkit.Decode(w, r, &req); err != nil {
+			httpkit.WriteError(w, err)
+			return
+		}
+	}
+
+	accountKey, ipKey := throttleKeys(req.Email, r)
+	keys := []string{ipKey}
+	if req.Email != "" {
+		keys = append(keys, accountKey)
+	}
+	if wait := checkLoginThrottle(keys...); wait > 0 {
+		sendThrottled(w, wait)
+		return
+	}
+	if wait := takeRateLimit("passkey-ip:"+clientIP(r), PASSKEY_LOGINS_PER_IP_PER_MINUTE, time.Minute); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		httpkit.SendError(w, "Too many passkey logins from this network. Please try again in a minute.", http.StatusTooManyRequests)
+		return
+	}
+
+	wa, origin, err := webAuthnFor(r)
+	if err != nil {
+		httpkit.SendError(w, "Invalid or missing Origin header", 400)
+		return
+	}
+
+	var options *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	userID := 0
+
+	if req.Email != "" {
+		pu, lookupErr := loadPasskeyUserByEmail(req.Email)
+		if lookupErr == nil && pu.credential != nil {
+			userID = pu.user.ID
+		} else {
+			// Ask for a made-up passkey rather than saying the account
+			// doesn't exist or has none
+			pu = decoyPasskeyUser(req.Email)
+			userID = noPasskeyUser
+		}
+		options, session, err = wa.BeginLogin(pu)
+	} else {
+		options, session, err = wa.BeginDiscoverableLogin()
+	}
+
+	if err != nil {
+		log.Printf("Passkey login begin failed: %v", err)
+		httpkit.SendError(w, "Failed to start passkey login", 500)
+		return
+	}
+
+	ceremonyID, err := saveCeremony(*session, origin, userID)
+	if err != nil {
+		sendCeremonyError(w, err, "Failed to start passkey login")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ceremony_id": ceremonyID,
+		"options":     options,
+	})
+}
+
+// passkeyFinishLoginHandler verifies the assertion and sign counter, then
+// logs the user in exactly like loginHandler (public route)
+func passkeyFinishLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyFinishRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	_, ipKey := throttleKeys("", r)
+	if wait := checkLoginThrottle(ipKey); wait > 0 {
+		sendThrottled(w, wait)
+		return
+	}
+
+	ceremony, ok := takeCeremony(req.CeremonyID)
+	if !ok {
+		httpkit.SendError(w, "Passkey login expired, please try again", 400)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		httpkit.SendError(w, "Invalid passkey response", 400)
+		return
+	}
+
+	if ceremony.userID == noPasskeyUser {
+		recordLoginFailure(ipKey, IP_FREE_ATTEMPTS)
+		httpkit.SendError(w, "Passkey verification failed", 401)
+		return
+	}
+
+	wa, err := newWebAuthn(ceremony.origin)
+	if err != nil {
+		httpkit.SendError(w, "Invalid or missing Origin header", 400)
+		return
+	}
+
+	var pu *passkeyUser
+	var credential *webauthn.Credential
+	if ceremony.userID != 0 {
+		pu, err = loadPasskeyUser(ceremony.userID)
+		if err == nil {
+			credential, err = wa.ValidateLogin(pu, ceremony.session, parsed)
+		}
+	} else {
+		credential, err = wa.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			id, convErr := strconv.Atoi(string(userHandle))
+			if convErr != nil {
+				return nil, convErr
+			}
+			pu, convErr = loadPasskeyUser(id)
+			return pu, convErr
+		}, ceremony.session, parsed)
+	}
+
+	if err != nil || pu == nil {
+		log.Printf("Passkey assertion rejected: %v", passkeyErrorDetail(err))
+		recordLoginFailure(ipKey, IP_FREE_ATTEMPTS)
+		httpkit.SendError(w, "Passkey verification failed", 401)
+		return
+	}
+
+	// The sign counter must go up on every use; if it didn't, the
+	// credential may have been cloned
+	if credential.Authenticator.CloneWarning {
+		log.Printf("⚠️  Passkey sign counter did not increase for user %d (stored %d, got %d)",
+			pu.user.ID, pu.credential.Authenticator.SignCount, parsed.Response.AuthenticatorData.Counter)
+		httpkit.SendError(w, "Passkey verification failed", 401)
+		return
+	}
+
+	_, err = db.Exec("UPDATE users SET passkey_counter = ? WHERE id = ?",
+		parsed.Response.AuthenticatorData.Counter, pu.user.ID)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	// Start a session and return tokens with user data
+	issueLogin(w, r, &pu.user)
+}
+
+// loadPasskeyUser loads a user along with their stored passkey, if any
+func loadPasskeyUser(userID int) (*passkeyUser, error) {
+	var pu passkeyUser
+	var credentialID, publicKey, transports sql.NullString
+	var counter sql.NullInt64
+
+	err := db.QueryRow(`
+		SELECT id, email, name, is_admin, created_at,
+			passkey_id, passkey_public_key, passkey_counter, passkey_transports
+		FROM users
+		WHERE id = ?
+	`, userID).Scan(&pu.user.ID, &pu.user.Email, &pu.user.Name, &pu.user.IsAdmin, &pu.user.CreatedAt,
+		&credentialID, &publicKey, &counter, &transports)
+	if err != nil {
+		return nil, err
+	}
+
+	if !credentialID.Valid || !publicKey.Valid {
+		return &pu, nil
+	}
+
+	id, err := base64.RawURLEncoding.DecodeString(credentialID.String)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.RawURLEncoding.DecodeString(publicKey.String)
+	if err != nil {
+		return nil, err
+	}
+
+	credential := &webauthn.Credential{
+		ID:        id,
+		PublicKey: key,
+		Authenticator: webauthn.Authenticator{
+			SignCount: uint32(counter.Int64),
+		},
+	}
+	for _, t := range strings.Split(transports.String, ",") {
+		if t != "" {
+			credential.Transport = append(credential.Transport, protocol.AuthenticatorTransport(t))
+		}
+	}
+	pu.credential = credential
+
+	return &pu, nil
+}
+
+// loadPasskeyUserByEmail loads a user and their passkey by email
+func loadPasskeyUserByEmail(email string) (*passkeyUser, error) {
+	var id int
+	if err := db.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&id); err != nil {
+		return nil, err
+	}
+	return loadPasskeyUser(id)
+}
+
+// decoyPasskeyUser stands in for an email with no passkey. Its credential
+// ID is derived from the email, so asking twice gives the same answer as
+// it would for a real passkey.
+func decoyPasskeyUser(email string) *passkeyUser {
+	mac := hmac.New(sha256.New, keyStore.Active().privateKey.Seed())
+	mac.Write([]byte("passkey-decoy:" + strings.ToLower(strings.TrimSpace(email))))
+	return &passkeyUser{
+		user:       User{Email: email},
+		credential: &webauthn.Credential{ID: mac.Sum(nil)},
+	}
+}
+
+// webAuthnFor builds the relying party config for the page making the
+// request, returning the origin so the finish step can use the same one.
+// Only origins the CORS rules allow are trusted, so another site can't
+// run a ceremony for its own origin.
+func webAuthnFor(r *http.Request) (*webauthn.WebAuthn, string, error) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil, "", errors.New("missing Origin header")
+	}
+	if !corsConfig.IsOriginAllowed(origin) {
+		return nil, "", errors.New("origin not allowed by the CORS rules")
+	}
+	wa, err := newWebAuthn(origin)
+	return wa, origin, err
+}
+
+// newWebAuthn creates a relying party for a single page origin
+func newWebAuthn(origin string) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Hostname() == "" {
+		return nil, errors.New("invalid Origin header")
+	}
+
+	rpID := serviceConfig.WebAuthnRPID
+	if rpID == "" {
+		rpID = u.Hostname()
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: PASSKEY_RP_NAME,
+		RPOrigins:     []string{origin},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: PASSKEY_CEREMONY_TTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: PASSKEY_CEREMONY_TTL},
+		},
+	})
+}
+
+// saveCeremony stores ceremony state and returns its ID
+func saveCeremony(session webauthn.SessionData, origin string, userID int) (string, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	passkeyCeremoniesMu.Lock()
+	defer passkeyCeremoniesMu.Unlock()
+
+	now := time.Now()
+	for key, c := range passkeyCeremonies {
+		if now.After(c.expiresAt) {
+			delete(passkeyCeremonies, key)
+		}
+	}
+	if len(passkeyCeremonies) >= PASSKEY_MAX_CEREMONIES {
+		return "", errTooManyCeremonies
+	}
+
+	passkeyCeremonies[id] = passkeyCeremony{
+		session:   session,
+		origin:    origin,
+		userID:    userID,
+		expiresAt: now.Add(PASSKEY_CEREMONY_TTL),
+	}
+	return id, nil
+}
+
+// sendCeremonyError responds to a failed saveCeremony, asking the client to
+// come back shortly if too many ceremonies are in progress
+func sendCeremonyError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, errTooManyCeremonies) {
+		w.Header().Set("Retry-After", "30")
+		httpkit.SendError(w, "Too many passkey requests right now. Please try again shortly.", http.StatusServiceUnavailable)
+		return
+	}
+	httpkit.SendError(w, msg, 500)
+}
+
+// takeCeremony removes and returns ceremony state; each ceremony can be
+// finished only once
+func takeCeremony(id string) (passkeyCeremony, bool) {
+	passkeyCeremoniesMu.Lock()
+	defer passkeyCeremoniesMu.Unlock()
+
+	c, ok := passkeyCeremonies[id]
+	delete(passkeyCeremonies, id)
+	if !ok || time.Now().After(c.expiresAt) {
+		return passkeyCeremony{}, false
+	}
+	return c, true
+}
+
+// passkeyErrorDetail includes the library's debug info when logging
+func passkeyErrorDetail(err error) string {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		return perr.Error() + ": " + perr.DevInfo
+	}
+	if err == nil {
+		return "unknown user"
+	}
+	return err.Error()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// updateProfileHandler lets a user change their name or email. Changing
+// email needs the current code, records the old address in
+// user_email_history so apps that key on email can still find the user's
+// history, and returns a new token carrying the new email.
+func updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+
+	var req UpdateProfileRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Name == "" && req.Email == "" {
+		httpkit.SendError(w, "Name or email is required", 400)
+		return
+	}
+
+	user, err := loadUser(current.ID)
+	if err != nil {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+
+	emailChanged := req.Email != "" && !strings.EqualFold(req.Email, user.Email)
+	if emailChanged {
+		if ok := verifyCurrentCode(w, r, user, req.Code); !ok {
+			return
+		}
+		if !emailAvailable(w, req.Email, user.ID) {
+			return
+		}
+	}
+
+	oldEmail := user.Email
+	if req.Name != "" {
+		user.Name = req.Name
+	}
+	if req.Email != "" {
+		user.Email = req.Email
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET name = ?, email = ? WHERE id = ?", user.Name, user.Email, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			httpkit.SendError(w, "Email already registered", 409)
+		} else {
+			httpkit.SendError(w, "Failed to update profile", 500)
+		}
+		return
+	}
+
+	if oldEmail != user.Email {
+		if err := recordEmailChange(tx, user.ID, oldEmail); err != nil {
+			httpkit.SendError(w, "Failed to update profile", 500)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		httpkit.SendError(w, "Failed to update profile", 500)
+		return
+	}
+
+	if emailChanged {
+		log.Printf("✉️  User %d changed email", user.ID)
+	}
+	publishUserEvent(auth.EventUserUpdated, user.ID)
+
+	// Issue a token with the updated claims for this session
+	token, err := generateToken(user, current.SessionID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to generate token", 500)
+		return
+	}
+	user.SessionID = current.SessionID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token": token,
+		"user":  user,
+	})
+}
+
+// changeCodeHandler changes the user's login code after checking the
+// current one, and logs out their other devices
+func changeCodeHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+
+	var req ChangeCodeRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	if len(req.NewCode) != 6 {
+		httpkit.SendError(w, "Code must be exactly 6 characters", 400)
+		return
+	}
+
+	user, err := loadUser(current.ID)
+	if err != nil {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+
+	if ok := verifyCurrentCode(w, r, user, req.CurrentCode); !ok {
+		return
+	}
+
+	hashedCode, err := bcrypt.GenerateFromPassword([]byte(req.NewCode), 12)
+	if err != nil {
+		httpkit.SendError(w, "Failed to process code", 500)
+		return
+	}
+
+	if _, err := db.Exec("UPDATE users SET code = ? WHERE id = ?", string(hashedCode), user.ID); err != nil {
+		httpkit.SendError(w, "Failed to change code", 500)
+		return
+	}
+
+	if _, err := endSessions("user_id = ? AND id != ?", user.ID, current.SessionID); err != nil {
+		log.Printf("Warning: Could not end other sessions for user %d: %v", user.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Code changed. Other devices have been logged out.",
+	})
+}
+
+// getUserEmailsHandler returns the user's current and former email
+// addresses, so apps that store data by email can find all of it
+func getUserEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	current := r.Context().Value(userContextKey).(*User)
+
+	user, err := loadUser(current.ID)
+	if err != nil {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT email FROM user_email_history
+		WHERE user_id = ?
+		ORDER BY changed_at DESC
+	`, user.ID)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	previous := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			continue
+		}
+		if !strings.EqualFold(email, user.Email) {
+			previous = append(previous, email)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":  user.ID,
+		"email":    user.Email,
+		"previous": previous,
+	})
+}
+
+// recordEmailChange remembers an address the user no longer uses
+func recordEmailChange(tx *sql.Tx, userID int, oldEmail string) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_email_history (user_id, email)
+		VALUES (?, ?)
+	`, userID, oldEmail)
+	return err
+}
+
+// emailAvailable checks email isn't a former address of anyone but userID
+// (0 for a new account). Former addresses stay reserved: apps that keep
+// data by email would otherwise hand the old owner's history to whoever
+// took the address next. It writes the error response and returns false
+// if the email can't be used.
+func emailAvailable(w http.ResponseWriter, email string, userID int) bool {
+	var reserved bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM user_email_history
+			WHERE email = ? COLLATE NOCASE AND user_id != ?
+		)
+	`, email, userID).Scan(&reserved)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return false
+	}
+	if reserved {
+		httpkit.SendError(w, "Email already registered", 409)
+		return false
+	}
+	return true
+}
+
+// verifyCurrentCode checks a code the user typed to confirm a sensitive
+// change, applying the same lockout as login. It writes the error
+// response and returns false if the code is wrong.
+func verifyCurrentCode(w http.ResponseWriter, r *http.Request, user *User, code string) bool {
+	accountKey, _ := throttleKeys(user.Email, r)
+	if wait := checkLoginThrottle(accountKey); wait > 0 {
+		sendThrottled(w, wait)
+		return false
+	}
+
+	var storedCode string
+	if err := db.QueryRow("SELECT code FROM users WHERE id = ?", user.ID).Scan(&storedCode); err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(storedCode), []byte(code)); err != nil {
+		recordLoginFailure(accountKey, ACCOUNT_FREE_ATTEMPTS)
+		httpkit.SendError(w, "Current code is incorrect", 401)
+		return false
+	}
+
+	clearLoginFailures(accountKey)
+	return true
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"pubgames/shared/httpkit"
+)
+
+// Roles are granted per user in user_roles. Most roles are global
+// (app_id 0); app_admin is granted for a single app. In tokens a role is
+// written as its name, or "name:<app id>" for per-app roles.
+
+const (
+	ROLE_PLAYER    = "player"
+	ROLE_HOST      = "host"
+	ROLE_ADMIN     = "admin"
+	ROLE_APP_ADMIN = "app_admin"
+	ROLE_GUEST     = "guest"
+)
+
+// Role is a role definition from the roles table
+type Role struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	PerApp      bool   `json:"per_app"`
+}
+
+// RoleGrant is a role held by a user
+type RoleGrant struct {
+	Role  string `json:"role"`
+	AppID int    `json:"app_id,omitempty"`
+}
+
+// String formats the grant as it appears in the roles claim
+func (g RoleGrant) String() string {
+	if g.AppID != 0 {
+		return fmt.Sprintf("%s:%d", g.Role, g.AppID)
+	}
+	return g.Role
+}
+
+// seedRoles creates the built-in roles and, the first time it runs, makes
+// existing users players. The admin role is never granted from the old
+// is_admin flag; see confirmLegacyAdmins.
+func seedRoles() {
+	roles := []Role{
+		{ROLE_PLAYER, "Plays games", false},
+		{ROLE_HOST, "Runs games and draws at the venue", false},
+		{ROLE_ADMIN, "Manages users, apps and settings", false},
+		{ROLE_APP_ADMIN, "Manages a single app", true},
+		{ROLE_GUEST, "Temporary quick-play account", false},
+	}
+
+	for _, role := range roles {
+		_, err := db.Exec(`
+			INSERT OR IGNORE INTO roles (name, description, per_app)
+			VALUES (?, ?, ?)
+		`, role.Name, role.Description, role.PerApp)
+		if err != nil {
+			log.Printf("Warning: Failed to create role %s: %v", role.Name, err)
+		}
+	}
+
+	// Users created before roles existed become players once, when the
+	// table is first filled. After that grants are only changed by admins,
+	// so a revoked role stays revoked across restarts.
+	var grants int
+	if err := db.QueryRow("SELECT COUNT(*) FROM user_roles").Scan(&grants); err != nil {
+		log.Printf("Warning: Failed to check user roles: %v", err)
+		return
+	}
+	if grants > 0 {
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT OR IGNORE INTO user_roles (user_id, role, app_id)
+		SELECT id, ?, 0 FROM users WHERE guest_expires_at IS NULL
+	`, ROLE_PLAYER)
+	if err != nil {
+		log.Printf("Warning: Failed to grant roles to existing users: %v", err)
+		return
+	}
+	if count, _ := result.RowsAffected(); count > 0 {
+		log.Printf("✅ Made %d existing users players", count)
+	}
+}
+
+// confirmLegacyAdmins lists users whose is_admin flag predates roles but
+// who don't hold the admin role. Before roles, users could set the flag
+// themselves, so it is never turned into the role automatically: an admin
+// grants it with POST /api/admin/users/{id}/roles or, while nobody holds
+// the admin role, the operator names one with the bootstrap_admin setting.
+func confirmLegacyAdmins() {
+	if email := serviceConfig.BootstrapAdmin; email != "" {
+		bootstrapAdmin(email)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, email FROM users u
+		WHERE is_admin = 1 AND deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM user_roles WHERE user_id = u.id AND role = ?)
+		ORDER BY id
+	`, ROLE_ADMIN)
+	if err != nil {
+		log.Printf("Warning: Failed to check for unconfirmed admins: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			continue
+		}
+		log.Printf("⚠️  User %d (%s) is flagged is_admin but was never granted the admin role; they are not an admin until one confirms it", id, email)
+	}
+}
+
+// bootstrapAdmin grants the admin role to the user with email, but only
+// while no active user holds it
+func bootstrapAdmin(email string) {
+	var admins int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM user_roles ur
+		JOIN users u ON u.id = ur.user_id
+		WHERE ur.role = ? AND u.disabled_at IS NULL AND u.deleted_at IS NULL
+	`, ROLE_ADMIN).Scan(&admins)
+	if err != nil {
+		log.Printf("Warning: Failed to check admins: %v", err)
+		return
+	}
+	if admins > 0 {
+		log.Printf("Warning: Ignoring bootstrap_admin; %d users already hold the admin role", admins)
+		return
+	}
+
+	var userID int
+	err = db.QueryRow(`
+		SELECT id FROM users
+		WHERE lower(email) = lower(?) AND deleted_at IS NULL AND disabled_at IS NULL AND guest_expires_at IS NULL
+	`, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		log.Printf("Warning: bootstrap_admin %s is not an active account", email)
+		return
+	} else if err != nil {
+		log.Printf("Warning: Failed to look up bootstrap_admin: %v", err)
+		return
+	}
+
+	if err := grantRole(userID, RoleGrant{Role: ROLE_ADMIN}, 0); err != nil {
+		log.Printf("Warning: Failed to grant admin to %s: %v", email, err)
+		return
+	}
+	log.Printf("👑 Granted admin to user %d (%s) from bootstrap_admin", userID, email)
+}
+
+// loadUserRoles returns the roles claim values for a user
+func loadUserRoles(userID int) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT role, app_id FROM user_roles
+		WHERE user_id = ?
+		ORDER BY role, app_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var grant RoleGrant
+		if err := rows.Scan(&grant.Role, &grant.AppID); err != nil {
+			return nil, err
+		}
+		roles = append(roles, grant.String())
+	}
+	return roles, rows.Err()
+}
+
+// hasRole reports whether roles contains role
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// grantRole gives a user a role. Granting admin also sets users.is_admin,
+// which older apps still read.
+func grantRole(userID int, grant RoleGrant, grantedBy int) error {
+	_, err := db.Exec(`
+		INSERT OR IGNORE INTO user_roles (user_id, role, app_id, granted_by)
+		VALUES (?, ?, ?, ?)
+	`, userID, grant.Role, grant.AppID, grantedBy)
+	if err != nil {
+		return err
+	}
+	return syncAdminFlag(userID)
+}
+
+// syncAdminFlag keeps users.is_admin in step with the admin role
+func syncAdminFlag(userID int) error {
+	_, err := db.Exec(`
+		UPDATE users SET is_admin = EXISTS (
+			SELECT 1 FROM user_roles WHERE user_id = ? AND role = ?
+		)
+		WHERE id = ?
+	`, userID, ROLE_ADMIN, userID)
+	return err
+}
+
+// getRolesHandler lists role definitions (admin only)
+func getRolesHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query("SELECT name, description, per_app FROM roles ORDER BY name")
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		var description sql.NullString
+		if err := rows.Scan(&role.Name, &description, &role.PerApp); err != nil {
+			continue
+		}
+		role.Description = description.String
+		roles = append(roles, role)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roles)
+}
+
+// getUserRolesHandler lists a user's roles (admin only)
+func getUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		httpkit.SendError(w, "Invalid user ID", 400)
+		return
+	}
+
+	roles, err := loadUserRoles(userID)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"roles":   roles,
+	})
+}
+
+// grantRoleHandler gives a user a role (admin only). The user picks it up
+// the next time their token is refreshed.
+func grantRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin := r.Context().Value(userContextKey).(*User)
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		httpkit.SendError(w, "Invalid user ID", 400)
+		return
+	}
+
+	var grant RoleGrant
+	if err := httpkit.Decode(w, r, &grant); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	if msg := validateRoleGrant(grant); msg != "" {
+		httpkit.SendError(w, msg, 400)
+		return
+	}
+
+	var exists int
+	db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&exists)
+	if exists == 0 {
+		httpkit.SendError(w, "User not found", 404)
+		return
+	}
+
+	if err := grantRole(userID, grant, admin.ID); err != nil {
+		httpkit.SendError(w, "Failed to grant role", 500)
+		return
+	}
+
+	recordAudit(r, "role.grant", "user", userID, map[string]interface{}{"role": grant.String()})
+	log.Printf("👑 User %d granted %s to user %d", admin.ID, grant, userID)
+
+	roles, _ := loadUserRoles(userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"roles":   roles,
+	})
+}
+
+// revokeRoleHandler removes a role from a user (admin only). The user's
+// sessions are ended so the change applies immediately rather than when
+// their current token expires.
+func revokeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin := r.Context().Value(userContextKey).(*User)
+	vars := mux.Vars(r)
+
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		httpkit.SendError(w, "Invalid user ID", 400)
+		return
+	}
+
+	grant := RoleGrant{Role: vars["role"]}
+	if appID := r.URL.Query().Get("app_id"); appID != "" {
+		grant.AppID, err = strconv.Atoi(appID)
+		if err != nil {
+			httpkit.SendError(w, "Invalid app ID", 400)
+			return
+		}
+	}
+
+	if grant.Role == ROLE_ADMIN {
+		var otherAdmins int
+		db.QueryRow(`
+			SELECT COUNT(*) FROM user_roles ur
+			JOIN users u ON u.id = ur.user_id
+			WHERE ur.role = ? AND ur.user_id != ? AND u.disabled_at IS NULL AND u.deleted_at IS NULL
+		`, ROLE_ADMIN, userID).Scan(&otherAdmins)
+		if otherAdmins == 0 {
+			httpkit.SendError(w, "Cannot remove the last admin", 400)
+			return
+		}
+	}
+
+	result, err := db.Exec(`
+		DELETE FROM user_roles
+		WHERE user_id = ? AND role = ? AND app_id = ?
+	`, userID, grant.Role, grant.AppID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to revoke role", 500)
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		httpkit.SendError(w, "User does not have this role", 404)
+		return
+	}
+
+	if err := syncAdminFlag(userID); err != nil {
+		log.Printf("Warning: Could not update admin flag for user %d: %v", userID, err)
+	}
+	if err := revokeUserSessions(userID); err != nil {
+		log.Printf("Warning: Could not end sessions for user %d: %v", userID, err)
+	}
+
+	recordAudit(r, "role.revoke", "user", userID, map[string]interface{}{"role": grant.String()})
+	log.Printf("👑 User %d revoked %s from user %d", admin.ID, grant, userID)
+
+	roles, _ := loadUserRoles(userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"roles":   roles,
+	})
+}
+
+// validateRoleGrant checks a grant against the role definitions, returning
+// an error message or "" if it is valid
+func validateRoleGrant(grant RoleGrant) string {
+	if grant.Role == ROLE_GUEST {
+		return "The guest role is only given to guest accounts"
+	}
+
+	var perApp bool
+	err := db.QueryRow("SELECT per_app FROM roles WHERE name = ?", grant.Role).Scan(&perApp)
+	if err != nil {
+		return "Unknown role"
+	}
+
+	if perApp {
+		if grant.AppID == 0 {
+			return "app_id is required for this role"
+		}
+		var exists int
+		db.QueryRow("SELECT COUNT(*) FROM apps WHERE id = ?", grant.AppID).Scan(&exists)
+		if exists == 0 {
+			return "App not found"
+		}
+	} else if grant.AppID != 0 {
+		return "This role cannot be limited to an app"
+	}
+
+	return ""
+}
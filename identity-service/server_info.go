@@ -13,15 +13,24 @@ func getServerInfoHandler(w http.ResponseWriter, r *http.Request) {
 	
 	response := map[string]interface{}{
 		"local_ip":      localIP,
-		"frontend_port": FRONTEND_PORT,
-		"backend_port":  BACKEND_PORT,
-		"qr_url":        fmt.Sprintf("http://%s:%s", localIP, FRONTEND_PORT),
+		"frontend_port": serviceConfig.FrontendPort,
+		"backend_port":  serviceConfig.Port,
+		"qr_url":        fmt.Sprintf("http://%s:%s", localIP, serviceConfig.FrontendPort),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// getConfigHandler returns the service's non-secret settings
+func getConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"app_name": "Identity Service",
+		"settings": serviceConfig.Public(),
+	})
+}
+
 // getLocalIP returns the local IP address of the server
 func getLocalIP() string {
 	// Try to find local IP by connecting to a remote address
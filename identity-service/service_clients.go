@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// App backends authenticate to the /api/service routes with a client ID
+// and secret issued by an admin, signing each request (see shared/auth
+// service.go). The secret is shown once when the client is created. A
+// client is tied to one app, which it registers or updates at startup.
+// Anything beyond that and name lookups needs a scope granted when the
+// client is created.
+
+const (
+	serviceClientContextKey contextKey = "service_client"
+
+	// Largest body accepted on signed service routes
+	MAX_SERVICE_BODY = 64 * 1024
+
+	// SCOPE_LOOKUP_EMAILS lets a client resolve emails to user IDs
+	SCOPE_LOOKUP_EMAILS = "users:emails"
+)
+
+// serviceScopes are the scopes a client can be granted
+var serviceScopes = map[string]bool{
+	SCOPE_LOOKUP_EMAILS: true,
+}
+
+// ServiceClient is an app backend's credentials (without the secret)
+type ServiceClient struct {
+	ID         string     `json:"client_id"`
+	Name       string     `json:"name"`
+	AppID      *int       `json:"app_id"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateServiceClientRequest names a new client, optionally tying it to an
+// existing app and granting it scopes
+type CreateServiceClientRequest struct {
+	Name   string   `json:"name"`
+	AppID  int      `json:"app_id"`
+	Scopes []string `json:"scopes"`
+}
+
+// hasScope reports whether the client was granted scope
+func (c *ServiceClient) hasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceMiddleware checks the request signature against the calling
+// client's secret and puts the client in the request context
+func serviceMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.Header.Get(auth.ClientIDHeader)
+		if clientID == "" {
+			httpkit.SendError(w, "Missing client credentials", http.StatusUnauthorized)
+			return
+		}
+
+		var client ServiceClient
+		var secret, scopes string
+		var appID sql.NullInt64
+		err := db.QueryRow(`
+			SELECT id, name, secret, app_id, COALESCE(scopes, ''), created_at FROM app_clients
+			WHERE id = ? AND revoked_at IS NULL
+		`, clientID).Scan(&client.ID, &client.Name, &secret, &appID, &scopes, &client.CreatedAt)
+		if err != nil {
+			httpkit.SendError(w, "Invalid client credentials", http.StatusUnauthorized)
+			return
+		}
+		if appID.Valid {
+			id := int(appID.Int64)
+			client.AppID = &id
+		}
+		client.Scopes = strings.Fields(scopes)
+
+		body, err := auth.ReadBody(r, MAX_SERVICE_BODY)
+		if err != nil {
+			httpkit.SendError(w, "Invalid request body", 400)
+			return
+		}
+
+		if err := auth.VerifyRequestSignature(r, body, secret); err != nil {
+			log.Printf("❌ Service request from %s rejected: %v", clientID, err)
+			httpkit.SendError(w, "Invalid client credentials", http.StatusUnauthorized)
+			return
+		}
+
+		db.Exec("UPDATE app_clients SET last_used_at = ? WHERE id = ?", time.Now().UTC(), clientID)
+
+		ctx := context.WithValue(r.Context(), serviceClientContextKey, &client)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// registerServiceAppHandler creates or updates the calling client's app.
+// A client not yet tied to an app adopts an unclaimed app with the same
+// name (e.g. one from the seed data) or creates a new one. Only the
+// app's own details are changed; is_active and sort_order stay under
+// admin control.
+func registerServiceAppHandler(w http.ResponseWriter, r *http.Request) {
+	client := r.Context().Value(serviceClientContextKey).(*ServiceClient)
+
+	var reg auth.AppRegistration
+	if err := httpkit.Decode(w, r, &reg); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	app := App{
+		Name:        strings.TrimSpace(reg.Name),
+		URL:         strings.TrimSpace(reg.URL),
+		APIURL:      strings.TrimSpace(reg.APIURL),
+		Description: reg.Description,
+		Icon:        reg.Icon,
+		IsActive:    true,
+
+		RedirectURIs: reg.RedirectURIs,
+		WebhookURL:   strings.TrimSpace(reg.WebhookURL),
+	}
+	if msg := validateApp(&app); msg != "" {
+		httpkit.SendError(w, msg, 400)
+		return
+	}
+
+	appID := 0
+	if client.AppID != nil {
+		appID = *client.AppID
+	} else {
+		db.QueryRow(`
+			SELECT id FROM apps
+			WHERE name = ? AND NOT EXISTS (
+				SELECT 1 FROM app_clients c
+				WHERE c.app_id = apps.id AND c.revoked_at IS NULL
+			)
+			ORDER BY id LIMIT 1
+		`, app.Name).Scan(&appID)
+	}
+
+	created := false
+	if appID != 0 {
+		result, err := db.Exec(`
+			UPDATE apps SET name = ?, url = ?, api_url = ?, description = ?, icon = ?, redirect_uris = ?, webhook_url = ?
+			WHERE id = ?
+		`, app.Name, app.URL, app.APIURL, app.Description, app.Icon, redirectURIsValue(app.RedirectURIs),
+			app.WebhookURL, appID)
+		if err != nil {
+			httpkit.SendError(w, "Failed to register app", 500)
+			return
+		}
+		if count, _ := result.RowsAffected(); count == 0 {
+			// The app was deleted by an admin; register it afresh
+			appID = 0
+		}
+	}
+	if appID == 0 {
+		result, err := db.Exec(`
+			INSERT INTO apps (name, url, api_url, description, icon, is_active, sort_order, redirect_uris, webhook_url)
+			VALUES (?, ?, ?, ?, ?, 1, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM apps), ?, ?)
+		`, app.Name, app.URL, app.APIURL, app.Description, app.Icon, redirectURIsValue(app.RedirectURIs),
+			app.WebhookURL)
+		if err != nil {
+			httpkit.SendError(w, "Failed to register app", 500)
+			return
+		}
+		id, _ := result.LastInsertId()
+		appID = int(id)
+		created = true
+	}
+
+	if client.AppID == nil || *client.AppID != appID {
+		if _, err := db.Exec("UPDATE app_clients SET app_id = ? WHERE id = ?", appID, client.ID); err != nil {
+			log.Printf("Warning: Could not link client %s to app %d: %v", client.ID, appID, err)
+		}
+	}
+
+	action := "app.register"
+	if created {
+		action = "app.create"
+	}
+	recordAudit(r, action, "app", appID, map[string]interface{}{
+		"client_id": client.ID,
+		"version":   reg.Version,
+	})
+	log.Printf("🧩 App %s registered itself via client %s (v%s)", app.Name, client.ID, reg.Version)
+
+	saved, err := loadApp(appID)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	if saved.IsActive {
+		saved.Health = probeAndStore(*saved)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+// createServiceClientHandler issues credentials for an app backend (admin
+// only). The secret is returned once and cannot be retrieved later.
+func createServiceClientHandler(w http.ResponseWriter, r *http.Request) {
+	admin := r.Context().Value(userContextKey).(*User)
+
+	var req CreateServiceClientRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		httpkit.SendError(w, "Name is required", 400)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !serviceScopes[scope] {
+			httpkit.SendError(w, fmt.Sprintf("Unknown scope %q", scope), 400)
+			return
+		}
+	}
+	if req.Scopes == nil {
+		req.Scopes = []string{}
+	}
+
+	var appID interface{}
+	if req.AppID != 0 {
+		var exists int
+		db.QueryRow("SELECT COUNT(*) FROM apps WHERE id = ?", req.AppID).Scan(&exists)
+		if exists == 0 {
+			httpkit.SendError(w, "App not found", 404)
+			return
+		}
+		appID = req.AppID
+	}
+
+	idPart, err := randomToken(9)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create client", 500)
+		return
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create client", 500)
+		return
+	}
+	clientID := "app_" + idPart
+
+	_, err = db.Exec(`
+		INSERT INTO app_clients (id, name, secret, app_id, scopes, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, clientID, req.Name, secret, appID, strings.Join(req.Scopes, " "), admin.ID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to create client", 500)
+		return
+	}
+
+	recordAudit(r, "client.create", "app", req.AppID, map[string]interface{}{
+		"client_id": clientID,
+		"name":      req.Name,
+		"scopes":    req.Scopes,
+	})
+	log.Printf("🔑 User %d created service client %s (%s)", admin.ID, clientID, req.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"client_id":     clientID,
+		"client_secret": secret,
+		"name":          req.Name,
+		"app_id":        appID,
+		"scopes":        req.Scopes,
+		"message":       "Store the secret now; it will not be shown again",
+	})
+}
+
+// getServiceClientsHandler lists service clients without their secrets
+// (admin only)
+func getServiceClientsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+		SELECT id, name, app_id, COALESCE(scopes, ''), created_at, last_used_at, revoked_at
+		FROM app_clients
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	clients := []ServiceClient{}
+	for rows.Next() {
+		var c ServiceClient
+		var scopes string
+		var appID sql.NullInt64
+		var lastUsed, revoked sql.NullTime
+		if err := rows.Scan(&c.ID, &c.Name, &appID, &scopes, &c.CreatedAt, &lastUsed, &revoked); err != nil {
+			continue
+		}
+		c.Scopes = strings.Fields(scopes)
+		if appID.Valid {
+			id := int(appID.Int64)
+			c.AppID = &id
+		}
+		if lastUsed.Valid {
+			c.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			c.RevokedAt = &revoked.Time
+		}
+		clients = append(clients, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+// revokeServiceClientHandler stops a client's credentials working (admin
+// only). Its app stays in the registry.
+func revokeServiceClientHandler(w http.ResponseWriter, r *http.Request) {
+	clientID := mux.Vars(r)["id"]
+
+	result, err := db.Exec(`
+		UPDATE app_clients SET revoked_at = ?
+		WHERE id = ? AND revoked_at IS NULL
+	`, time.Now().UTC(), clientID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to revoke client", 500)
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		httpkit.SendError(w, "Client not found", 404)
+		return
+	}
+
+	recordAudit(r, "client.revoke", "app", 0, map[string]interface{}{"client_id": clientID})
+	log.Printf("🔑 Service client %s revoked", clientID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Client revoked",
+	})
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// issueLogin starts a new session for user and writes the access token,
+// refresh token and user data. Every login method ends here.
+func issueLogin(w http.ResponseWriter, r *http.Request, user *User) {
+	if isUserDisabled(user.ID) {
+		httpkit.SendError(w, "Account disabled", 403)
+		return
+	}
+
+	sessionID, refreshToken, err := createSession(user.ID, "", r)
+	if err != nil {
+		log.Printf("Failed to create session for user %d: %v", user.ID, err)
+		httpkit.SendError(w, "Failed to create session", 500)
+		return
+	}
+
+	token, err := generateToken(user, sessionID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to generate token", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(ACCESS_TOKEN_TTL.Seconds()),
+		User:         *user,
+	})
+}
+
+// createSession stores a new session and returns its ID and refresh token.
+// Refresh tokens have the form "<session id>.<secret>"; only a hash is kept.
+func createSession(userID int, clientID string, r *http.Request) (string, string, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := newRefreshToken(sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	var client interface{}
+	if clientID != "" {
+		client = clientID
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO sessions (id, user_id, refresh_token_hash, client_id, user_agent, ip_address, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, sessionID, userID, hashToken(refreshToken), client, r.UserAgent(), clientIP(r), sessionExpiry(userID))
+	if err != nil {
+		return "", "", err
+	}
+
+	return sessionID, refreshToken, nil
+}
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errSessionEnded        = errors.New("session has ended")
+	errWrongClient         = errors.New("refresh token was issued to another client")
+)
+
+// refreshTokenHandler exchanges a refresh token for a new access token and
+// a rotated refresh token. Replaying the previous refresh token revokes the
+// session.
+func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	user, sessionID, refreshToken, err := refreshSession(req.RefreshToken, "", r)
+	switch err {
+	case nil:
+	case errInvalidRefreshToken, errWrongClient:
+		httpkit.SendError(w, "Invalid refresh token", 401)
+		return
+	case errSessionEnded:
+		httpkit.SendError(w, "Session has ended", 401)
+		return
+	default:
+		log.Printf("Failed to refresh session: %v", err)
+		httpkit.SendError(w, "Failed to refresh session", 500)
+		return
+	}
+
+	token, err := generateToken(user, sessionID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to generate token", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(ACCESS_TOKEN_TTL.Seconds()),
+		User:         *user,
+	})
+}
+
+// refreshSession checks a refresh token and rotates it, returning the
+// session's user, the session ID and the new refresh token. clientID is
+// the OIDC client asking, or "" for the launcher. It returns
+// errInvalidRefreshToken, errSessionEnded or errWrongClient for tokens
+// that can't be used.
+func refreshSession(presented, clientID string, r *http.Request) (*User, string, string, error) {
+	sessionID, _, ok := strings.Cut(presented, ".")
+	if !ok || sessionID == "" {
+		return nil, "", "", errInvalidRefreshToken
+	}
+
+	var userID int
+	var storedHash string
+	var previousHash, storedClient sql.NullString
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT user_id, refresh_token_hash, previous_token_hash, client_id, expires_at, revoked_at
+		FROM sessions
+		WHERE id = ?
+	`, sessionID).Scan(&userID, &storedHash, &previousHash, &storedClient, &expiresAt, &revokedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, "", "", errInvalidRefreshToken
+	} else if err != nil {
+		return nil, "", "", err
+	}
+
+	if revokedAt.Valid || time.Now().After(expiresAt) || isUserDisabled(userID) {
+		return nil, "", "", errSessionEnded
+	}
+
+	presentedHash := hashToken(presented)
+	if subtle.ConstantTimeCompare([]byte(storedHash), []byte(presentedHash)) != 1 {
+		// Session IDs aren't secret, so only a replay of the token we last
+		// rotated away counts as theft; anything else is just a bad token
+		if previousHash.Valid && subtle.ConstantTimeCompare([]byte(previousHash.String), []byte(presentedHash)) == 1 {
+			log.Printf("⚠️  Refresh token reuse detected for session %s (user %d), revoking", sessionID, userID)
+			revokeSession(sessionID)
+		}
+		return nil, "", "", errInvalidRefreshToken
+	}
+
+	// A session only refreshes for the client it was issued to, so one
+	// app can't mint ID tokens for another with a token it got hold of
+	if storedClient.String != clientID {
+		return nil, "", "", errWrongClient
+	}
+
+	refreshToken, err := newRefreshToken(sessionID)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// Only rotate from the token just checked, so two refreshes racing with
+	// the same token can't both succeed
+	result, err := db.Exec(`
+		UPDATE sessions
+		SET refresh_token_hash = ?, previous_token_hash = refresh_token_hash,
+			last_used_at = CURRENT_TIMESTAMP, ip_address = ?
+		WHERE id = ? AND refresh_token_hash = ?
+	`, hashToken(refreshToken), clientIP(r), sessionID, presentedHash)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, "", "", errInvalidRefreshToken
+	}
+
+	var user User
+	err = db.QueryRow(`
+		SELECT id, email, name, is_admin, created_at
+		FROM users
+		WHERE id = ?
+	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.IsAdmin, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, "", "", errSessionEnded
+	} else if err != nil {
+		return nil, "", "", err
+	}
+
+	return &user, sessionID, refreshToken, nil
+}
+
+// logoutHandler revokes the session the request's token belongs to
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(*User)
+
+	if err := revokeSession(user.SessionID); err != nil {
+		httpkit.SendError(w, "Failed to end session", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Logged out",
+	})
+}
+
+// getSessionsHandler lists the current user's active sessions
+func getSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(*User)
+
+	rows, err := db.Query(`
+		SELECT id, user_agent, ip_address, created_at, last_used_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC
+	`, user.ID, time.Now().UTC())
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var userAgent, ipAddress sql.NullString
+		err := rows.Scan(&s.ID, &userAgent, &ipAddress, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt)
+		if err != nil {
+			continue
+		}
+		s.UserAgent = userAgent.String
+		s.IPAddress = ipAddress.String
+		s.Current = s.ID == user.SessionID
+		sessions = append(sessions, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// revokeSessionHandler revokes one of the current user's sessions,
+// e.g. the one on a lost phone
+func revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userContextKey).(*User)
+	sessionID := mux.Vars(r)["id"]
+
+	count, err := endSessions("id = ? AND user_id = ?", sessionID, user.ID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to revoke session", 500)
+		return
+	}
+
+	if count == 0 {
+		httpkit.SendError(w, "Session not found", 404)
+		return
+	}
+
+	log.Printf("🔒 User %d revoked session %s", user.ID, sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Session revoked",
+	})
+}
+
+// getRevokedSessionsHandler lists sessions revoked recently enough that
+// their access tokens may still be unexpired, so apps verifying tokens
+// locally can reject them (public endpoint - session IDs are not secrets)
+func getRevokedSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+		SELECT id FROM sessions
+		WHERE revoked_at IS NOT NULL AND revoked_at > ?
+	`, time.Now().UTC().Add(-ACCESS_TOKEN_TTL))
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	revoked := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			continue
+		}
+		revoked = append(revoked, id)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"revoked":     revoked,
+		"ttl_seconds": int(ACCESS_TOKEN_TTL.Seconds()),
+	})
+}
+
+// revokeSession marks a session as revoked
+func revokeSession(sessionID string) error {
+	_, err := endSessions("id = ?", sessionID)
+	return err
+}
+
+// revokeUserSessions ends every active session a user has
+func revokeUserSessions(userID int) error {
+	_, err := endSessions("user_id = ?", userID)
+	return err
+}
+
+// endSessions revokes the active sessions matching where and publishes a
+// session.revoked event to apps for each user affected. It returns how
+// many sessions were ended.
+func endSessions(where string, args ...interface{}) (int, error) {
+	rows, err := db.Query("SELECT id, user_id FROM sessions WHERE revoked_at IS NULL AND "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []interface{}
+	byUser := map[int][]string{}
+	for rows.Next() {
+		var id string
+		var userID int
+		if err := rows.Scan(&id, &userID); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+		byUser[userID] = append(byUser[userID], id)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	_, err = db.Exec(`
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id IN (`+placeholders+`) AND revoked_at IS NULL
+	`, ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	for userID, sessionIDs := range byUser {
+		publishEvent(auth.Event{Type: auth.EventSessionRevoked, UserID: userID, SessionIDs: sessionIDs})
+	}
+	return len(ids), nil
+}
+
+// isSessionActive reports whether a session exists, has not been revoked
+// or expired, and belongs to a user who is not disabled
+func isSessionActive(sessionID string) bool {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = ? AND s.revoked_at IS NULL AND s.expires_at > ?
+			AND u.disabled_at IS NULL
+	`, sessionID, time.Now().UTC()).Scan(&count)
+	return err == nil && count > 0
+}
+
+// newRefreshToken creates a refresh token bound to a session
+func newRefreshToken(sessionID string) (string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return sessionID + "." + secret, nil
+}
+
+// randomToken returns n random bytes, base64url encoded
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a token for storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP returns the remote IP of the request (without port)
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
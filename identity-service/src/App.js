@@ -9,6 +9,28 @@ const getApiBase = () => {
 
 const API_BASE = getApiBase();
 
+// WebAuthn sends binary fields as ArrayBuffers; the API uses base64url
+const fromBase64url = (value) => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const padded = base64 + '='.repeat((4 - base64.length % 4) % 4);
+  return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer;
+};
+
+const toBase64url = (buffer) => {
+  const bytes = String.fromCharCode(...new Uint8Array(buffer));
+  return btoa(bytes).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+};
+
+// Revoke the current session (best effort - logout proceeds regardless)
+const endSession = () => {
+  const token = localStorage.getItem('token');
+  if (token) {
+    axios.post(`${API_BASE}/logout`, {}, {
+      headers: { Authorization: `Bearer ${token}` }
+    }).catch(() => {});
+  }
+};
+
 function App() {
   const [view, setView] = useState('login');
   const [user, setUser] = useState(null);
@@ -16,11 +38,16 @@ function App() {
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
   const [serverInfo, setServerInfo] = useState(null);
+  const [pairing, setPairing] = useState(null);
+  const [venues, setVenues] = useState([]);
+  const [venueId, setVenueId] = useState(0);
   
   // Form states
   const [email, setEmail] = useState('');
   const [name, setName] = useState('');
   const [code, setCode] = useState('');
+  const [newCode, setNewCode] = useState('');
+  const [message, setMessage] = useState('');
   
   // QR code div ref (QRCode library needs a div, not canvas)
   const qrDivRef = useRef(null);
@@ -30,14 +57,55 @@ function App() {
   useEffect(() => {
     const urlParams = new URLSearchParams(window.location.search);
     if (urlParams.get('logout') === 'true') {
+      endSession();
       localStorage.removeItem('user');
       localStorage.removeItem('token');
+      localStorage.removeItem('refreshToken');
       setUser(null);
       setView('login');
       window.history.replaceState({}, document.title, window.location.pathname);
       return;
     }
 
+    // An app sent the user here to sign in (OAuth authorization request).
+    // Finished once they're logged in - see the effect below.
+    const oauthRequest = urlParams.get('oauth');
+    if (oauthRequest) {
+      sessionStorage.setItem('oauthRequest', oauthRequest);
+      window.history.replaceState({}, document.title, window.location.pathname);
+    }
+
+    // Scanned a pairing QR code from another device
+    const pairToken = urlParams.get('pair');
+    if (pairToken) {
+      window.history.replaceState({}, document.title, window.location.pathname);
+      axios.post(`${API_BASE}/pairing/exchange`, { token: pairToken })
+        .then(response => {
+          const { token, refresh_token, user: userData } = response.data;
+          setUser(userData);
+          localStorage.setItem('user', JSON.stringify(userData));
+          localStorage.setItem('token', token);
+          localStorage.setItem('refreshToken', refresh_token);
+          setView('landing');
+        })
+        .catch(err => {
+          setError(err.response?.data?.error || 'Pairing failed');
+        });
+      return;
+    }
+
+    // Each pub links to the launcher with ?venue=<slug>; new accounts and
+    // guests join that venue
+    const venueSlug = urlParams.get('venue');
+    axios.get(`${API_BASE}/venues`)
+      .then(response => {
+        const list = response.data || [];
+        setVenues(list);
+        const match = list.find(v => v.slug === venueSlug);
+        if (match) setVenueId(match.id);
+      })
+      .catch(() => {});
+
     const savedUser = localStorage.getItem('user');
     const savedToken = localStorage.getItem('token');
     if (savedUser && savedToken) {
@@ -48,10 +116,35 @@ function App() {
       } catch (e) {
         localStorage.removeItem('user');
         localStorage.removeItem('token');
+        localStorage.removeItem('refreshToken');
       }
     }
   }, []);
 
+  // Complete a pending app sign-in as soon as the user is logged in
+  useEffect(() => {
+    const pending = sessionStorage.getItem('oauthRequest');
+    if (!pending || !user || view !== 'landing') return;
+    sessionStorage.removeItem('oauthRequest');
+
+    const completeAppSignIn = async () => {
+      const token = await refreshToken();
+      if (!token) return;
+
+      try {
+        const request = Object.fromEntries(new URLSearchParams(pending));
+        const response = await axios.post(`${API_BASE}/oauth/authorize`, request, {
+          headers: { Authorization: `Bearer ${token}` }
+        });
+        window.location.href = response.data.redirect_to;
+      } catch (err) {
+        setError(err.response?.data?.error || 'Could not sign you in to the app');
+      }
+    };
+
+    completeAppSignIn();
+  }, [user, view]); // eslint-disable-line react-hooks/exhaustive-deps
+
   // Load server info for QR code
   useEffect(() => {
     let isMounted = true;
@@ -114,7 +207,9 @@ function App() {
     if (user && view === 'landing') {
       const loadApps = async () => {
         try {
-          const response = await axios.get(`${API_BASE}/apps`);
+          const response = await axios.get(`${API_BASE}/apps`, {
+            params: { venue_id: user.venue_id }
+          });
           if (isMounted) {
             setApps(response.data || []);
           }
@@ -141,11 +236,12 @@ function App() {
         code
       });
 
-      const { token, user: userData } = response.data;
+      const { token, refresh_token, user: userData } = response.data;
       
       setUser(userData);
       localStorage.setItem('user', JSON.stringify(userData));
       localStorage.setItem('token', token);
+      localStorage.setItem('refreshToken', refresh_token);
       setCode(''); // Clear code for security
       setView('landing');
     } catch (err) {
@@ -155,6 +251,55 @@ function App() {
     }
   };
 
+  // Email a one-time login code to the address in the login form
+  const handleRequestEmailCode = async () => {
+    if (!email) {
+      setError('Enter your email first');
+      return;
+    }
+    setError('');
+    setMessage('');
+    setLoading(true);
+
+    try {
+      const response = await axios.post(`${API_BASE}/login/email`, { email });
+      setMessage(response.data.message);
+      setCode('');
+      setView('email-code');
+    } catch (err) {
+      setError(err.response?.data?.error || 'Could not send a code');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleEmailCodeLogin = async (e) => {
+    e.preventDefault();
+    setError('');
+    setLoading(true);
+
+    try {
+      const response = await axios.post(`${API_BASE}/login/email/verify`, {
+        email,
+        code
+      });
+
+      const { token, refresh_token, user: userData } = response.data;
+
+      setUser(userData);
+      localStorage.setItem('user', JSON.stringify(userData));
+      localStorage.setItem('token', token);
+      localStorage.setItem('refreshToken', refresh_token);
+      setCode(''); // Clear code for security
+      setMessage('');
+      setView('landing');
+    } catch (err) {
+      setError(err.response?.data?.error || 'Login failed');
+    } finally {
+      setLoading(false);
+    }
+  };
+
   const handleRegister = async (e) => {
     e.preventDefault();
     setError('');
@@ -165,7 +310,7 @@ function App() {
         email,
         name,
         code,
-        is_admin: false
+        venue_id: venueId
       });
 
       // Auto-login after registration
@@ -174,11 +319,12 @@ function App() {
         code
       });
 
-      const { token, user: userData } = response.data;
+      const { token, refresh_token, user: userData } = response.data;
       
       setUser(userData);
       localStorage.setItem('user', JSON.stringify(userData));
       localStorage.setItem('token', token);
+      localStorage.setItem('refreshToken', refresh_token);
       setCode(''); // Clear code for security
       setView('landing');
     } catch (err) {
@@ -188,9 +334,208 @@ function App() {
     }
   };
 
+  // Guests get a generated name and a short-lived account, no sign-up needed
+  const handleGuestLogin = async () => {
+    setError('');
+    setLoading(true);
+
+    try {
+      const response = await axios.post(`${API_BASE}/guest`, { venue_id: venueId });
+      const { token, refresh_token, user: userData } = response.data;
+
+      setUser(userData);
+      localStorage.setItem('user', JSON.stringify(userData));
+      localStorage.setItem('token', token);
+      localStorage.setItem('refreshToken', refresh_token);
+      setView('landing');
+    } catch (err) {
+      setError(err.response?.data?.error || 'Could not start a guest session');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  // Turn the guest into a full account, keeping what they've played
+  const handleUpgrade = async (e) => {
+    e.preventDefault();
+    setError('');
+    setLoading(true);
+
+    try {
+      const response = await axios.post(`${API_BASE}/guest/upgrade`, { name, email, code }, {
+        headers: { Authorization: `Bearer ${localStorage.getItem('token')}` }
+      });
+      const { token, user: userData } = response.data;
+      setUser(userData);
+      localStorage.setItem('user', JSON.stringify(userData));
+      localStorage.setItem('token', token);
+      setCode('');
+      setView('landing');
+    } catch (err) {
+      setError(err.response?.data?.error || 'Failed to create account');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const openUpgrade = () => {
+    setName(user.name);
+    setEmail('');
+    setCode('');
+    setError('');
+    setView('upgrade');
+  };
+
+  const handlePasskeyLogin = async () => {
+    setError('');
+    setLoading(true);
+
+    try {
+      const begin = await axios.post(`${API_BASE}/passkey/login/begin`, email ? { email } : {});
+      const options = begin.data.options.publicKey;
+      options.challenge = fromBase64url(options.challenge);
+      (options.allowCredentials || []).forEach(c => { c.id = fromBase64url(c.id); });
+
+      const credential = await navigator.credentials.get({ publicKey: options });
+
+      const response = await axios.post(`${API_BASE}/passkey/login/finish`, {
+        ceremony_id: begin.data.ceremony_id,
+        credential: {
+          id: credential.id,
+          rawId: toBase64url(credential.rawId),
+          type: credential.type,
+          response: {
+            clientDataJSON: toBase64url(credential.response.clientDataJSON),
+            authenticatorData: toBase64url(credential.response.authenticatorData),
+            signature: toBase64url(credential.response.signature),
+            userHandle: credential.response.userHandle ? toBase64url(credential.response.userHandle) : undefined
+          }
+        }
+      });
+
+      const { token, refresh_token, user: userData } = response.data;
+
+      setUser(userData);
+      localStorage.setItem('user', JSON.stringify(userData));
+      localStorage.setItem('token', token);
+      localStorage.setItem('refreshToken', refresh_token);
+      setView('landing');
+    } catch (err) {
+      setError(err.response?.data?.error || 'Passkey login failed');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handlePasskeySetup = async () => {
+    const token = localStorage.getItem('token');
+    const headers = { Authorization: `Bearer ${token}` };
+
+    try {
+      const begin = await axios.post(`${API_BASE}/passkey/register/begin`, {}, { headers });
+      const options = begin.data.options.publicKey;
+      options.challenge = fromBase64url(options.challenge);
+      options.user.id = fromBase64url(options.user.id);
+      (options.excludeCredentials || []).forEach(c => { c.id = fromBase64url(c.id); });
+
+      const credential = await navigator.credentials.create({ publicKey: options });
+
+      await axios.post(`${API_BASE}/passkey/register/finish`, {
+        ceremony_id: begin.data.ceremony_id,
+        credential: {
+          id: credential.id,
+          rawId: toBase64url(credential.rawId),
+          type: credential.type,
+          response: {
+            clientDataJSON: toBase64url(credential.response.clientDataJSON),
+            attestationObject: toBase64url(credential.response.attestationObject),
+            transports: credential.response.getTransports ? credential.response.getTransports() : []
+          }
+        }
+      }, { headers });
+
+      alert('Passkey set up - you can now log in without your code on this device');
+    } catch (err) {
+      alert(err.response?.data?.error || 'Passkey setup failed');
+    }
+  };
+
+  // Show a one-time QR code another device can scan to log in as this user
+  const handlePairDevice = async () => {
+    try {
+      const response = await axios.post(`${API_BASE}/pairing`, {}, {
+        headers: { Authorization: `Bearer ${localStorage.getItem('token')}` }
+      });
+      setPairing(response.data);
+    } catch (err) {
+      alert(err.response?.data?.error || 'Could not create pairing code');
+    }
+  };
+
+  // Save name/email changes; changing email needs the current code
+  const handleProfileSave = async (e) => {
+    e.preventDefault();
+    setError('');
+    setMessage('');
+    setLoading(true);
+
+    try {
+      const response = await axios.put(`${API_BASE}/user`, { name, email, code }, {
+        headers: { Authorization: `Bearer ${localStorage.getItem('token')}` }
+      });
+      const { token, user: userData } = response.data;
+      setUser(userData);
+      localStorage.setItem('user', JSON.stringify(userData));
+      localStorage.setItem('token', token);
+      setCode('');
+      setMessage('Profile updated');
+    } catch (err) {
+      setError(err.response?.data?.error || 'Failed to update profile');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleCodeChange = async (e) => {
+    e.preventDefault();
+    setError('');
+    setMessage('');
+    setLoading(true);
+
+    try {
+      const response = await axios.put(`${API_BASE}/user/code`, {
+        current_code: code,
+        new_code: newCode
+      }, {
+        headers: { Authorization: `Bearer ${localStorage.getItem('token')}` }
+      });
+      setCode('');
+      setNewCode('');
+      setMessage(response.data.message);
+    } catch (err) {
+      setError(err.response?.data?.error || 'Failed to change code');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const openAccount = () => {
+    setName(user.name);
+    setEmail(user.email);
+    setCode('');
+    setNewCode('');
+    setError('');
+    setMessage('');
+    setView('account');
+  };
+
   const handleLogout = () => {
+    // Revoke the session server-side so apps stop accepting the token
+    endSession();
+
     // Clean up all state
     setApps([]);
+    setPairing(null);
     setUser(null);
     setEmail('');
     setName('');
@@ -200,14 +545,46 @@ function App() {
     // Clear storage
     localStorage.removeItem('user');
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     
     // Switch to login view
     setView('login');
   };
 
-  const launchApp = (app) => {
-    const token = localStorage.getItem('token');
+  // Get a fresh access token before handing it to an app, since apps
+  // can't refresh tokens themselves
+  const refreshToken = async () => {
+    const refresh = localStorage.getItem('refreshToken');
+    if (!refresh) {
+      return localStorage.getItem('token');
+    }
+
+    try {
+      const response = await axios.post(`${API_BASE}/token/refresh`, {
+        refresh_token: refresh
+      });
+      localStorage.setItem('token', response.data.token);
+      localStorage.setItem('refreshToken', response.data.refresh_token);
+      return response.data.token;
+    } catch (err) {
+      // Session revoked or expired - back to login
+      handleLogout();
+      return null;
+    }
+  };
+
+  const launchApp = async (app) => {
+    const token = await refreshToken();
     if (token) {
+      // Record the launch for analytics; never block the player on it
+      try {
+        await axios.post(`${API_BASE}/apps/${app.id}/launch`, {}, {
+          headers: { Authorization: `Bearer ${token}` }
+        });
+      } catch (err) {
+        console.error('Failed to record launch:', err);
+      }
+
       // Replace localhost with current hostname for mobile support
       const hostname = window.location.hostname;
       const dynamicUrl = app.url.replace('localhost', hostname);
@@ -280,13 +657,33 @@ function App() {
                 {loading ? 'Logging in...' : 'Login'}
               </button>
             </form>
+
+            {window.PublicKeyCredential && (
+              <div style={styles.switchView}>
+                <button onClick={handlePasskeyLogin} style={styles.linkButton} disabled={loading}>
+                  🔐 Log in with a passkey
+                </button>
+              </div>
+            )}
             
+            <div style={styles.switchView}>
+              <button onClick={handleRequestEmailCode} style={styles.linkButton} disabled={loading}>
+                📧 Email me a login code
+              </button>
+            </div>
+
             <div style={styles.switchView}>
               Don't have an account?{' '}
               <button onClick={() => { setView('register'); setError(''); }} style={styles.linkButton}>
                 Register
               </button>
             </div>
+
+            <div style={styles.switchView}>
+              <button onClick={handleGuestLogin} style={styles.linkButton} disabled={loading}>
+                🎟️ Just play as a guest
+              </button>
+            </div>
           </div>
         </div>
 
@@ -302,6 +699,54 @@ function App() {
     );
   }
 
+  // Emailed Code View
+  if (view === 'email-code') {
+    return (
+      <div style={styles.container}>
+        <div style={styles.formCard}>
+          <h1 style={styles.title}>🎮 PubGames</h1>
+          <h2 style={styles.subtitle}>Check Your Email</h2>
+
+          {error && <div style={styles.error}>{error}</div>}
+          {message && <div style={styles.success}>{message}</div>}
+
+          <form onSubmit={handleEmailCodeLogin}>
+            <div style={styles.formGroup}>
+              <label style={styles.label}>Code sent to {email}</label>
+              <input
+                type="text"
+                inputMode="numeric"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                required
+                maxLength={6}
+                style={styles.input}
+                placeholder="123456"
+                autoComplete="one-time-code"
+              />
+            </div>
+
+            <button type="submit" style={styles.button} disabled={loading}>
+              {loading ? 'Logging in...' : 'Login'}
+            </button>
+          </form>
+
+          <div style={styles.switchView}>
+            <button onClick={handleRequestEmailCode} style={styles.linkButton} disabled={loading}>
+              Send a new code
+            </button>
+          </div>
+
+          <div style={styles.switchView}>
+            <button onClick={() => { setView('login'); setError(''); setMessage(''); setCode(''); }} style={styles.linkButton}>
+              Back to login
+            </button>
+          </div>
+        </div>
+      </div>
+    );
+  }
+
   // Register View
   if (view === 'register') {
     return (
@@ -353,6 +798,22 @@ function App() {
               />
               <small style={styles.hint}>Choose a 6-character code for login</small>
             </div>
+
+            {venues.length > 1 && (
+              <div style={styles.formGroup}>
+                <label style={styles.label}>Your Pub</label>
+                <select
+                  value={venueId}
+                  onChange={(e) => setVenueId(Number(e.target.value))}
+                  style={styles.input}
+                >
+                  <option value={0}>Choose your pub...</option>
+                  {venues.map(v => (
+                    <option key={v.id} value={v.id}>{v.name}</option>
+                  ))}
+                </select>
+              </div>
+            )}
             
             <button type="submit" style={styles.button} disabled={loading}>
               {loading ? 'Creating account...' : 'Register'}
@@ -385,6 +846,17 @@ function App() {
             </button>
           </header>
 
+          {error && <div style={styles.error}>{error}</div>}
+
+          {user.is_guest && (
+            <div style={styles.guestBanner}>
+              You're playing as a guest - create an account to keep your games.{' '}
+              <button onClick={openUpgrade} style={styles.linkButton}>
+                Create account
+              </button>
+            </div>
+          )}
+
           <div style={styles.appsSection}>
             <h2 style={styles.sectionTitle}>Available Apps</h2>
             
@@ -395,22 +867,67 @@ function App() {
               </div>
             ) : (
               <div style={styles.appsGrid}>
-                {apps.map(app => (
-                  <div 
-                    key={app.id} 
-                    style={styles.appCard}
-                    onClick={() => launchApp(app)}
-                  >
-                    <div style={styles.appIcon}>{app.icon}</div>
-                    <h3 style={styles.appName}>{app.name}</h3>
-                    <p style={styles.appDescription}>{app.description}</p>
-                    <div style={styles.launchButton}>Launch →</div>
-                  </div>
-                ))}
+                {apps.map(app => {
+                  // Apps the health prober can't reach are shown but not launchable
+                  const isDown = app.health?.status === 'down';
+                  return (
+                    <div 
+                      key={app.id} 
+                      style={isDown ? { ...styles.appCard, ...styles.appCardDown } : styles.appCard}
+                      onClick={() => !isDown && launchApp(app)}
+                    >
+                      <div style={styles.appIcon}>{app.icon}</div>
+                      <h3 style={styles.appName}>{app.name}</h3>
+                      <p style={styles.appDescription}>{app.description}</p>
+                      {isDown ? (
+                        <div style={styles.unavailableBadge}>Temporarily unavailable</div>
+                      ) : (
+                        <div style={styles.launchButton}>Launch →</div>
+                      )}
+                    </div>
+                  );
+                })}
+              </div>
+            )}
+          </div>
+
+          {!user.is_guest && (
+            <div style={styles.switchView}>
+              <button onClick={openAccount} style={styles.linkButton}>
+                ⚙️ Account settings
+              </button>
+            </div>
+          )}
+
+          <div style={styles.switchView}>
+            {pairing ? (
+              <div>
+                <img
+                  src={`${API_BASE}/pairing/${pairing.token}/qr.svg`}
+                  alt="Pairing QR code"
+                  width={200}
+                  height={200}
+                />
+                <p>Scan with your phone to log in (expires in {Math.round(pairing.expires_in / 60)} min)</p>
+                <button onClick={() => setPairing(null)} style={styles.linkButton}>
+                  Done
+                </button>
               </div>
+            ) : (
+              <button onClick={handlePairDevice} style={styles.linkButton}>
+                📱 Log in on another device
+              </button>
             )}
           </div>
 
+          {window.PublicKeyCredential && !user.is_guest && (
+            <div style={styles.switchView}>
+              <button onClick={handlePasskeySetup} style={styles.linkButton}>
+                🔐 Set up a passkey on this device
+              </button>
+            </div>
+          )}
+
           {user.is_admin && (
             <div style={styles.adminBadge}>
               <span>👑 Admin User</span>
@@ -421,6 +938,173 @@ function App() {
     );
   }
 
+  // Guest upgrade View
+  if (view === 'upgrade' && user) {
+    return (
+      <div style={styles.container}>
+        <div style={styles.formCard}>
+          <h1 style={styles.title}>🎮 PubGames</h1>
+          <h2 style={styles.subtitle}>Create your account</h2>
+
+          {error && <div style={styles.error}>{error}</div>}
+
+          <form onSubmit={handleUpgrade}>
+            <div style={styles.formGroup}>
+              <label style={styles.label}>Name</label>
+              <input
+                type="text"
+                value={name}
+                onChange={(e) => setName(e.target.value)}
+                required
+                style={styles.input}
+                autoComplete="name"
+              />
+            </div>
+
+            <div style={styles.formGroup}>
+              <label style={styles.label}>Email</label>
+              <input
+                type="email"
+                value={email}
+                onChange={(e) => setEmail(e.target.value)}
+                required
+                style={styles.input}
+                placeholder="your@email.com"
+                autoComplete="email"
+              />
+            </div>
+
+            <div style={styles.formGroup}>
+              <label style={styles.label}>6-Character Code</label>
+              <input
+                type="password"
+                value={code}
+                onChange={(e) => setCode(e.target.value.slice(0, 6))}
+                required
+                maxLength={6}
+                style={styles.input}
+                placeholder="******"
+                autoComplete="new-password"
+              />
+              <small style={styles.hint}>Your games so far stay with your new account</small>
+            </div>
+
+            <button type="submit" style={styles.button} disabled={loading}>
+              {loading ? 'Creating account...' : 'Create account'}
+            </button>
+          </form>
+
+          <div style={styles.switchView}>
+            <button onClick={() => { setView('landing'); setError(''); }} style={styles.linkButton}>
+              ← Back to apps
+            </button>
+          </div>
+        </div>
+      </div>
+    );
+  }
+
+  // Account settings View
+  if (view === 'account' && user) {
+    const emailChanged = email.trim().toLowerCase() !== user.email.toLowerCase();
+
+    return (
+      <div style={styles.container}>
+        <div style={styles.formCard}>
+          <h1 style={styles.title}>🎮 PubGames</h1>
+          <h2 style={styles.subtitle}>Your Account</h2>
+
+          {error && <div style={styles.error}>{error}</div>}
+          {message && <div style={styles.success}>{message}</div>}
+
+          <form onSubmit={handleProfileSave}>
+            <div style={styles.formGroup}>
+              <label style={styles.label}>Name</label>
+              <input
+                type="text"
+                value={name}
+                onChange={(e) => setName(e.target.value)}
+                required
+                style={styles.input}
+              />
+            </div>
+
+            <div style={styles.formGroup}>
+              <label style={styles.label}>Email</label>
+              <input
+                type="email"
+                value={email}
+                onChange={(e) => setEmail(e.target.value)}
+                required
+                style={styles.input}
+              />
+              <small style={styles.hint}>Your game history moves with you when you change email</small>
+            </div>
+
+            {emailChanged && (
+              <div style={styles.formGroup}>
+                <label style={styles.label}>Current Code</label>
+                <input
+                  type="password"
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                  required
+                  maxLength={6}
+                  style={styles.input}
+                  autoComplete="current-password"
+                />
+              </div>
+            )}
+
+            <button type="submit" style={styles.button} disabled={loading}>
+              Save Profile
+            </button>
+          </form>
+
+          <h2 style={{ ...styles.subtitle, marginTop: '30px' }}>Change Code</h2>
+          <form onSubmit={handleCodeChange}>
+            <div style={styles.formGroup}>
+              <label style={styles.label}>Current Code</label>
+              <input
+                type="password"
+                value={emailChanged ? '' : code}
+                onChange={(e) => setCode(e.target.value)}
+                required
+                maxLength={6}
+                style={styles.input}
+                autoComplete="current-password"
+              />
+            </div>
+
+            <div style={styles.formGroup}>
+              <label style={styles.label}>New 6-Character Code</label>
+              <input
+                type="password"
+                value={newCode}
+                onChange={(e) => setNewCode(e.target.value)}
+                required
+                minLength={6}
+                maxLength={6}
+                style={styles.input}
+                autoComplete="new-password"
+              />
+            </div>
+
+            <button type="submit" style={styles.button} disabled={loading || emailChanged}>
+              Change Code
+            </button>
+          </form>
+
+          <div style={styles.switchView}>
+            <button onClick={() => { setView('landing'); setError(''); setMessage(''); }} style={styles.linkButton}>
+              ← Back to apps
+            </button>
+          </div>
+        </div>
+      </div>
+    );
+  }
+
   // Fallback
   return null;
 }
@@ -595,6 +1279,24 @@ const styles = {
     fontSize: '14px',
     padding: 0
   },
+  success: {
+    padding: '12px',
+    marginBottom: '20px',
+    backgroundColor: '#efe',
+    border: '1px solid #cfc',
+    borderRadius: '8px',
+    color: '#2a7a2a',
+    fontSize: '14px'
+  },
+  guestBanner: {
+    padding: '12px',
+    marginBottom: '20px',
+    backgroundColor: '#fff8e1',
+    border: '1px solid #ffe082',
+    borderRadius: '8px',
+    color: '#7a5b00',
+    fontSize: '14px'
+  },
   error: {
     padding: '12px',
     marginBottom: '20px',
@@ -674,6 +1376,18 @@ const styles = {
     fontWeight: '600',
     fontSize: '14px'
   },
+  appCardDown: {
+    opacity: 0.6,
+    cursor: 'not-allowed'
+  },
+  unavailableBadge: {
+    padding: '10px',
+    backgroundColor: '#6c757d',
+    color: 'white',
+    borderRadius: '8px',
+    fontWeight: '600',
+    fontSize: '14px'
+  },
   noApps: {
     textAlign: 'center',
     padding: '60px 20px',
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"pubgames/shared/httpkit"
+)
+
+// Login throttling: failed attempts are counted per account and per client
+// IP. Past a number of free attempts each further failure locks the key
+// out for twice as long as the last, up to a maximum. Counters live in
+// SQLite so a restart doesn't reset them.
+
+const (
+	// Per-account limit - a 6-character code is easy to guess without one
+	ACCOUNT_FREE_ATTEMPTS = 5
+	// Per-IP limit is looser since everyone on the pub Wi-Fi shares an IP
+	IP_FREE_ATTEMPTS = 30
+
+	LOCKOUT_BASE = 30 * time.Second
+	LOCKOUT_MAX  = 1 * time.Hour
+
+	// Failure counts reset after this long without a failure
+	LOCKOUT_RESET_AFTER = 24 * time.Hour
+)
+
+// Lockout is a throttled account or IP as shown to admins
+type Lockout struct {
+	ID            int        `json:"id"`
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	Locked        bool       `json:"locked"`
+}
+
+// throttleKeys returns the attempt counter keys for a login
+func throttleKeys(email string, r *http.Request) (string, string) {
+	return "account:" + strings.ToLower(strings.TrimSpace(email)), "ip:" + clientIP(r)
+}
+
+// checkLoginThrottle reports how long the caller must wait before trying
+// again, or zero if neither the account nor the IP is locked out
+func checkLoginThrottle(keys ...string) time.Duration {
+	now := time.Now().UTC()
+	var wait time.Duration
+
+	for _, key := range keys {
+		var lockedUntil sql.NullTime
+		err := db.QueryRow("SELECT locked_until FROM login_attempts WHERE key = ?", key).Scan(&lockedUntil)
+		if err != nil || !lockedUntil.Valid {
+			continue
+		}
+		if remaining := lockedUntil.Time.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	return wait
+}
+
+// recordLoginFailure counts a failed attempt against a key and locks it
+// out once it has used its free attempts. The count is incremented in one
+// statement so concurrent failures can't overwrite each other.
+func recordLoginFailure(key string, freeAttempts int) {
+	now := time.Now().UTC()
+
+	var failures int
+	err := db.QueryRow(`
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures
+	`, key, now, now.Add(-LOCKOUT_RESET_AFTER)).Scan(&failures)
+	if err != nil {
+		log.Printf("Warning: Could not record login failure for %s: %v", key, err)
+		return
+	}
+
+	// freeAttempts failures are allowed; the lockout starts with the next
+	if failures <= freeAttempts {
+		return
+	}
+	duration := lockoutDuration(failures - freeAttempts - 1)
+
+	// Only the latest failure sets the lockout, so a slower concurrent
+	// request can't shorten it
+	_, err = db.Exec("UPDATE login_attempts SET locked_until = ? WHERE key = ? AND failures = ?",
+		now.Add(duration), key, failures)
+	if err != nil {
+		log.Printf("Warning: Could not lock %s: %v", key, err)
+		return
+	}
+	log.Printf("🔒 Login locked for %s after %d failures (%s)", key, failures, duration)
+}
+
+// clearLoginFailures resets the counter for a key after a successful login
+func clearLoginFailures(key string) {
+	if _, err := db.Exec("DELETE FROM login_attempts WHERE key = ?", key); err != nil {
+		log.Printf("Warning: Could not clear login attempts for %s: %v", key, err)
+	}
+}
+
+// lockoutDuration doubles from LOCKOUT_BASE for each failure past the
+// free attempts, capped at LOCKOUT_MAX
+func lockoutDuration(excess int) time.Duration {
+	d := float64(LOCKOUT_BASE) * math.Pow(2, float64(excess))
+	if d > float64(LOCKOUT_MAX) {
+		return LOCKOUT_MAX
+	}
+	return time.Duration(d)
+}
+
+// takeRateLimit counts a request against a fixed window of the given
+// length and returns how long to wait if the key has already made limit
+// requests in the current window. Unlike login lockouts this never
+// escalates, so a busy shared IP is only ever held up until the next window.
+func takeRateLimit(key string, limit int, window time.Duration) time.Duration {
+	now := time.Now().UTC()
+	windowStart := now.Truncate(window)
+
+	var count int
+	err := db.QueryRow(`
+		INSERT INTO rate_limits (key, window_start, count)
+		VALUES (?, ?, 1)
+		ON CONFLICT(key) DO UPDATE SET
+			count = CASE WHEN window_start = excluded.window_start THEN count + 1 ELSE 1 END,
+			window_start = excluded.window_start
+		RETURNING count
+	`, key, windowStart).Scan(&count)
+	if err != nil {
+		// Fail open: a broken counter shouldn't stop anyone playing
+		log.Printf("Warning: Could not check rate limit for %s: %v", key, err)
+		return 0
+	}
+
+	if count <= limit {
+		return 0
+	}
+	return windowStart.Add(window).Sub(now)
+}
+
+// sendThrottled responds 429 with a Retry-After header
+func sendThrottled(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	retry := fmt.Sprintf("%d seconds", seconds)
+	if seconds > 60 {
+		retry = fmt.Sprintf("%d minutes", (seconds+59)/60)
+	}
+	httpkit.SendError(w, "Too many failed attempts. Try again in "+retry, http.StatusTooManyRequests)
+}
+
+// getLockoutsHandler lists accounts and IPs with failed attempts (admin only)
+func getLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+		SELECT id, key, failures, last_failure_at, locked_until
+		FROM login_attempts
+		ORDER BY last_failure_at DESC
+	`)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	lockouts := []Lockout{}
+	for rows.Next() {
+		var l Lockout
+		var lockedUntil sql.NullTime
+		if err := rows.Scan(&l.ID, &l.Key, &l.Failures, &l.LastFailureAt, &lockedUntil); err != nil {
+			continue
+		}
+		if lockedUntil.Valid {
+			l.LockedUntil = &lockedUntil.Time
+			l.Locked = now.Before(lockedUntil.Time)
+		}
+		lockouts = append(lockouts, l)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lockouts)
+}
+
+// clearLockoutHandler removes a lockout and its failure count (admin only)
+func clearLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	result, err := db.Exec("DELETE FROM login_attempts WHERE id = ?", id)
+	if err != nil {
+		httpkit.SendError(w, "Failed to clear lockout", 500)
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		httpkit.SendError(w, "Lockout not found", 404)
+		return
+	}
+
+	admin := r.Context().Value(userContextKey).(*User)
+	lockoutID, _ := strconv.Atoi(id)
+	recordAudit(r, "lockout.clear", "lockout", lockoutID, nil)
+	log.Printf("🔓 Lockout %s cleared by user %d", id, admin.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Lockout cleared",
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTestDB points db at a fresh database holding the throttle tables
+func useTestDB(t *testing.T) {
+	t.Helper()
+	testDB, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "identity.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = testDB.Exec(`
+		CREATE TABLE login_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			key TEXT UNIQUE NOT NULL,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_failure_at TIMESTAMP NOT NULL,
+			locked_until TIMESTAMP
+		);
+		CREATE TABLE rate_limits (
+			key TEXT PRIMARY KEY,
+			window_start TIMESTAMP NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0
+		);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := db
+	db = testDB
+	t.Cleanup(func() {
+		db = previous
+		testDB.Close()
+	})
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		excess int
+		want   time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, LOCKOUT_MAX},
+		{50, LOCKOUT_MAX},
+		{5000, LOCKOUT_MAX},
+	}
+
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.excess); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.excess, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleKeys(t *testing.T) {
+	tests := []struct {
+		email      string
+		remoteAddr string
+		wantAcct   string
+		wantIP     string
+	}{
+		{"player@example.com", "192.168.1.20:51234", "account:player@example.com", "ip:192.168.1.20"},
+		{"  Player@Example.COM ", "192.168.1.20:51234", "account:player@example.com", "ip:192.168.1.20"},
+		{"", "[fd00::1]:443", "account:", "ip:fd00::1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/login", nil)
+		r.RemoteAddr = tt.remoteAddr
+		acct, ip := throttleKeys(tt.email, r)
+		if acct != tt.wantAcct || ip != tt.wantIP {
+			t.Errorf("throttleKeys(%q, %s) = %q, %q, want %q, %q", tt.email, tt.remoteAddr, acct, ip, tt.wantAcct, tt.wantIP)
+		}
+	}
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		freeAttempts int
+		failures     int
+		wantLocked   bool
+		wantWait     time.Duration
+	}{
+		{"one failure", ACCOUNT_FREE_ATTEMPTS, 1, false, 0},
+		{"all free attempts used", ACCOUNT_FREE_ATTEMPTS, ACCOUNT_FREE_ATTEMPTS, false, 0},
+		{"first failure past the free ones", ACCOUNT_FREE_ATTEMPTS, ACCOUNT_FREE_ATTEMPTS + 1, true, LOCKOUT_BASE},
+		{"lockout doubles", ACCOUNT_FREE_ATTEMPTS, ACCOUNT_FREE_ATTEMPTS + 3, true, 4 * LOCKOUT_BASE},
+		{"lockout is capped", ACCOUNT_FREE_ATTEMPTS, ACCOUNT_FREE_ATTEMPTS + 20, true, LOCKOUT_MAX},
+		{"IPs get more attempts", IP_FREE_ATTEMPTS, ACCOUNT_FREE_ATTEMPTS + 1, false, 0},
+		{"IPs are locked too", IP_FREE_ATTEMPTS, IP_FREE_ATTEMPTS + 1, true, LOCKOUT_BASE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			const key = "account:player@example.com"
+
+			for i := 0; i < tt.failures; i++ {
+				recordLoginFailure(key, tt.freeAttempts)
+			}
+
+			wait := checkLoginThrottle(key)
+			if locked := wait > 0; locked != tt.wantLocked {
+				t.Fatalf("locked = %v after %d failures, want %v", locked, tt.failures, tt.wantLocked)
+			}
+			// Allow for the time the test itself takes
+			if tt.wantLocked && (wait > tt.wantWait || wait < tt.wantWait-5*time.Second) {
+				t.Errorf("wait = %v, want about %v", wait, tt.wantWait)
+			}
+			if other := checkLoginThrottle("account:someone-else@example.com"); other != 0 {
+				t.Errorf("another account must wait %v, want 0", other)
+			}
+		})
+	}
+}
+
+func TestCheckLoginThrottleTakesLongestWait(t *testing.T) {
+	useTestDB(t)
+	accountKey, ipKey := "account:player@example.com", "ip:192.168.1.20"
+
+	for i := 0; i < ACCOUNT_FREE_ATTEMPTS+2; i++ {
+		recordLoginFailure(accountKey, ACCOUNT_FREE_ATTEMPTS)
+	}
+	for i := 0; i < IP_FREE_ATTEMPTS+1; i++ {
+		recordLoginFailure(ipKey, IP_FREE_ATTEMPTS)
+	}
+
+	// The account is locked for 2 * LOCKOUT_BASE, the IP for LOCKOUT_BASE
+	wait := checkLoginThrottle(accountKey, ipKey)
+	if wait <= LOCKOUT_BASE || wait > 2*LOCKOUT_BASE {
+		t.Errorf("wait = %v, want the account's longer lockout", wait)
+	}
+}
+
+func TestLoginFailuresClearAndExpire(t *testing.T) {
+	useTestDB(t)
+	const key = "account:player@example.com"
+
+	for i := 0; i < ACCOUNT_FREE_ATTEMPTS+1; i++ {
+		recordLoginFailure(key, ACCOUNT_FREE_ATTEMPTS)
+	}
+	if checkLoginThrottle(key) == 0 {
+		t.Fatal("not locked after using the free attempts")
+	}
+
+	// A successful login clears the count
+	clearLoginFailures(key)
+	if wait := checkLoginThrottle(key); wait != 0 {
+		t.Fatalf("still locked for %v after clearing", wait)
+	}
+	recordLoginFailure(key, ACCOUNT_FREE_ATTEMPTS)
+	if wait := checkLoginThrottle(key); wait != 0 {
+		t.Errorf("locked for %v by the first failure after clearing", wait)
+	}
+
+	// Old failures stop counting after LOCKOUT_RESET_AFTER
+	old := time.Now().UTC().Add(-LOCKOUT_RESET_AFTER - time.Hour)
+	if _, err := db.Exec("UPDATE login_attempts SET failures = 100, last_failure_at = ?, locked_until = NULL WHERE key = ?", old, key); err != nil {
+		t.Fatal(err)
+	}
+	recordLoginFailure(key, ACCOUNT_FREE_ATTEMPTS)
+	var failures int
+	db.QueryRow("SELECT failures FROM login_attempts WHERE key = ?", key).Scan(&failures)
+	if failures != 1 {
+		t.Errorf("failures = %d after a day without any, want 1", failures)
+	}
+	if wait := checkLoginThrottle(key); wait != 0 {
+		t.Errorf("locked for %v by stale failures", wait)
+	}
+}
+
+func TestTakeRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		requests int
+		wantWait bool
+	}{
+		{"under the limit", 3, 2, false},
+		{"at the limit", 3, 3, false},
+		{"over the limit", 3, 4, true},
+		{"well over the limit", 3, 10, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			const window = time.Hour
+
+			var wait time.Duration
+			for i := 0; i < tt.requests; i++ {
+				wait = takeRateLimit("passkey-ip:192.168.1.20", tt.limit, window)
+			}
+			if (wait > 0) != tt.wantWait {
+				t.Fatalf("wait = %v after %d requests with limit %d", wait, tt.requests, tt.limit)
+			}
+			if wait > window {
+				t.Errorf("wait = %v, want no more than the window", wait)
+			}
+			if other := takeRateLimit("passkey-ip:192.168.1.21", tt.limit, window); other != 0 {
+				t.Errorf("another IP must wait %v, want 0", other)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"pubgames/shared/httpkit"
+)
+
+// One install can host several pubs. Every user belongs to a venue (their
+// token carries a venue_id claim) and apps can be limited to one venue.
+// Apps use the claim to keep each pub's games, competitions and
+// leaderboards apart. Venue 1 is created from the shared config's pub_id
+// and pub_name and is where existing users and data live.
+
+const DEFAULT_VENUE_ID = 1
+
+var venueSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Venue is a pub sharing this install
+type Venue struct {
+	ID        int       `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// VenueRequest creates or renames a venue
+type VenueRequest struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// ensureDefaultVenue creates venue 1 from the configured pub if it doesn't
+// exist yet
+func ensureDefaultVenue(pubID, pubName string) {
+	if pubID == "" {
+		pubID = "default"
+	}
+	if pubName == "" {
+		pubName = "PubGames"
+	}
+
+	_, err := db.Exec(`
+		INSERT OR IGNORE INTO venues (id, slug, name)
+		VALUES (?, ?, ?)
+	`, DEFAULT_VENUE_ID, strings.ToLower(pubID), pubName)
+	if err != nil {
+		log.Printf("Warning: Failed to create default venue: %v", err)
+	}
+}
+
+// getVenuesHandler lists venues so players can pick theirs when
+// registering
+func getVenuesHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query("SELECT id, slug, name, created_at FROM venues ORDER BY id")
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	venues := []Venue{}
+	for rows.Next() {
+		var v Venue
+		if err := rows.Scan(&v.ID, &v.Slug, &v.Name, &v.CreatedAt); err != nil {
+			continue
+		}
+		venues = append(venues, v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(venues)
+}
+
+// createVenueHandler adds a venue (admin only)
+func createVenueHandler(w http.ResponseWriter, r *http.Request) {
+	var req VenueRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		httpkit.SendError(w, "Name is required", 400)
+		return
+	}
+	if !venueSlugPattern.MatchString(req.Slug) {
+		httpkit.SendError(w, "slug must be lowercase letters, numbers and dashes", 400)
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO venues (slug, name) VALUES (?, ?)", req.Slug, req.Name)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			httpkit.SendError(w, "A venue with this slug already exists", 409)
+		} else {
+			httpkit.SendError(w, "Failed to create venue", 500)
+		}
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	recordAudit(r, "venue.create", "venue", int(id), map[string]interface{}{
+		"slug": req.Slug,
+		"name": req.Name,
+	})
+	log.Printf("🍺 Venue %d (%s) created", id, req.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Venue{ID: int(id), Slug: req.Slug, Name: req.Name, CreatedAt: time.Now().UTC()})
+}
+
+// updateVenueHandler renames a venue or changes its slug (admin only)
+func updateVenueHandler(w http.ResponseWriter, r *http.Request) {
+	venueID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		httpkit.SendError(w, "Invalid venue ID", 400)
+		return
+	}
+
+	var req VenueRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	var venue Venue
+	err = db.QueryRow("SELECT id, slug, name, created_at FROM venues WHERE id = ?", venueID).
+		Scan(&venue.ID, &venue.Slug, &venue.Name, &venue.CreatedAt)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "Venue not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	if slug := strings.ToLower(strings.TrimSpace(req.Slug)); slug != "" {
+		if !venueSlugPattern.MatchString(slug) {
+			httpkit.SendError(w, "slug must be lowercase letters, numbers and dashes", 400)
+			return
+		}
+		venue.Slug = slug
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		venue.Name = name
+	}
+
+	_, err = db.Exec("UPDATE venues SET slug = ?, name = ? WHERE id = ?", venue.Slug, venue.Name, venueID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			httpkit.SendError(w, "A venue with this slug already exists", 409)
+		} else {
+			httpkit.SendError(w, "Failed to update venue", 500)
+		}
+		return
+	}
+
+	recordAudit(r, "venue.update", "venue", venueID, map[string]interface{}{
+		"slug": venue.Slug,
+		"name": venue.Name,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(venue)
+}
+
+// resolveVenue turns a requested venue ID into one to store, using the
+// default venue for 0. It returns an error message if the venue doesn't
+// exist.
+func resolveVenue(venueID int) (int, string) {
+	if venueID == 0 {
+		return DEFAULT_VENUE_ID, ""
+	}
+
+	var exists int
+	db.QueryRow("SELECT COUNT(*) FROM venues WHERE id = ?", venueID).Scan(&exists)
+	if exists == 0 {
+		return 0, "Venue not found"
+	}
+	return venueID, ""
+}
+
+// loadUserVenue returns the venue a user belongs to
+func loadUserVenue(userID int) (int, error) {
+	var venueID sql.NullInt64
+	err := db.QueryRow("SELECT venue_id FROM users WHERE id = ?", userID).Scan(&venueID)
+	if err != nil {
+		return 0, err
+	}
+	if !venueID.Valid {
+		return DEFAULT_VENUE_ID, nil
+	}
+	return int(venueID.Int64), nil
+}
+
+// appAtVenue reports whether an app is offered at a venue
+func appAtVenue(app App, venueID int) bool {
+	return app.VenueID == nil || *app.VenueID == venueID
+}
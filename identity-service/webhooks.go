@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// Apps learn about changes to users (renames, disabled and deleted
+// accounts, ended sessions) from events POSTed to their webhook_url.
+// publishEvent queues one delivery per app in webhook_deliveries and a
+// background worker sends them, signed with the app's client credentials
+// so apps can check them with auth.WebhookHandler. Failed deliveries are
+// retried with backoff and stay in the table as the delivery log.
+//
+// Each app's deliveries are sent in order, but apps are served in
+// parallel so one that is down can't hold up the rest. Webhooks only go
+// to hosts the shared CORS rules allow, the same list of PubGames hosts
+// browsers are checked against, so a registered app can't point the
+// Identity Service at anything else on the network.
+
+const (
+	WEBHOOK_TIMEOUT       = 5 * time.Second
+	WEBHOOK_POLL_INTERVAL = 15 * time.Second
+	WEBHOOK_RETRY_BASE    = 30 * time.Second
+	WEBHOOK_MAX_ATTEMPTS  = 6
+	// Most deliveries sent to one app per round
+	WEBHOOK_BATCH_SIZE = 50
+	// Most apps delivered to at once
+	WEBHOOK_MAX_CONCURRENT = 8
+
+	// How long the delivery log is kept
+	WEBHOOK_RETENTION = 30 * 24 * time.Hour
+
+	WEBHOOK_STATUS_PENDING   = "pending"
+	WEBHOOK_STATUS_DELIVERED = "delivered"
+	WEBHOOK_STATUS_FAILED    = "failed"
+)
+
+var (
+	// Redirects aren't followed, so an allowed host can't bounce a
+	// delivery somewhere else
+	webhookClient = &http.Client{
+		Timeout: WEBHOOK_TIMEOUT,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// webhookWake nudges the worker when new deliveries are queued
+	webhookWake = make(chan struct{}, 1)
+)
+
+// WebhookDelivery is one event sent (or to be sent) to one app
+type WebhookDelivery struct {
+	ID            int             `json:"id"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	AppID         int             `json:"app_id"`
+	URL           string          `json:"url"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// startWebhookWorker sends due deliveries whenever events are published
+// and on an interval for retries
+func startWebhookWorker() {
+	go func() {
+		ticker := time.NewTicker(WEBHOOK_POLL_INTERVAL)
+		defer ticker.Stop()
+		for {
+			deliverDueWebhooks()
+			pruneWebhookDeliveries()
+			select {
+			case <-webhookWake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// publishEvent queues an event for every app with a webhook_url. Errors
+// are logged rather than returned: the change the event describes has
+// already happened.
+func publishEvent(event auth.Event) {
+	id, err := randomToken(9)
+	if err != nil {
+		log.Printf("Warning: Could not publish %s for user %d: %v", event.Type, event.UserID, err)
+		return
+	}
+	event.ID = "evt_" + id
+	event.CreatedAt = time.Now().UTC()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: Could not publish %s for user %d: %v", event.Type, event.UserID, err)
+		return
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO webhook_deliveries (event_id, event_type, app_id, url, payload, status, next_attempt_at, created_at)
+		SELECT ?, ?, id, webhook_url, ?, ?, ?, ?
+		FROM apps
+		WHERE webhook_url IS NOT NULL AND webhook_url != ''
+	`, event.ID, event.Type, string(payload), WEBHOOK_STATUS_PENDING, event.CreatedAt, event.CreatedAt)
+	if err != nil {
+		log.Printf("Warning: Could not queue %s for user %d: %v", event.Type, event.UserID, err)
+		return
+	}
+
+	wakeWebhookWorker()
+}
+
+// wakeWebhookWorker makes the worker check for due deliveries now
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// publishUserEvent publishes a user.* event carrying the user's current
+// details
+func publishUserEvent(eventType string, userID int) {
+	var u auth.EventUser
+	err := db.QueryRow(`
+		SELECT id, email, name, COALESCE(venue_id, 1), guest_expires_at IS NOT NULL
+		FROM users WHERE id = ?
+	`, userID).Scan(&u.ID, &u.Email, &u.Name, &u.VenueID, &u.IsGuest)
+	if err != nil {
+		log.Printf("Warning: Could not publish %s for user %d: %v", eventType, userID, err)
+		return
+	}
+
+	publishEvent(auth.Event{Type: eventType, UserID: userID, User: &u})
+}
+
+// deliverDueWebhooks sends pending deliveries whose time has come, up to
+// WEBHOOK_BATCH_SIZE per app, with apps served in parallel
+func deliverDueWebhooks() {
+	rows, err := db.Query(`
+		SELECT id, app_id, url, payload, attempts FROM (
+			SELECT id, app_id, url, payload, attempts,
+				ROW_NUMBER() OVER (PARTITION BY app_id ORDER BY id) AS n
+			FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+		)
+		WHERE n <= ?
+		ORDER BY id
+	`, WEBHOOK_STATUS_PENDING, time.Now().UTC(), WEBHOOK_BATCH_SIZE)
+	if err != nil {
+		log.Printf("Warning: Could not load webhook deliveries: %v", err)
+		return
+	}
+
+	due := make(map[int][]WebhookDelivery)
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload string
+		if err := rows.Scan(&d.ID, &d.AppID, &d.URL, &payload, &d.Attempts); err != nil {
+			continue
+		}
+		d.Payload = json.RawMessage(payload)
+		due[d.AppID] = append(due[d.AppID], d)
+	}
+	rows.Close()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, WEBHOOK_MAX_CONCURRENT)
+	for _, deliveries := range due {
+		wg.Add(1)
+		go func(deliveries []WebhookDelivery) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			deliverToApp(deliveries)
+		}(deliveries)
+	}
+	wg.Wait()
+}
+
+// deliverToApp sends one app's due deliveries in order. After a failure
+// the rest wait for the next round, as the app is probably down and each
+// attempt would only wait out the timeout.
+func deliverToApp(deliveries []WebhookDelivery) {
+	for _, d := range deliveries {
+		code, err := sendWebhook(d)
+		recordWebhookAttempt(d, code, err)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// webhookURLAllowed reports whether a webhook may be sent to raw: an
+// http(s) URL without credentials on one of the configured webhook_hosts
+func webhookURLAllowed(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return false
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	return serviceConfig.WebhookHostAllowed(u.Hostname(), port)
+}
+
+// sendWebhook POSTs a delivery's payload, returning the response code
+func sendWebhook(d WebhookDelivery) (int, error) {
+	// Checked again here as webhook_hosts may have changed since the URL
+	// was registered
+	if !webhookURLAllowed(d.URL) {
+		return 0, fmt.Errorf("webhook_url is not on one of the webhook_hosts")
+	}
+
+	var clientID, secret string
+	err := db.QueryRow(`
+		SELECT id, secret FROM app_clients
+		WHERE app_id = ? AND revoked_at IS NULL
+		ORDER BY created_at DESC LIMIT 1
+	`, d.AppID).Scan(&clientID, &secret)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("app has no active client credentials to sign with")
+	} else if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth.SignRequest(req, d.Payload, clientID, secret)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordWebhookAttempt stores the outcome of a delivery attempt, scheduling
+// a retry with exponential backoff until WEBHOOK_MAX_ATTEMPTS is reached
+func recordWebhookAttempt(d WebhookDelivery, code int, sendErr error) {
+	now := time.Now().UTC()
+	attempts := d.Attempts + 1
+
+	var err error
+	if sendErr == nil {
+		_, err = db.Exec(`
+			UPDATE webhook_deliveries
+			SET status = ?, attempts = ?, response_code = ?, error = NULL, delivered_at = ?
+			WHERE id = ?
+		`, WEBHOOK_STATUS_DELIVERED, attempts, code, now, d.ID)
+	} else if attempts >= WEBHOOK_MAX_ATTEMPTS {
+		log.Printf("⚠️  Webhook delivery %d to app %d failed for good: %v", d.ID, d.AppID, sendErr)
+		_, err = db.Exec(`
+			UPDATE webhook_deliveries
+			SET status = ?, attempts = ?, response_code = ?, error = ?
+			WHERE id = ?
+		`, WEBHOOK_STATUS_FAILED, attempts, code, sendErr.Error(), d.ID)
+	} else {
+		retryAt := now.Add(WEBHOOK_RETRY_BASE << (attempts - 1))
+		_, err = db.Exec(`
+			UPDATE webhook_deliveries
+			SET attempts = ?, response_code = ?, error = ?, next_attempt_at = ?
+			WHERE id = ?
+		`, attempts, code, sendErr.Error(), retryAt, d.ID)
+	}
+	if err != nil {
+		log.Printf("Warning: Could not record webhook delivery %d: %v", d.ID, err)
+	}
+}
+
+// pruneWebhookDeliveries removes finished deliveries older than the
+// retention period
+func pruneWebhookDeliveries() {
+	_, err := db.Exec(`
+		DELETE FROM webhook_deliveries
+		WHERE status != ? AND created_at < ?
+	`, WEBHOOK_STATUS_PENDING, time.Now().UTC().Add(-WEBHOOK_RETENTION))
+	if err != nil {
+		log.Printf("Warning: Could not prune webhook deliveries: %v", err)
+	}
+}
+
+// getWebhookDeliveriesHandler lists recent deliveries, newest first,
+// optionally filtered by ?status= and ?app_id= (admin only)
+func getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	query := `
+		SELECT id, event_id, event_type, app_id, url, payload, status, attempts,
+			response_code, error, next_attempt_at, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE 1 = 1
+	`
+	args := []interface{}{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if app := r.URL.Query().Get("app_id"); app != "" {
+		appID, err := strconv.Atoi(app)
+		if err != nil {
+			httpkit.SendError(w, "Invalid app ID", 400)
+			return
+		}
+		query += " AND app_id = ?"
+		args = append(args, appID)
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload string
+		var code sql.NullInt64
+		var lastErr sql.NullString
+		var deliveredAt sql.NullTime
+		var nextAttemptAt time.Time
+		err := rows.Scan(&d.ID, &d.EventID, &d.EventType, &d.AppID, &d.URL, &payload, &d.Status,
+			&d.Attempts, &code, &lastErr, &nextAttemptAt, &d.CreatedAt, &deliveredAt)
+		if err != nil {
+			continue
+		}
+		d.Payload = json.RawMessage(payload)
+		d.ResponseCode = int(code.Int64)
+		d.Error = lastErr.String
+		if d.Status == WEBHOOK_STATUS_PENDING {
+			d.NextAttemptAt = &nextAttemptAt
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// retryWebhookDeliveryHandler queues a delivery to be sent again straight
+// away with a fresh set of attempts, e.g. once a broken app is fixed
+// (admin only)
+func retryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		httpkit.SendError(w, "Invalid delivery ID", 400)
+		return
+	}
+
+	var appID int
+	err = db.QueryRow("SELECT app_id FROM webhook_deliveries WHERE id = ?", deliveryID).Scan(&appID)
+	if err == sql.ErrNoRows {
+		httpkit.SendError(w, "Delivery not found", 404)
+		return
+	} else if err != nil {
+		httpkit.SendError(w, "Database error", 500)
+		return
+	}
+
+	// Pick up the app's current webhook_url in case it has moved
+	_, err = db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = 0, next_attempt_at = ?,
+			url = COALESCE((SELECT NULLIF(webhook_url, '') FROM apps WHERE id = ?), url)
+		WHERE id = ?
+	`, WEBHOOK_STATUS_PENDING, time.Now().UTC(), appID, deliveryID)
+	if err != nil {
+		httpkit.SendError(w, "Failed to retry delivery", 500)
+		return
+	}
+
+	recordAudit(r, "webhook.retry", "app", appID, map[string]interface{}{"delivery_id": deliveryID})
+
+	wakeWebhookWorker()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Delivery queued",
+	})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -12,14 +13,14 @@ import (
 // initDB initializes the database connection and creates tables
 func initDB() {
 	// Ensure data directory exists
-	dataDir := filepath.Dir(DB_PATH)
+	dataDir := filepath.Dir(serviceConfig.DBPath)
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
 	// Open database connection
 	var err error
-	db, err = sql.Open("sqlite3", DB_PATH)
+	db, err = sql.Open("sqlite3", serviceConfig.DBPath)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -40,6 +41,7 @@ func initDB() {
 		postponement_rule TEXT DEFAULT 'loss',
 		start_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		end_date TIMESTAMP,
+		venue_id INTEGER DEFAULT 1,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -111,12 +113,42 @@ func initDB() {
 		log.Fatalf("Failed to create schema: %v", err)
 	}
 
-	log.Println("✅ Database initialized at", DB_PATH)
+	ensureTableIntegrity()
+
+	log.Println("✅ Database initialized at", serviceConfig.DBPath)
 
 	// Initialize default game if none exists
 	initializeDefaultGame()
 }
 
+// ensureTableIntegrity adds missing columns for older databases
+func ensureTableIntegrity() {
+	columns := []struct {
+		table  string
+		column string
+		def    string
+	}{
+		{"games", "venue_id", "INTEGER DEFAULT 1"},
+	}
+
+	for _, col := range columns {
+		var count int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name='%s'", col.table, col.column)
+		err := db.QueryRow(query).Scan(&count)
+		if err != nil {
+			continue
+		}
+
+		if count == 0 {
+			alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.def)
+			_, err := db.Exec(alterSQL)
+			if err == nil {
+				log.Printf("✅ Added column: %s.%s", col.table, col.column)
+			}
+		}
+	}
+}
+
 // initializeDefaultGame creates a default game if database is empty
 func initializeDefaultGame() {
 	var gameCount int
@@ -139,10 +171,10 @@ func initializeDefaultGame() {
 	}
 }
 
-// getCurrentGameID retrieves the current active game ID
-func getCurrentGameID() int {
+// getCurrentGameID retrieves a venue's current active game ID
+func getCurrentGameID(venueID int) int {
 	var gameID int
-	err := db.QueryRow("SELECT CAST(value AS INTEGER) FROM settings WHERE key = 'current_game_id'").Scan(&gameID)
+	err := db.QueryRow("SELECT CAST(value AS INTEGER) FROM settings WHERE key = ?", currentGameKey(venueID)).Scan(&gameID)
 	if err != nil {
 		// If no current game set, return 0
 		return 0
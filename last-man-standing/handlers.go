@@ -5,6 +5,7 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,24 +13,18 @@ import (
 
 	"github.com/gorilla/mux"
 	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
 )
 
-// sendError sends a JSON error response
-func sendError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{
-		Error: message,
-		Code:  code,
-	})
-}
 
 // getConfigHandler returns app configuration (public endpoint)
 func getConfigHandler(w http.ResponseWriter, r *http.Request) {
 	config := Config{
 		AppName:    APP_NAME,
 		AppIcon:    APP_ICON,
-		BackendURL: "http://localhost:" + BACKEND_PORT,
+		Version:    APP_VERSION,
+		BackendURL: "http://localhost:" + serviceConfig.Port,
+		Settings:   serviceConfig.Public(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -41,9 +36,9 @@ func getConfigHandler(w http.ResponseWriter, r *http.Request) {
 // getGamesHandler returns all games
 func getGamesHandler(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.Query(`SELECT id, name, status, winner_count, COALESCE(postponement_rule, 'loss'), 
-		start_date, end_date, created_at FROM games ORDER BY created_at DESC`)
+		start_date, end_date, created_at FROM games WHERE venue_id = ? ORDER BY created_at DESC`, auth.GetVenueID(r))
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
@@ -63,11 +58,18 @@ func getGamesHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(games)
 }
 
-// getCurrentGameHandler returns the current active game
+// getCurrentGameHandler returns the current active game. It is public, so
+// the venue comes from ?venue_id, else the caller's venue if they are
+// logged in, else the default venue.
 func getCurrentGameHandler(w http.ResponseWriter, r *http.Request) {
-	gameID := getCurrentGameID()
+	venueID, _ := strconv.Atoi(r.URL.Query().Get("venue_id"))
+	if venueID == 0 {
+		venueID = auth.GetVenueID(r)
+	}
+
+	gameID := getCurrentGameID(venueID)
 	if gameID == 0 {
-		sendError(w, "No current game", 404)
+		httpkit.SendError(w, "No current game", 404)
 		return
 	}
 
@@ -79,7 +81,7 @@ func getCurrentGameHandler(w http.ResponseWriter, r *http.Request) {
 		&game.PostponementRule, &game.StartDate, &endDate, &game.CreatedAt)
 
 	if err != nil {
-		sendError(w, "Current game not found", 404)
+		httpkit.SendError(w, "Current game not found", 404)
 		return
 	}
 
@@ -97,16 +99,30 @@ func createGameHandler(w http.ResponseWriter, r *http.Request) {
 		Name             string `json:"name"`
 		PostponementRule string `json:"postponement_rule"`
 	}
-	json.NewDecoder(r.Body).Decode(&game)
+	if err := httpkit.Decode(w, r, &game); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	var v httpkit.Validation
+	v.Required("name", game.Name)
+	v.MaxLength("name", game.Name, 100)
+	if game.PostponementRule != "" {
+		v.OneOf("postponement_rule", game.PostponementRule, "loss", "win")
+	}
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
 	if game.PostponementRule == "" {
 		game.PostponementRule = "loss"
 	}
 
-	result, err := db.Exec("INSERT INTO games (name, status, postponement_rule) VALUES (?, ?, ?)",
-		game.Name, "active", game.PostponementRule)
+	result, err := db.Exec("INSERT INTO games (name, status, postponement_rule, venue_id) VALUES (?, ?, ?, ?)",
+		game.Name, "active", game.PostponementRule, auth.GetVenueID(r))
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 
@@ -126,11 +142,16 @@ func createGameHandler(w http.ResponseWriter, r *http.Request) {
 // setCurrentGameHandler sets the current active game (admin only)
 func setCurrentGameHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	gameID := vars["id"]
+	gameID, _ := strconv.Atoi(vars["id"])
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
+	}
 
-	_, err := db.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES ('current_game_id', ?)", gameID)
+	_, err := db.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)",
+		currentGameKey(auth.GetVenueID(r)), gameID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 
@@ -141,14 +162,18 @@ func setCurrentGameHandler(w http.ResponseWriter, r *http.Request) {
 // completeGameHandler marks a game as completed (admin only)
 func completeGameHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	gameID := vars["id"]
+	gameID, _ := strconv.Atoi(vars["id"])
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
+	}
 
 	// Check for open rounds
 	var openRoundCount int
 	db.QueryRow(`SELECT COUNT(*) FROM rounds WHERE game_id = ? AND status = 'open'`, gameID).Scan(&openRoundCount)
 
 	if openRoundCount > 0 {
-		sendError(w, "Cannot complete game: there are still open rounds. Close all rounds first.", 400)
+		httpkit.SendError(w, "Cannot complete game: there are still open rounds. Close all rounds first.", 400)
 		return
 	}
 
@@ -158,7 +183,7 @@ func completeGameHandler(w http.ResponseWriter, r *http.Request) {
 	_, err := db.Exec("UPDATE games SET status = 'completed', winner_count = ?, end_date = ? WHERE id = ?",
 		winnerCount, time.Now(), gameID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 
@@ -173,16 +198,28 @@ func joinGameHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		GameID int `json:"game_id"`
 	}
-	json.NewDecoder(r.Body).Decode(&req)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
-	if req.GameID == 0 {
-		req.GameID = getCurrentGameID()
+	var v httpkit.Validation
+	v.Positive("game_id", req.GameID)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	gameID, ok := gameForVenue(w, r, req.GameID)
+	if !ok {
+		return
 	}
+	req.GameID = gameID
 
 	_, err := db.Exec("INSERT OR REPLACE INTO game_players (user_id, game_id, is_active) VALUES (?, ?, ?)",
 		user.ID, req.GameID, true)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 
@@ -196,9 +233,9 @@ func getUserGameStatusHandler(w http.ResponseWriter, r *http.Request) {
 	
 	gameIDStr := r.URL.Query().Get("game_id")
 	gameID, _ := strconv.Atoi(gameIDStr)
-
-	if gameID == 0 {
-		gameID = getCurrentGameID()
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
 	}
 
 	var isActive bool
@@ -221,14 +258,15 @@ func getUserGameStatusHandler(w http.ResponseWriter, r *http.Request) {
 func getRoundsHandler(w http.ResponseWriter, r *http.Request) {
 	gameIDStr := r.URL.Query().Get("game_id")
 	gameID, _ := strconv.Atoi(gameIDStr)
-	if gameID == 0 {
-		gameID = getCurrentGameID()
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
 	}
 
 	rows, err := db.Query(`SELECT id, game_id, round_number, submission_deadline, status, created_at 
 		FROM rounds WHERE game_id = ? ORDER BY round_number ASC`, gameID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
@@ -247,16 +285,29 @@ func getRoundsHandler(w http.ResponseWriter, r *http.Request) {
 // createRoundHandler creates a new round (admin only)
 func createRoundHandler(w http.ResponseWriter, r *http.Request) {
 	var round Round
-	json.NewDecoder(r.Body).Decode(&round)
+	if err := httpkit.Decode(w, r, &round); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
-	if round.GameID == 0 {
-		round.GameID = getCurrentGameID()
+	var v httpkit.Validation
+	v.Positive("round_number", round.RoundNumber)
+	v.Required("submission_deadline", round.SubmissionDeadline)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	gameID, ok := gameForVenue(w, r, round.GameID)
+	if !ok {
+		return
 	}
+	round.GameID = gameID
 
 	result, err := db.Exec(`INSERT INTO rounds (game_id, round_number, submission_deadline, status) 
 		VALUES (?, ?, ?, 'draft')`, round.GameID, round.RoundNumber, round.SubmissionDeadline)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 
@@ -275,12 +326,26 @@ func updateRoundStatusHandler(w http.ResponseWriter, r *http.Request) {
 	roundNum := vars["round"]
 
 	gameID, _ := strconv.Atoi(gameIDStr)
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
+	}
 	roundNumber, _ := strconv.Atoi(roundNum)
 
 	var update struct {
 		Status string `json:"status"`
 	}
-	json.NewDecoder(r.Body).Decode(&update)
+	if err := httpkit.Decode(w, r, &update); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	var v httpkit.Validation
+	v.OneOf("status", update.Status, "draft", "open", "closed")
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
 	// If closing a round, check that all matches have results
 	if update.Status == "closed" {
@@ -290,12 +355,12 @@ func updateRoundStatusHandler(w http.ResponseWriter, r *http.Request) {
 			gameID, roundNum).Scan(&unmatchedCount)
 
 		if err != nil {
-			sendError(w, "Error checking match results", 500)
+			httpkit.SendError(w, "Error checking match results", 500)
 			return
 		}
 
 		if unmatchedCount > 0 {
-			sendError(w, fmt.Sprintf("Cannot close round: %d match(es) still have no results entered", unmatchedCount), 400)
+			httpkit.SendError(w, fmt.Sprintf("Cannot close round: %d match(es) still have no results entered", unmatchedCount), 400)
 			return
 		}
 
@@ -348,7 +413,7 @@ func updateRoundStatusHandler(w http.ResponseWriter, r *http.Request) {
 	_, err := db.Exec("UPDATE rounds SET status = ? WHERE game_id = ? AND round_number = ?",
 		update.Status, gameID, roundNum)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 
@@ -362,9 +427,9 @@ func getOpenRoundsHandler(w http.ResponseWriter, r *http.Request) {
 	
 	gameIDStr := r.URL.Query().Get("game_id")
 	gameID, _ := strconv.Atoi(gameIDStr)
-
-	if gameID == 0 {
-		gameID = getCurrentGameID()
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
 	}
 
 	rows, err := db.Query(`
@@ -377,7 +442,7 @@ func getOpenRoundsHandler(w http.ResponseWriter, r *http.Request) {
 		ORDER BY r.round_number ASC
 	`, gameID, user.ID, gameID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
@@ -400,6 +465,10 @@ func getRoundSummaryHandler(w http.ResponseWriter, r *http.Request) {
 	roundNum := vars["round"]
 
 	gameID, _ := strconv.Atoi(gameIDStr)
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
+	}
 
 	var totalPlayers int
 	db.QueryRow(`SELECT COUNT(DISTINCT user_id) FROM predictions 
@@ -423,7 +492,7 @@ func getRoundSummaryHandler(w http.ResponseWriter, r *http.Request) {
 		ORDER BY player_count DESC
 	`, gameID, roundNum)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
@@ -453,15 +522,16 @@ func getRoundSummaryHandler(w http.ResponseWriter, r *http.Request) {
 func getMatchesHandler(w http.ResponseWriter, r *http.Request) {
 	gameIDStr := r.URL.Query().Get("game_id")
 	gameID, _ := strconv.Atoi(gameIDStr)
-	if gameID == 0 {
-		gameID = getCurrentGameID()
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
 	}
 
 	rows, err := db.Query(`SELECT id, game_id, match_number, round_number, date, location, 
 		home_team, away_team, result, status, created_at FROM matches 
 		WHERE game_id = ? ORDER BY round_number, date ASC`, gameID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
@@ -485,12 +555,16 @@ func getMatchesByRoundHandler(w http.ResponseWriter, r *http.Request) {
 	round := vars["round"]
 
 	gameID, _ := strconv.Atoi(gameIDStr)
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
+	}
 
 	rows, err := db.Query(`SELECT id, game_id, match_number, round_number, date, location, 
 		home_team, away_team, result, status, created_at FROM matches 
 		WHERE game_id = ? AND round_number = ? ORDER BY date ASC`, gameID, round)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
@@ -513,13 +587,14 @@ func uploadMatchesHandler(w http.ResponseWriter, r *http.Request) {
 
 	gameIDStr := r.FormValue("game_id")
 	gameID, _ := strconv.Atoi(gameIDStr)
-	if gameID == 0 {
-		gameID = getCurrentGameID()
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
 	}
 
 	file, _, err := r.FormFile("file")
 	if err != nil {
-		sendError(w, "Error reading file", 400)
+		httpkit.SendError(w, "Error reading file", 400)
 		return
 	}
 	defer file.Close()
@@ -527,7 +602,7 @@ func uploadMatchesHandler(w http.ResponseWriter, r *http.Request) {
 	reader := csv.NewReader(file)
 	records, err := reader.ReadAll()
 	if err != nil {
-		sendError(w, "Error parsing CSV", 400)
+		httpkit.SendError(w, "Error parsing CSV", 400)
 		return
 	}
 
@@ -574,17 +649,31 @@ func updateMatchResultHandler(w http.ResponseWriter, r *http.Request) {
 	var update struct {
 		Result string `json:"result"`
 	}
-	json.NewDecoder(r.Body).Decode(&update)
+	if err := httpkit.Decode(w, r, &update); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	var v httpkit.Validation
+	v.Required("result", update.Result)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
 	var homeTeam, awayTeam string
 	var roundNum, gameID int
 	db.QueryRow("SELECT home_team, away_team, round_number, game_id FROM matches WHERE id = ?", matchID).
 		Scan(&homeTeam, &awayTeam, &roundNum, &gameID)
+	if !gameInVenue(gameID, auth.GetVenueID(r)) {
+		httpkit.SendError(w, "Match not found", 404)
+		return
+	}
 
 	_, err := db.Exec("UPDATE matches SET result = ?, status = 'completed' WHERE id = ?",
 		update.Result, matchID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 
@@ -662,17 +751,30 @@ func makePredictionHandler(w http.ResponseWriter, r *http.Request) {
 		MatchID       int    `json:"match_id"`
 		PredictedTeam string `json:"predicted_team"`
 	}
-	json.NewDecoder(r.Body).Decode(&pred)
+	if err := httpkit.Decode(w, r, &pred); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
-	if pred.GameID == 0 {
-		pred.GameID = getCurrentGameID()
+	var v httpkit.Validation
+	v.Positive("match_id", pred.MatchID)
+	v.Required("predicted_team", pred.PredictedTeam)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	gameID, ok := gameForVenue(w, r, pred.GameID)
+	if !ok {
+		return
 	}
+	pred.GameID = gameID
 
 	var isActive bool
 	db.QueryRow("SELECT is_active FROM game_players WHERE user_id = ? AND game_id = ?",
 		user.ID, pred.GameID).Scan(&isActive)
 	if !isActive {
-		sendError(w, "User is eliminated from this game", 403)
+		httpkit.SendError(w, "User is eliminated from this game", 403)
 		return
 	}
 
@@ -685,7 +787,7 @@ func makePredictionHandler(w http.ResponseWriter, r *http.Request) {
 		WHERE m.id = ? AND m.game_id = ?`, pred.MatchID, pred.GameID).Scan(&roundNum, &roundStatus, &submissionDeadline)
 
 	if roundStatus != "open" {
-		sendError(w, "Round is not open for predictions", 400)
+		httpkit.SendError(w, "Round is not open for predictions", 400)
 		return
 	}
 
@@ -696,7 +798,7 @@ func makePredictionHandler(w http.ResponseWriter, r *http.Request) {
 			deadline, err = time.Parse("2006-01-02 15:04:05", submissionDeadline)
 		}
 		if err == nil && time.Now().After(deadline) {
-			sendError(w, "Submission deadline has passed", 400)
+			httpkit.SendError(w, "Submission deadline has passed", 400)
 			return
 		}
 	}
@@ -706,7 +808,7 @@ func makePredictionHandler(w http.ResponseWriter, r *http.Request) {
 	db.QueryRow("SELECT COUNT(*) FROM predictions WHERE user_id = ? AND game_id = ? AND round_number = ?",
 		user.ID, pred.GameID, roundNum).Scan(&count)
 	if count > 0 {
-		sendError(w, "Already predicted for this round", 409)
+		httpkit.SendError(w, "Already predicted for this round", 409)
 		return
 	}
 
@@ -715,14 +817,14 @@ func makePredictionHandler(w http.ResponseWriter, r *http.Request) {
 	db.QueryRow("SELECT COUNT(*) FROM predictions WHERE user_id = ? AND game_id = ? AND predicted_team = ?",
 		user.ID, pred.GameID, pred.PredictedTeam).Scan(&teamCount)
 	if teamCount > 0 {
-		sendError(w, "You have already picked this team in this game", 409)
+		httpkit.SendError(w, "You have already picked this team in this game", 409)
 		return
 	}
 
 	_, err := db.Exec(`INSERT INTO predictions (user_id, game_id, match_id, round_number, predicted_team) 
 		VALUES (?, ?, ?, ?, ?)`, user.ID, pred.GameID, pred.MatchID, roundNum, pred.PredictedTeam)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 
@@ -737,23 +839,24 @@ func getPredictionsHandler(w http.ResponseWriter, r *http.Request) {
 	gameIDStr := r.URL.Query().Get("game_id")
 	viewAllStr := r.URL.Query().Get("view_all")
 
-	gameID, _ := strconv.Atoi(gameIDStr)
 	viewAll := viewAllStr == "true"
 
-	if gameID == 0 {
-		gameID = getCurrentGameID()
+	gameID, _ := strconv.Atoi(gameIDStr)
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
 	}
 
 	// If trying to view all predictions, must be admin
-	if viewAll && !user.IsAdmin {
-		sendError(w, "Only admins can view all predictions", 403)
+	if viewAll && !auth.GetPrincipal(r).HasRole("admin") {
+		httpkit.SendError(w, "Only admins can view all predictions", 403)
 		return
 	}
 
 	var rows *sql.Rows
 	var err error
 
-	if viewAll && user.IsAdmin {
+	if viewAll {
 		rows, err = db.Query(`
 			SELECT p.id, p.user_id, p.match_id, p.round_number, p.predicted_team, 
 				p.is_correct, p.voided, p.created_at, '', m.home_team, m.away_team, m.result, m.date
@@ -774,12 +877,13 @@ func getPredictionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
 
 	predictions := []PredictionResponse{}
+	userIDs := []int{}
 	for rows.Next() {
 		var p PredictionResponse
 		var isCorrect sql.NullBool
@@ -790,6 +894,20 @@ func getPredictionsHandler(w http.ResponseWriter, r *http.Request) {
 			p.IsCorrect = &val
 		}
 		predictions = append(predictions, p)
+		userIDs = append(userIDs, p.UserID)
+	}
+
+	// Names come from the Identity Service's user directory
+	users, err := directory.Lookup(userIDs)
+	if err != nil {
+		log.Printf("Warning: Could not look up player names: %v", err)
+	}
+	for i := range predictions {
+		if u, ok := users[predictions[i].UserID]; ok {
+			predictions[i].UserName = u.Name
+		} else {
+			predictions[i].UserName = auth.FallbackName(predictions[i].UserID)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -802,9 +920,9 @@ func getUsedTeamsHandler(w http.ResponseWriter, r *http.Request) {
 	
 	gameIDStr := r.URL.Query().Get("game_id")
 	gameID, _ := strconv.Atoi(gameIDStr)
-
-	if gameID == 0 {
-		gameID = getCurrentGameID()
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
 	}
 
 	rows, err := db.Query(`
@@ -813,7 +931,7 @@ func getUsedTeamsHandler(w http.ResponseWriter, r *http.Request) {
 		WHERE user_id = ? AND game_id = ?
 	`, user.ID, gameID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
@@ -835,8 +953,9 @@ func getUsedTeamsHandler(w http.ResponseWriter, r *http.Request) {
 func getStandingsHandler(w http.ResponseWriter, r *http.Request) {
 	gameIDStr := r.URL.Query().Get("game_id")
 	gameID, _ := strconv.Atoi(gameIDStr)
-	if gameID == 0 {
-		gameID = getCurrentGameID()
+	gameID, ok := gameForVenue(w, r, gameID)
+	if !ok {
+		return
 	}
 
 	rows, err := db.Query(`
@@ -849,18 +968,32 @@ func getStandingsHandler(w http.ResponseWriter, r *http.Request) {
 		ORDER BY gp.is_active DESC, last_round DESC
 	`, gameID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
 
 	standings := []StandingsEntry{}
+	userIDs := []int{}
 	for rows.Next() {
 		var s StandingsEntry
 		rows.Scan(&s.UserID, &s.IsActive, &s.LastRound)
-		// UserName will need to be fetched from Identity Service or left empty
-		s.UserName = fmt.Sprintf("User %d", s.UserID)
 		standings = append(standings, s)
+		userIDs = append(userIDs, s.UserID)
+	}
+
+	// Names come from the Identity Service's user directory
+	users, err := directory.Lookup(userIDs)
+	if err != nil {
+		log.Printf("Warning: Could not look up player names: %v", err)
+	}
+	for i := range standings {
+		if u, ok := users[standings[i].UserID]; ok {
+			standings[i].UserName = u.Name
+			standings[i].AvatarURL = u.AvatarURL
+		} else {
+			standings[i].UserName = auth.FallbackName(standings[i].UserID)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
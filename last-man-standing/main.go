@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -13,41 +14,65 @@ import (
 
 var db *sql.DB
 
+// serviceConfig holds the ports and paths this instance runs with
+var serviceConfig *config.ServiceConfig
+
+// directory resolves player IDs to names; nil without client credentials
+var directory *auth.Directory
+
 const (
-	APP_NAME         = "Last Man Standing"
-	APP_ICON         = "⚽"
-	BACKEND_PORT     = "30021"
-	FRONTEND_PORT    = "30020"
-	DB_PATH          = "./data/last-man-standing.db"
-	IDENTITY_SERVICE = "http://localhost:3001"
+	APP_NAME    = "Last Man Standing"
+	APP_ICON    = "⚽"
+	APP_VERSION = "1.0.0"
 )
 
 func main() {
 	log.Printf("🚀 Starting %s...", APP_NAME)
 
+	// Settings: these defaults, then a config file, environment and flags
+	var err error
+	serviceConfig, err = config.LoadServiceConfig(config.ServiceConfig{
+		Name:               APP_NAME,
+		Version:            APP_VERSION,
+		Port:               "30021",
+		FrontendPort:       "30020",
+		DBPath:             "./data/last-man-standing.db",
+		IdentityServiceURL: "http://localhost:3001",
+	}, os.Args[1:])
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
 	// Initialize database
 	initDB()
 	defer db.Close()
 
+	// Look up player names in the Identity Service
+	initDirectory()
+
 	// Setup router
 	r := mux.NewRouter()
 	api := r.PathPrefix("/api").Subrouter()
 
 	// Setup auth middleware
-	authMw := auth.AuthMiddleware(auth.Config{
-		IdentityServiceURL: IDENTITY_SERVICE,
-	})
-	adminMw := auth.AdminMiddleware
+	authConfig := auth.Config{
+		IdentityServiceURL: serviceConfig.IdentityServiceURL,
+	}
+	authMw := auth.AuthMiddleware(authConfig)
+	adminMw := auth.RequireAny("admin")
+	// Guests can look around but taking part needs the player role, which
+	// guests don't have
+	playerMw := auth.RequireRole("player")
 
 	// ===== PUBLIC ROUTES =====
 	api.HandleFunc("/config", getConfigHandler).Methods("GET")
-	api.HandleFunc("/games/current", getCurrentGameHandler).Methods("GET")
+	api.HandleFunc("/games/current", auth.Optional(authConfig)(getCurrentGameHandler)).Methods("GET")
 
 	// ===== PROTECTED ROUTES (authenticated users) =====
 	
 	// Game routes
 	api.HandleFunc("/games", authMw(getGamesHandler)).Methods("GET")
-	api.HandleFunc("/games/join", authMw(joinGameHandler)).Methods("POST")
+	api.HandleFunc("/games/join", authMw(playerMw(joinGameHandler))).Methods("POST")
 	api.HandleFunc("/games/status", authMw(getUserGameStatusHandler)).Methods("GET")
 
 	// Round routes
@@ -59,7 +84,7 @@ func main() {
 	api.HandleFunc("/matches/{game_id}/round/{round}", authMw(getMatchesByRoundHandler)).Methods("GET")
 
 	// Prediction routes
-	api.HandleFunc("/predictions", authMw(makePredictionHandler)).Methods("POST")
+	api.HandleFunc("/predictions", authMw(playerMw(makePredictionHandler))).Methods("POST")
 	api.HandleFunc("/predictions", authMw(getPredictionsHandler)).Methods("GET")
 	api.HandleFunc("/predictions/used-teams", authMw(getUsedTeamsHandler)).Methods("GET")
 
@@ -82,12 +107,17 @@ func main() {
 	api.HandleFunc("/matches/upload", authMw(adminMw(uploadMatchesHandler))).Methods("POST")
 	api.HandleFunc("/matches/{id}/result", authMw(adminMw(updateMatchResultHandler))).Methods("PUT")
 
-	// Load CORS configuration from shared config
-	corsConfig, err := config.LoadCORSConfig()
-	if err != nil {
-		log.Printf("Warning: CORS config load error: %v", err)
+	// ===== IDENTITY EVENTS (signed with this app's client secret) =====
+	// Register http://<host>:30021/api/webhooks/identity as the app's
+	// webhook_url in the Identity Service admin
+	if serviceConfig.HasClientCredentials() {
+		api.HandleFunc("/webhooks/identity", auth.WebhookHandler(serviceConfig.ClientSecret, identityEventHandler)).Methods("POST")
 	}
-	log.Printf("📋 CORS Mode: %s", corsConfig.CORS.Mode)
+
+	// Load CORS configuration from shared config, reloading it when the
+	// file changes
+	corsConfig := config.WatchCORSConfig()
+	log.Printf("📋 CORS Mode: %s", corsConfig.Current().CORS.Mode)
 	log.Printf("📋 Allowed Origins: %v", corsConfig.GetAllowedOrigins())
 
 	// CORS configuration using shared config
@@ -104,8 +134,33 @@ func main() {
 		handlers.AllowCredentials(),
 	)
 
-	log.Printf("✅ Backend running on :%s", BACKEND_PORT)
-	log.Printf("   Frontend should be at :%s", FRONTEND_PORT)
-	log.Printf("   Identity Service at %s", IDENTITY_SERVICE)
-	log.Fatal(http.ListenAndServe(":"+BACKEND_PORT, corsHandler(r)))
+	log.Printf("✅ Backend running on :%s", serviceConfig.Port)
+	log.Printf("   Frontend should be at :%s", serviceConfig.FrontendPort)
+	log.Printf("   Identity Service at %s", serviceConfig.IdentityServiceURL)
+	log.Fatal(http.ListenAndServe(":"+serviceConfig.Port, corsHandler(r)))
+}
+
+// initDirectory sets up the user directory used to show player names. It
+// needs client credentials created by an admin with POST /api/admin/clients,
+// set as client_id/client_secret in the service config (or APP_CLIENT_ID and
+// APP_CLIENT_SECRET). Without them players
+// are shown as "User <id>".
+func initDirectory() {
+	if !serviceConfig.HasClientCredentials() {
+		log.Println("ℹ️  APP_CLIENT_ID/APP_CLIENT_SECRET not set; player names won't be looked up")
+		return
+	}
+
+	client := auth.NewServiceClient(serviceConfig.IdentityServiceURL, serviceConfig.ClientID, serviceConfig.ClientSecret)
+	directory = auth.NewDirectory(client, 0)
+}
+
+// identityEventHandler drops cached names for users who are renamed or
+// deleted, so standings pick up the change straight away
+func identityEventHandler(event auth.Event) error {
+	switch event.Type {
+	case auth.EventUserUpdated, auth.EventUserDeleted:
+		directory.Forget(event.UserID)
+	}
+	return nil
 }
@@ -16,6 +16,10 @@ type Config struct {
 	AppName    string `json:"app_name"`
 	AppIcon    string `json:"app_icon"`
 	BackendURL string `json:"backend_url"`
+	Version    string `json:"version"`
+
+	// Settings are this instance's non-secret settings
+	Settings map[string]interface{} `json:"settings"`
 }
 
 // Competition represents a game/tournament
@@ -82,6 +86,7 @@ type PredictionResponse struct {
 type StandingsEntry struct {
 	UserID    int    `json:"user_id"`
 	UserName  string `json:"user_name"`
+	AvatarURL string `json:"avatar_url,omitempty"`
 	IsActive  bool   `json:"is_active"`
 	LastRound int    `json:"last_round"`
 }
@@ -100,10 +105,3 @@ type TeamStat struct {
 	PlayerCount       int    `json:"player_count"`
 	PlayersEliminated int    `json:"players_eliminated"`
 }
-
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Details string `json:"details,omitempty"`
-}
@@ -934,7 +934,16 @@ function App() {
                 {standings.map((entry, index) => (
                   <tr key={entry.user_id} className={entry.is_active ? 'active' : 'eliminated'}>
                     <td>{index + 1}</td>
-                    <td>{entry.user_name}</td>
+                    <td>
+                      {entry.avatar_url && (
+                        <img
+                          src={`http://${getHostname()}:3001${entry.avatar_url}`}
+                          alt=""
+                          style={{ width: 24, height: 24, borderRadius: '50%', verticalAlign: 'middle', marginRight: 8 }}
+                        />
+                      )}
+                      {entry.user_name}
+                    </td>
                     <td>
                       <span className={entry.is_active ? 'badge-active' : 'badge-eliminated'}>
                         {entry.is_active ? 'Active' : 'Eliminated'}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// Each game belongs to a venue (the venue of the admin who created it).
+// Players only see their own venue's games, and each venue has its own
+// current game.
+
+// currentGameKey is the settings key holding a venue's current game. The
+// default venue keeps the key used before venues existed.
+func currentGameKey(venueID int) string {
+	if venueID == auth.DefaultVenueID {
+		return "current_game_id"
+	}
+	return fmt.Sprintf("current_game_id:%d", venueID)
+}
+
+// gameInVenue reports whether a game belongs to a venue
+func gameInVenue(gameID, venueID int) bool {
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM games WHERE id = ? AND venue_id = ?", gameID, venueID).Scan(&count)
+	return count > 0
+}
+
+// gameForVenue returns the game a request is about: the venue's current
+// game when gameID is 0, otherwise gameID if it belongs to the user's
+// venue. It writes a 404 and returns false for another venue's game.
+func gameForVenue(w http.ResponseWriter, r *http.Request, gameID int) (int, bool) {
+	venueID := auth.GetVenueID(r)
+	if gameID == 0 {
+		return getCurrentGameID(venueID), true
+	}
+	if !gameInVenue(gameID, venueID) {
+		httpkit.SendError(w, "Game not found", 404)
+		return 0, false
+	}
+	return gameID, true
+}
@@ -400,6 +400,7 @@ sed -i "s|30X1|$BACKEND_PORT|g" "$APP_DIR/main.go"
 sed -i "s|30X0|$FRONTEND_PORT|g" "$APP_DIR/main.go"
 sed -i "s|PLACEHOLDER_APP_NAME|$APP_DISPLAY_NAME|g" "$APP_DIR/main.go"
 sed -i "s|PLACEHOLDER_ICON|$APP_ICON|g" "$APP_DIR/main.go"
+sed -i "s|PLACEHOLDER_DESCRIPTION|$APP_DESCRIPTION|g" "$APP_DIR/main.go"
 sed -i "s|./data/app.db|./data/${APP_NAME}.db|g" "$APP_DIR/main.go"
 echo -e "${GREEN}✓ Updated main.go${NC}"
 
@@ -453,7 +454,9 @@ echo ""
 echo "Or add this app to start_services.sh and run ./start_services.sh"
 echo ""
 echo -e "${YELLOW}Don't forget to:${NC}"
-echo "- Add app to Identity Service database (apps table)"
+echo "- Create client credentials in the Identity Service (POST /api/admin/clients)"
+echo "  and start the backend with APP_CLIENT_ID and APP_CLIENT_SECRET set;"
+echo "  the app then adds itself to the launcher"
 echo "- Customize database schema in database.go"
 echo "- Implement your business logic in handlers.go"
 echo ""
\ No newline at end of file
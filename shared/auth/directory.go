@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDirectoryTTL = 10 * time.Minute
+	maxLookupBatch      = 500
+
+	// Avatar links from the Identity Service last at least an hour, so
+	// users aren't cached for longer
+	maxDirectoryTTL = time.Hour
+
+	// How long IDs the Identity Service doesn't know are remembered, so
+	// an app asking for them again doesn't send a lookup each time
+	directoryNegativeTTL = time.Minute
+
+	// Most users a directory keeps. When full, expired entries are dropped
+	// first and then the oldest.
+	maxDirectoryCache = 10000
+)
+
+// ErrLookupForbidden means the app's client isn't allowed the lookup, e.g.
+// LookupEmails without the users:emails scope
+var ErrLookupForbidden = errors.New("user lookup not allowed for this client")
+
+// DirectoryUser is another user's public details from the Identity
+// Service. AvatarURL is a signed link relative to the Identity Service,
+// e.g. "/api/users/3/avatar.svg?exp=...", that expires after an hour or so.
+type DirectoryUser struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// Directory turns user IDs into display names and avatars using the
+// Identity Service's /api/users/lookup, caching results (up to
+// maxDirectoryCache of them). Deleted and merged users aren't found, like
+// unknown IDs. A nil *Directory (e.g. an app running without client
+// credentials) finds nobody, so callers can use it unconditionally and
+// fall back to FallbackName.
+type Directory struct {
+	client *ServiceClient
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[int]cachedDirectoryUser
+}
+
+// cachedDirectoryUser is a looked-up user kept until expiresAt. Unknown
+// IDs are cached too, with found false.
+type cachedDirectoryUser struct {
+	user      DirectoryUser
+	found     bool
+	expiresAt time.Time
+}
+
+// NewDirectory creates a directory that looks users up with the app's
+// service client. A ttl of zero caches users for 10 minutes; the most is
+// an hour.
+func NewDirectory(client *ServiceClient, ttl time.Duration) *Directory {
+	if ttl <= 0 {
+		ttl = defaultDirectoryTTL
+	}
+	if ttl > maxDirectoryTTL {
+		ttl = maxDirectoryTTL
+	}
+	return &Directory{
+		client: client,
+		ttl:    ttl,
+		cache:  make(map[int]cachedDirectoryUser),
+	}
+}
+
+// Lookup returns the users found for ids, keyed by ID. Users that aren't
+// cached are fetched in one request per batch; IDs the Identity Service
+// doesn't know are left out.
+func (d *Directory) Lookup(ids []int) (map[int]DirectoryUser, error) {
+	found := make(map[int]DirectoryUser, len(ids))
+	if d == nil {
+		return found, nil
+	}
+
+	now := time.Now()
+	var missing []int
+	seen := make(map[int]bool, len(ids))
+
+	d.mu.Lock()
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if cached, ok := d.cache[id]; ok && now.Before(cached.expiresAt) {
+			if cached.found {
+				found[id] = cached.user
+			}
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	d.mu.Unlock()
+
+	for start := 0; start < len(missing); start += maxLookupBatch {
+		end := start + maxLookupBatch
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		batch := missing[start:end]
+		users, err := d.fetch(batch)
+		if err != nil {
+			return found, err
+		}
+
+		d.mu.Lock()
+		for _, u := range users {
+			found[u.ID] = u
+			d.store(u.ID, cachedDirectoryUser{user: u, found: true, expiresAt: now.Add(d.ttl)})
+		}
+		for _, id := range batch {
+			if _, ok := found[id]; !ok {
+				d.store(id, cachedDirectoryUser{expiresAt: now.Add(directoryNegativeTTL)})
+			}
+		}
+		d.mu.Unlock()
+	}
+
+	return found, nil
+}
+
+// store caches an entry, making room first if the cache is full. Callers
+// hold d.mu.
+func (d *Directory) store(id int, entry cachedDirectoryUser) {
+	if _, ok := d.cache[id]; !ok && len(d.cache) >= maxDirectoryCache {
+		d.evict()
+	}
+	d.cache[id] = entry
+}
+
+// evict drops expired entries and, if that doesn't free a quarter of the
+// cache, the entries closest to expiring, which are the oldest. Callers
+// hold d.mu.
+func (d *Directory) evict() {
+	now := time.Now()
+	for id, cached := range d.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(d.cache, id)
+		}
+	}
+
+	target := maxDirectoryCache * 3 / 4
+	if len(d.cache) <= target {
+		return
+	}
+	ids := make([]int, 0, len(d.cache))
+	for id := range d.cache {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return d.cache[ids[i]].expiresAt.Before(d.cache[ids[j]].expiresAt)
+	})
+	for _, id := range ids[:len(ids)-target] {
+		delete(d.cache, id)
+	}
+}
+
+// LookupEmails returns the IDs of the users emails belong to, keyed by
+// lower-cased email, for apps backfilling user IDs onto data they stored
+// by email. The client needs the users:emails scope. An email resolves
+// only if exactly one live account has ever used it; others are left out.
+// Results aren't cached.
+func (d *Directory) LookupEmails(emails []string) (map[string]int, error) {
+	found := make(map[string]int, len(emails))
+	if d == nil {
+		return found, nil
+	}
+
+	for start := 0; start < len(emails); start += maxLookupBatch {
+		end := start + maxLookupBatch
+		if end > len(emails) {
+			end = len(emails)
+		}
+
+		var result struct {
+			Emails []struct {
+				Email  string `json:"email"`
+				UserID int    `json:"user_id"`
+			} `json:"emails"`
+		}
+		if err := d.post(map[string]interface{}{"emails": emails[start:end]}, &result); err != nil {
+			return found, err
+		}
+		for _, owner := range result.Emails {
+			found[strings.ToLower(owner.Email)] = owner.UserID
+		}
+	}
+
+	return found, nil
+}
+
+// Name returns a user's display name, or FallbackName if they can't be
+// looked up
+func (d *Directory) Name(id int) string {
+	users, _ := d.Lookup([]int{id})
+	if u, ok := users[id]; ok {
+		return u.Name
+	}
+	return FallbackName(id)
+}
+
+// Forget drops users from the cache so they are looked up afresh, e.g.
+// when a user.updated event arrives
+func (d *Directory) Forget(ids ...int) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, id := range ids {
+		delete(d.cache, id)
+	}
+}
+
+// FallbackName is shown for users the directory can't resolve
+func FallbackName(id int) string {
+	return fmt.Sprintf("User %d", id)
+}
+
+// fetch asks the Identity Service for a batch of users
+func (d *Directory) fetch(ids []int) ([]DirectoryUser, error) {
+	var result struct {
+		Users []DirectoryUser `json:"users"`
+	}
+	if err := d.post(map[string]interface{}{"ids": ids}, &result); err != nil {
+		return nil, err
+	}
+	return result.Users, nil
+}
+
+// post sends a lookup to the Identity Service and decodes the response
+func (d *Directory) post(body interface{}, result interface{}) error {
+	resp, err := d.client.Do("POST", "/api/users/lookup", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return ErrLookupForbidden
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("user lookup failed (HTTP %d)", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
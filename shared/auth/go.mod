@@ -4,4 +4,7 @@ go 1.25
 
 require (
 	github.com/golang-jwt/jwt/v5 v5.2.0
+	pubgames/shared/httpkit v0.0.0
 )
+
+replace pubgames/shared/httpkit => ../httpkit
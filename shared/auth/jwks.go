@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Minimum gap between JWKS fetches triggered by an unknown key ID,
+// so a flood of bad tokens cannot hammer the Identity Service
+const minKeyRefetchInterval = 10 * time.Second
+
+var errKeyNotFound = errors.New("signing key not found")
+
+// JWK is a single JSON Web Key as published by the Identity Service
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// keySet caches the Identity Service's public signing keys by key ID
+type keySet struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func newKeySet(url string, client *http.Client, refreshInterval time.Duration) *keySet {
+	return &keySet{
+		url:             url,
+		client:          client,
+		refreshInterval: refreshInterval,
+		keys:            make(map[string]interface{}),
+	}
+}
+
+// key returns the public key for kid, refreshing the cache when it is
+// stale or the key ID is unknown (e.g. just after a key rotation)
+func (ks *keySet) key(kid string) (interface{}, error) {
+	ks.mu.RLock()
+	key, found := ks.keys[kid]
+	fresh := time.Since(ks.fetchedAt) < ks.refreshInterval
+	canRetry := time.Since(ks.lastAttempt) >= minKeyRefetchInterval
+	ks.mu.RUnlock()
+
+	if found && fresh {
+		return key, nil
+	}
+
+	if canRetry {
+		if err := ks.refresh(); err != nil {
+			log.Printf("Warning: Could not refresh signing keys from %s: %v", ks.url, err)
+			// Keep using cached keys while the Identity Service is unreachable
+			if found {
+				return key, nil
+			}
+			return nil, err
+		}
+
+		ks.mu.RLock()
+		key, found = ks.keys[kid]
+		ks.mu.RUnlock()
+	}
+
+	if !found {
+		return nil, errKeyNotFound
+	}
+	return key, nil
+}
+
+// refresh fetches the key set and replaces the cache
+func (ks *keySet) refresh() error {
+	ks.mu.Lock()
+	ks.lastAttempt = time.Now()
+	ks.mu.Unlock()
+
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var doc JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("could not decode key set: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("Warning: Skipping signing key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// PublicKey converts the JWK into an ed25519.PublicKey or *rsa.PublicKey
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key length %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -1,73 +1,122 @@
 package auth
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
+
+	"pubgames/shared/httpkit"
 )
 
 type contextKey string
 
 const UserContextKey contextKey = "user"
 
+// DefaultVenueID is the venue for users whose token predates venues, and
+// where a single-pub install keeps everything
+const DefaultVenueID = 1
+
 // Config holds configuration for auth middleware
 type Config struct {
 	IdentityServiceURL string
+
+	// JWKSURL overrides where signing keys are fetched from
+	// (defaults to IdentityServiceURL + "/.well-known/jwks.json")
+	JWKSURL string
+
+	// KeyRefreshInterval is how long fetched signing keys are trusted
+	// before being re-fetched (defaults to 5 minutes)
+	KeyRefreshInterval time.Duration
+
+	// DisableRemoteFallback rejects tokens that can't be verified locally
+	// instead of asking the Identity Service's /api/validate-token
+	DisableRemoteFallback bool
 }
 
 // User represents authenticated user information
 type User struct {
-	ID      int    `json:"id"`
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	IsAdmin bool   `json:"is_admin"`
+	ID        int      `json:"id"`
+	Email     string   `json:"email"`
+	Name      string   `json:"name"`
+	IsAdmin   bool     `json:"is_admin"`
+	IsGuest   bool     `json:"is_guest,omitempty"`
+	VenueID   int      `json:"venue_id,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionID string   `json:"session_id,omitempty"`
 }
 
-// AuthMiddleware validates JWT tokens with Identity Service
+// AuthMiddleware validates JWT tokens locally against the Identity Service's
+// published signing keys, falling back to a remote check when needed. The
+// caller is available to handlers through GetUser and GetPrincipal.
 func AuthMiddleware(config Config) func(http.HandlerFunc) http.HandlerFunc {
+	verifier := verifierFor(config)
+
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			// Extract token from Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				sendError(w, "Missing authorization header", http.StatusUnauthorized)
-				return
-			}
-
-			// Parse Bearer token
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				sendError(w, "Invalid authorization header format", http.StatusUnauthorized)
+			token, err := bearerToken(r)
+			if err != nil {
+				httpkit.SendError(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			token := parts[1]
 
-			// Validate token with Identity Service
-			user, err := validateToken(config.IdentityServiceURL, token)
+			// Validate token (locally where possible)
+			principal, err := verifier.VerifyPrincipal(token)
 			if err != nil {
-				sendError(w, "Invalid or expired token", http.StatusUnauthorized)
+				httpkit.SendError(w, "Invalid or expired token", http.StatusUnauthorized)
 				return
 			}
 
-			// Add user to request context
-			ctx := context.WithValue(r.Context(), UserContextKey, user)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, withPrincipal(r, principal))
 		}
 	}
 }
 
+// bearerToken extracts the token from the Authorization header
+func bearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", errors.New("Missing authorization header")
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", errors.New("Invalid authorization header format")
+	}
+	return parts[1], nil
+}
+
 // AdminMiddleware ensures the user has admin privileges
 func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, ok := r.Context().Value(UserContextKey).(*User)
 		if !ok {
-			sendError(w, "User not found in context", http.StatusUnauthorized)
+			httpkit.SendError(w, "User not found in context", http.StatusUnauthorized)
 			return
 		}
 
 		if !user.IsAdmin {
-			sendError(w, "Admin access required", http.StatusForbidden)
+			httpkit.SendError(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// NoGuestsMiddleware turns away guest (quick-play) accounts. Guests pass
+// AuthMiddleware like anyone else; wrap routes that need a full account,
+// e.g. AuthMiddleware(config)(NoGuestsMiddleware(handler)).
+func NoGuestsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(UserContextKey).(*User)
+		if !ok {
+			httpkit.SendError(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if user.IsGuest {
+			httpkit.SendError(w, "A full account is required", http.StatusForbidden)
 			return
 		}
 
@@ -84,39 +133,18 @@ func GetUser(r *http.Request) *User {
 	return user
 }
 
-// validateToken validates a JWT token with the Identity Service
-func validateToken(identityURL string, token string) (*User, error) {
-	req, err := http.NewRequest("GET", identityURL+"/api/validate-token", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, http.ErrAbortHandler
-	}
-
-	var user User
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, err
+// Venue returns the venue the user plays at. Apps store it with each
+// game, competition or result and filter on it so pubs sharing an install
+// only see their own data.
+func (u *User) Venue() int {
+	if u == nil || u.VenueID == 0 {
+		return DefaultVenueID
 	}
-
-	return &user, nil
+	return u.VenueID
 }
 
-// sendError sends a JSON error response
-func sendError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error": message,
-		"code":  code,
-	})
+// GetVenueID returns the authenticated user's venue, or DefaultVenueID on
+// routes without a user
+func GetVenueID(r *http.Request) int {
+	return GetUser(r).Venue()
 }
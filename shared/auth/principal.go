@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pubgames/shared/httpkit"
+)
+
+// PrincipalContextKey is where AuthMiddleware and Optional store the
+// *Principal. The embedded *User is also stored under UserContextKey so
+// GetUser keeps working.
+const PrincipalContextKey contextKey = "principal"
+
+// Principal is the authenticated caller: the user plus details of the
+// token they presented. Roles are written as in the token, e.g. "host" or
+// "app_admin:3" for a role limited to one app.
+type Principal struct {
+	User
+	TokenID   string    `json:"token_id,omitempty"`
+	IssuedAt  time.Time `json:"issued_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// HasRole reports whether the principal holds a global role
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAppRole reports whether the principal holds role for an app, either
+// globally or limited to that app
+func (p *Principal) HasAppRole(role string, appID int) bool {
+	if p.HasRole(role) {
+		return true
+	}
+	for _, id := range p.AppScopes(role) {
+		if id == appID {
+			return true
+		}
+	}
+	return false
+}
+
+// AppScopes returns the app IDs a per-app role is limited to
+func (p *Principal) AppScopes(role string) []int {
+	if p == nil {
+		return nil
+	}
+	ids := []int{}
+	for _, r := range p.Roles {
+		name, app, ok := strings.Cut(r, ":")
+		if !ok || name != role {
+			continue
+		}
+		if id, err := strconv.Atoi(app); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// GetPrincipal retrieves the authenticated principal from request context,
+// or nil on routes where nobody is logged in
+func GetPrincipal(r *http.Request) *Principal {
+	p, ok := r.Context().Value(PrincipalContextKey).(*Principal)
+	if !ok {
+		return nil
+	}
+	return p
+}
+
+// withPrincipal adds the principal (and its user) to the request context
+func withPrincipal(r *http.Request, p *Principal) *http.Request {
+	ctx := context.WithValue(r.Context(), PrincipalContextKey, p)
+	ctx = context.WithValue(ctx, UserContextKey, &p.User)
+	return r.WithContext(ctx)
+}
+
+// RequireRole allows principals holding every one of roles, e.g.
+// authMw(auth.RequireRole("host")(handler)). Admins are not let through
+// automatically; use RequireAny("host", "admin") for that.
+func RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return requirePrincipal(func(p *Principal) bool {
+		for _, role := range roles {
+			if !p.HasRole(role) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireAny allows principals holding at least one of roles
+func RequireAny(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return requirePrincipal(func(p *Principal) bool {
+		for _, role := range roles {
+			if p.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// requirePrincipal builds middleware that checks the principal set by
+// AuthMiddleware, which must run first
+func requirePrincipal(allowed func(*Principal) bool) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			p := GetPrincipal(r)
+			if p == nil {
+				httpkit.SendError(w, "User not found in context", http.StatusUnauthorized)
+				return
+			}
+
+			if !allowed(p) {
+				httpkit.SendError(w, "You don't have permission to do this", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// Optional validates a token when one is sent but lets requests without a
+// valid token through anonymously, for routes that show more to logged-in
+// users. Handlers check GetPrincipal(r) != nil.
+func Optional(config Config) func(http.HandlerFunc) http.HandlerFunc {
+	verifier := verifierFor(config)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			token, err := bearerToken(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, err := verifier.VerifyPrincipal(token)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, withPrincipal(r, p))
+		}
+	}
+}
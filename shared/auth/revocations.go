@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How often the revoked-session list is re-fetched. Revoking a session
+// takes effect in apps within this interval.
+const revocationRefreshInterval = 30 * time.Second
+
+// revocationList caches the session IDs the Identity Service has revoked
+// while their access tokens could still be unexpired
+type revocationList struct {
+	url    string
+	client *http.Client
+
+	mu          sync.RWMutex
+	revoked     map[string]bool
+	lastAttempt time.Time
+}
+
+func newRevocationList(url string, client *http.Client) *revocationList {
+	return &revocationList{
+		url:     url,
+		client:  client,
+		revoked: make(map[string]bool),
+	}
+}
+
+// isRevoked reports whether a session has been revoked, refreshing the
+// list when it is stale. If the Identity Service is unreachable the last
+// known list is used.
+func (rl *revocationList) isRevoked(sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+
+	rl.mu.RLock()
+	stale := time.Since(rl.lastAttempt) >= revocationRefreshInterval
+	rl.mu.RUnlock()
+
+	if stale {
+		if err := rl.refresh(); err != nil {
+			log.Printf("Warning: Could not refresh revoked sessions from %s: %v", rl.url, err)
+		}
+	}
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.revoked[sessionID]
+}
+
+// refresh fetches the current revocation list
+func (rl *revocationList) refresh() error {
+	rl.mu.Lock()
+	rl.lastAttempt = time.Now()
+	rl.mu.Unlock()
+
+	resp, err := rl.client.Get(rl.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Revoked []string `json:"revoked"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("could not decode revoked sessions: %w", err)
+	}
+
+	revoked := make(map[string]bool, len(doc.Revoked))
+	for _, id := range doc.Revoked {
+		revoked[id] = true
+	}
+
+	rl.mu.Lock()
+	rl.revoked = revoked
+	rl.mu.Unlock()
+
+	return nil
+}
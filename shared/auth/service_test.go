@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyRequestSignature(t *testing.T) {
+	const secret = "client-secret"
+	body := []byte(`{"ids":[1,2]}`)
+
+	signed := func(method, target string, body []byte) *http.Request {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		SignRequest(req, body, "app_test", secret)
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     func() *http.Request
+		body    []byte
+		secret  string
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			req:    func() *http.Request { return signed("POST", "/api/users/lookup", body) },
+			body:   body,
+			secret: secret,
+		},
+		{
+			name:   "empty body",
+			req:    func() *http.Request { return signed("GET", "/api/service/apps", nil) },
+			secret: secret,
+		},
+		{
+			name: "query order doesn't matter",
+			req: func() *http.Request {
+				req := signed("GET", "/api/x?b=2&a=1", nil)
+				req.URL.RawQuery = "a=1&b=2"
+				return req
+			},
+			secret: secret,
+		},
+		{
+			name: "upper-case signature",
+			req: func() *http.Request {
+				req := signed("POST", "/api/users/lookup", body)
+				req.Header.Set(SignatureHeader, string(bytes.ToUpper([]byte(req.Header.Get(SignatureHeader)))))
+				return req
+			},
+			body:   body,
+			secret: secret,
+		},
+		{
+			name:    "wrong secret",
+			req:     func() *http.Request { return signed("POST", "/api/users/lookup", body) },
+			body:    body,
+			secret:  "other-secret",
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "changed body",
+			req:     func() *http.Request { return signed("POST", "/api/users/lookup", body) },
+			body:    []byte(`{"ids":[1,2,3]}`),
+			secret:  secret,
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "changed method",
+			req: func() *http.Request {
+				req := signed("POST", "/api/users/lookup", body)
+				req.Method = "PUT"
+				return req
+			},
+			body:    body,
+			secret:  secret,
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "changed path",
+			req: func() *http.Request {
+				req := signed("POST", "/api/users/lookup", body)
+				req.URL.Path = "/api/service/apps"
+				return req
+			},
+			body:    body,
+			secret:  secret,
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "changed query",
+			req: func() *http.Request {
+				req := signed("GET", "/api/x?limit=1", nil)
+				req.URL.RawQuery = "limit=1000"
+				return req
+			},
+			secret:  secret,
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "changed timestamp",
+			req: func() *http.Request {
+				req := signed("POST", "/api/users/lookup", body)
+				ts, _ := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+				req.Header.Set(TimestampHeader, strconv.FormatInt(ts+1, 10))
+				return req
+			},
+			body:    body,
+			secret:  secret,
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "old timestamp",
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/api/users/lookup", bytes.NewReader(body))
+				ts := strconv.FormatInt(time.Now().Add(-MaxSignatureAge-time.Minute).Unix(), 10)
+				req.Header.Set(TimestampHeader, ts)
+				req.Header.Set(SignatureHeader, signature(secret, "POST", "/api/users/lookup", ts, body))
+				return req
+			},
+			body:    body,
+			secret:  secret,
+			wantErr: ErrStaleSignature,
+		},
+		{
+			name: "future timestamp",
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/api/users/lookup", bytes.NewReader(body))
+				ts := strconv.FormatInt(time.Now().Add(MaxSignatureAge+time.Minute).Unix(), 10)
+				req.Header.Set(TimestampHeader, ts)
+				req.Header.Set(SignatureHeader, signature(secret, "POST", "/api/users/lookup", ts, body))
+				return req
+			},
+			body:    body,
+			secret:  secret,
+			wantErr: ErrStaleSignature,
+		},
+		{
+			name: "timestamp not a number",
+			req: func() *http.Request {
+				req := signed("POST", "/api/users/lookup", body)
+				req.Header.Set(TimestampHeader, "yesterday")
+				return req
+			},
+			body:    body,
+			secret:  secret,
+			wantErr: ErrStaleSignature,
+		},
+		{
+			name: "no signature",
+			req: func() *http.Request {
+				req := signed("POST", "/api/users/lookup", body)
+				req.Header.Del(SignatureHeader)
+				return req
+			},
+			body:    body,
+			secret:  secret,
+			wantErr: ErrMissingSignature,
+		},
+		{
+			name: "no timestamp",
+			req: func() *http.Request {
+				req := signed("POST", "/api/users/lookup", body)
+				req.Header.Del(TimestampHeader)
+				return req
+			},
+			body:    body,
+			secret:  secret,
+			wantErr: ErrMissingSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyRequestSignature(tt.req(), tt.body, tt.secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyRequestSignature() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte("0123456789")))
+
+	body, err := ReadBody(req, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "0123" {
+		t.Errorf("ReadBody() = %q, want the first 4 bytes", body)
+	}
+
+	// The handler sees the same bytes that were verified
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(req.Body)
+	if buf.String() != "0123" {
+		t.Errorf("restored body = %q, want %q", buf.String(), "0123")
+	}
+}
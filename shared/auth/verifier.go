@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// The Identity Service signs access tokens and OIDC ID tokens with the
+	// same keys; the typ claim says which a token is. Only access tokens
+	// are accepted for API calls.
+	TokenTypeAccess = "access"
+	TokenTypeID     = "id"
+
+	defaultKeyRefreshInterval = 5 * time.Minute
+	remoteCacheTTL            = 30 * time.Second
+	maxRemoteCacheEntries     = 1000
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that fail verification
+	ErrInvalidToken = errors.New("invalid or expired token")
+
+	// errNotLocal marks tokens that cannot be verified with published keys
+	// (e.g. legacy HMAC tokens) and must go to the Identity Service instead
+	errNotLocal = errors.New("token cannot be verified locally")
+)
+
+// Verifier checks tokens against the Identity Service's published signing
+// keys, falling back to the remote /api/validate-token endpoint when a
+// token cannot be verified locally
+type Verifier struct {
+	config  Config
+	client  *http.Client
+	keys    *keySet
+	revoked *revocationList
+
+	mu     sync.Mutex
+	remote map[string]cachedUser
+}
+
+// cachedUser is a remote validation result kept for a short time
+type cachedUser struct {
+	principal *Principal
+	expiresAt time.Time
+}
+
+var (
+	verifiers   = make(map[Config]*Verifier)
+	verifiersMu sync.Mutex
+)
+
+// NewVerifier creates a verifier with its own key and result caches
+func NewVerifier(config Config) *Verifier {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	jwksURL := config.JWKSURL
+	if jwksURL == "" {
+		jwksURL = config.IdentityServiceURL + "/.well-known/jwks.json"
+	}
+
+	refresh := config.KeyRefreshInterval
+	if refresh <= 0 {
+		refresh = defaultKeyRefreshInterval
+	}
+
+	return &Verifier{
+		config:  config,
+		client:  client,
+		keys:    newKeySet(jwksURL, client, refresh),
+		revoked: newRevocationList(config.IdentityServiceURL+"/api/revoked-sessions", client),
+		remote:  make(map[string]cachedUser),
+	}
+}
+
+// verifierFor returns the shared verifier for a config so that the
+// middleware and ValidateToken callers reuse the same caches
+func verifierFor(config Config) *Verifier {
+	verifiersMu.Lock()
+	defer verifiersMu.Unlock()
+
+	v, ok := verifiers[config]
+	if !ok {
+		v = NewVerifier(config)
+		verifiers[config] = v
+	}
+	return v
+}
+
+// ValidateToken verifies a token using the shared verifier for config.
+// Useful where the middleware can't be used, e.g. WebSocket handshakes.
+func ValidateToken(config Config, token string) (*User, error) {
+	return verifierFor(config).Verify(token)
+}
+
+// Verify validates a token and returns the user it was issued to.
+// Tokens whose session has been revoked are rejected.
+func (v *Verifier) Verify(tokenString string) (*User, error) {
+	principal, err := v.VerifyPrincipal(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return &principal.User, nil
+}
+
+// VerifyPrincipal is Verify but also returns the token's ID and lifetime
+func (v *Verifier) VerifyPrincipal(tokenString string) (*Principal, error) {
+	principal, err := v.verifyLocal(tokenString)
+	if errors.Is(err, errNotLocal) && !v.config.DisableRemoteFallback {
+		principal, err = v.verifyRemote(tokenString)
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if v.revoked.isRevoked(principal.SessionID) {
+		return nil, ErrInvalidToken
+	}
+
+	return principal, nil
+}
+
+// verifyLocal checks the token signature against the cached key set
+func (v *Verifier) verifyLocal(tokenString string) (*Principal, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodEd25519, *jwt.SigningMethodRSA:
+		default:
+			return nil, errNotLocal
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errNotLocal
+		}
+
+		key, err := v.keys.key(kid)
+		if err != nil {
+			return nil, errNotLocal
+		}
+		return key, nil
+	})
+
+	if err != nil {
+		if errors.Is(err, errNotLocal) {
+			return nil, errNotLocal
+		}
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	return principalFromClaims(claims)
+}
+
+// verifyRemote asks the Identity Service to validate the token,
+// caching successful results briefly to avoid a round-trip per request
+func (v *Verifier) verifyRemote(tokenString string) (*Principal, error) {
+	sum := sha256.Sum256([]byte(tokenString))
+	cacheKey := hex.EncodeToString(sum[:])
+
+	v.mu.Lock()
+	if cached, ok := v.remote[cacheKey]; ok && time.Now().Before(cached.expiresAt) {
+		v.mu.Unlock()
+		return cached.principal, nil
+	}
+	v.mu.Unlock()
+
+	req, err := http.NewRequest("GET", v.config.IdentityServiceURL+"/api/validate-token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("identity service unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrInvalidToken
+	}
+
+	principal := &Principal{}
+	if err := json.NewDecoder(resp.Body).Decode(&principal.User); err != nil {
+		return nil, err
+	}
+
+	// The Identity Service vouched for the token, so its unverified
+	// claims can be trusted for the token ID and lifetime
+	if token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{}); err == nil {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			setTokenDetails(principal, claims)
+		}
+	}
+
+	v.mu.Lock()
+	if len(v.remote) >= maxRemoteCacheEntries {
+		v.pruneRemoteLocked()
+	}
+	v.remote[cacheKey] = cachedUser{principal: principal, expiresAt: time.Now().Add(remoteCacheTTL)}
+	v.mu.Unlock()
+
+	return principal, nil
+}
+
+// pruneRemoteLocked drops expired results, or everything if the cache is
+// still full. Caller must hold v.mu.
+func (v *Verifier) pruneRemoteLocked() {
+	now := time.Now()
+	for key, cached := range v.remote {
+		if now.After(cached.expiresAt) {
+			delete(v.remote, key)
+		}
+	}
+	if len(v.remote) >= maxRemoteCacheEntries {
+		v.remote = make(map[string]cachedUser)
+	}
+}
+
+// principalFromClaims builds a Principal from Identity Service token claims
+func principalFromClaims(claims jwt.MapClaims) (*Principal, error) {
+	if typ, _ := claims["typ"].(string); typ != TokenTypeAccess {
+		return nil, ErrInvalidToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	isAdmin, _ := claims["is_admin"].(bool)
+	isGuest, _ := claims["is_guest"].(bool)
+	venueID, _ := claims["venue_id"].(float64)
+	sessionID, _ := claims["sid"].(string)
+
+	principal := &Principal{
+		User: User{
+			ID:        int(userID),
+			Email:     email,
+			Name:      name,
+			IsAdmin:   isAdmin,
+			IsGuest:   isGuest,
+			VenueID:   int(venueID),
+			Roles:     rolesFromClaims(claims),
+			SessionID: sessionID,
+		},
+	}
+	setTokenDetails(principal, claims)
+	return principal, nil
+}
+
+// setTokenDetails copies the token ID and lifetime from claims
+func setTokenDetails(p *Principal, claims jwt.MapClaims) {
+	p.TokenID, _ = claims["jti"].(string)
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		p.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		p.ExpiresAt = exp.Time
+	}
+}
+
+// rolesFromClaims reads the roles claim, e.g. ["player", "app_admin:3"]
+func rolesFromClaims(claims jwt.MapClaims) []string {
+	raw, _ := claims["roles"].([]interface{})
+	roles := make([]string, 0, len(raw))
+	for _, r := range raw {
+		if role, ok := r.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdentity is a stand-in Identity Service publishing signing keys and
+// revoked sessions. Its /api/validate-token rejects everything, so tokens
+// that fall back to the remote check fail.
+type testIdentity struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    map[string]ed25519.PrivateKey
+	public  []JWK
+	revoked []string
+}
+
+func newTestIdentity(t *testing.T) *testIdentity {
+	t.Helper()
+	ti := &testIdentity{keys: make(map[string]ed25519.PrivateKey)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		json.NewEncoder(w).Encode(JWKS{Keys: ti.public})
+	})
+	mux.HandleFunc("/api/revoked-sessions", func(w http.ResponseWriter, r *http.Request) {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"revoked": ti.revoked})
+	})
+	mux.HandleFunc("/api/validate-token", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	})
+
+	ti.Server = httptest.NewServer(mux)
+	t.Cleanup(ti.Close)
+	return ti
+}
+
+// addKey creates and publishes an Ed25519 signing key
+func (ti *testIdentity) addKey(t *testing.T, kid string) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.keys[kid] = priv
+	ti.public = append(ti.public, JWK{
+		Kty: "OKP", Crv: "Ed25519", Kid: kid, Alg: "EdDSA", Use: "sig",
+		X: base64.RawURLEncoding.EncodeToString(pub),
+	})
+	return priv
+}
+
+func (ti *testIdentity) revoke(sessionID string) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.revoked = append(ti.revoked, sessionID)
+}
+
+// accessClaims are the claims the Identity Service puts in access tokens
+func accessClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"typ":      TokenTypeAccess,
+		"user_id":  42,
+		"email":    "player@example.com",
+		"name":     "Player",
+		"is_admin": false,
+		"roles":    []string{"player", "app_admin:3"},
+		"sid":      "session-1",
+		"jti":      "token-1",
+		"iat":      now.Unix(),
+		"exp":      now.Add(time.Hour).Unix(),
+	}
+}
+
+func signEdDSA(t *testing.T, key ed25519.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	ti := newTestIdentity(t)
+	key := ti.addKey(t, "k1")
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	ti.revoke("revoked-session")
+
+	with := func(changes map[string]interface{}) jwt.MapClaims {
+		claims := accessClaims()
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims()).SignedString([]byte("secret"))
+	noneToken, _ := jwt.NewWithClaims(jwt.SigningMethodNone, accessClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid access token", signEdDSA(t, key, "k1", accessClaims()), false},
+		{"unknown kid", signEdDSA(t, key, "k2", accessClaims()), true},
+		{"missing kid", signEdDSA(t, key, "", accessClaims()), true},
+		{"signed with another key", signEdDSA(t, otherKey, "k1", accessClaims()), true},
+		{"expired", signEdDSA(t, key, "k1", with(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})), true},
+		{"not yet valid", signEdDSA(t, key, "k1", with(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})), true},
+		{"ID token", signEdDSA(t, key, "k1", with(map[string]interface{}{"typ": TokenTypeID})), true},
+		{"no token type", signEdDSA(t, key, "k1", with(map[string]interface{}{"typ": nil})), true},
+		{"no user ID", signEdDSA(t, key, "k1", with(map[string]interface{}{"user_id": nil})), true},
+		{"user ID not a number", signEdDSA(t, key, "k1", with(map[string]interface{}{"user_id": "42"})), true},
+		{"revoked session", signEdDSA(t, key, "k1", with(map[string]interface{}{"sid": "revoked-session"})), true},
+		{"HMAC token falls back and is refused", hmacToken, true},
+		{"alg none", noneToken, true},
+		{"garbage", "not.a.token", true},
+		{"empty", "", true},
+	}
+
+	v := NewVerifier(Config{IdentityServiceURL: ti.URL})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := v.Verify(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Verify() = %+v, want error", user)
+				}
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if user.ID != 42 || user.Email != "player@example.com" || user.SessionID != "session-1" {
+				t.Errorf("Verify() = %+v, want user 42 with session-1", user)
+			}
+		})
+	}
+}
+
+func TestVerifyPrincipalClaims(t *testing.T) {
+	ti := newTestIdentity(t)
+	key := ti.addKey(t, "k1")
+	v := NewVerifier(Config{IdentityServiceURL: ti.URL, DisableRemoteFallback: true})
+
+	claims := accessClaims()
+	claims["venue_id"] = 2
+	claims["is_guest"] = true
+	p, err := v.VerifyPrincipal(signEdDSA(t, key, "k1", claims))
+	if err != nil {
+		t.Fatalf("VerifyPrincipal() error = %v", err)
+	}
+
+	if p.TokenID != "token-1" || p.VenueID != 2 || !p.IsGuest {
+		t.Errorf("principal = %+v, want token-1 at venue 2 as a guest", p)
+	}
+	if !p.HasRole("player") || p.HasRole("admin") {
+		t.Errorf("roles = %v, want player and not admin", p.Roles)
+	}
+	if got := p.AppScopes("app_admin"); len(got) != 1 || got[0] != 3 {
+		t.Errorf("AppScopes(app_admin) = %v, want [3]", got)
+	}
+	if p.ExpiresAt.Before(time.Now()) {
+		t.Errorf("ExpiresAt = %v, want the token's expiry", p.ExpiresAt)
+	}
+}
+
+func TestVerifyPicksUpRotatedKeys(t *testing.T) {
+	ti := newTestIdentity(t)
+	oldKey := ti.addKey(t, "old")
+	v := NewVerifier(Config{IdentityServiceURL: ti.URL, DisableRemoteFallback: true})
+
+	if _, err := v.Verify(signEdDSA(t, oldKey, "old", accessClaims())); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+
+	newKey := ti.addKey(t, "new")
+	newToken := signEdDSA(t, newKey, "new", accessClaims())
+
+	// Unknown key IDs only trigger a refetch every minKeyRefetchInterval
+	if _, err := v.Verify(newToken); err == nil {
+		t.Fatal("new key accepted before the key set could be refetched")
+	}
+
+	v.keys.mu.Lock()
+	v.keys.lastAttempt = time.Now().Add(-minKeyRefetchInterval)
+	v.keys.mu.Unlock()
+
+	if _, err := v.Verify(newToken); err != nil {
+		t.Fatalf("new key after refetch: %v", err)
+	}
+	if _, err := v.Verify(signEdDSA(t, oldKey, "old", accessClaims())); err != nil {
+		t.Fatalf("old key after rotation: %v", err)
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	tests := []struct {
+		name    string
+		jwk     JWK
+		wantErr bool
+	}{
+		{"Ed25519", JWK{Kty: "OKP", Crv: "Ed25519", X: b64(pub)}, false},
+		{"Ed25519 wrong length", JWK{Kty: "OKP", Crv: "Ed25519", X: b64(pub[:16])}, true},
+		{"Ed25519 bad encoding", JWK{Kty: "OKP", Crv: "Ed25519", X: "!!"}, true},
+		{"other curve", JWK{Kty: "OKP", Crv: "X25519", X: b64(pub)}, true},
+		{"RSA", JWK{Kty: "RSA", N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())}, false},
+		{"RSA bad modulus", JWK{Kty: "RSA", N: "!!", E: "AQAB"}, true},
+		{"EC", JWK{Kty: "EC", Crv: "P-256"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.jwk.PublicKey()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PublicKey() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
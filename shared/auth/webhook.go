@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"pubgames/shared/httpkit"
+)
+
+// The Identity Service tells app backends about changes to users by
+// POSTing an Event to the webhook_url registered for the app. Deliveries
+// are signed exactly like service requests (see service.go), using the
+// app's own client credentials. A delivery the app doesn't answer with
+// 2xx is retried with growing backoff, up to six attempts in all; after
+// that it is marked failed and only sent again if an admin retries it.
+
+const (
+	EventUserCreated    = "user.created"
+	EventUserUpdated    = "user.updated"
+	EventUserDisabled   = "user.disabled"
+	EventUserEnabled    = "user.enabled"
+	EventUserDeleted    = "user.deleted"
+	EventSessionRevoked = "session.revoked"
+
+	// Largest webhook body WebhookHandler accepts
+	maxWebhookBody = 64 * 1024
+)
+
+// Event is one change published by the Identity Service. The same event
+// may be delivered more than once, so handlers should be idempotent.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int       `json:"user_id"`
+
+	// User is the user as they are after the change. It is nil for
+	// user.deleted, where the account has already been anonymised.
+	User *EventUser `json:"user,omitempty"`
+
+	// MergedInto is set on user.deleted when the account was merged into
+	// another one, so apps can move its data across
+	MergedInto int `json:"merged_into,omitempty"`
+
+	// SessionIDs lists the sessions ended by a session.revoked event
+	SessionIDs []string `json:"session_ids,omitempty"`
+}
+
+// EventUser is the user details carried by user events
+type EventUser struct {
+	ID      int    `json:"id"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	VenueID int    `json:"venue_id"`
+	IsGuest bool   `json:"is_guest,omitempty"`
+}
+
+// WebhookHandler verifies and decodes Identity Service events, passing
+// each one to handle. Return an error from handle to have the delivery
+// retried later.
+//
+// Example:
+//
+//	r.HandleFunc("/api/webhooks/identity", auth.WebhookHandler(secret, func(e auth.Event) error {
+//		if e.Type == auth.EventUserUpdated {
+//			directory.Forget(e.UserID)
+//		}
+//		return nil
+//	})).Methods("POST")
+func WebhookHandler(clientSecret string, handle func(Event) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ReadBody(r, maxWebhookBody)
+		if err != nil {
+			httpkit.SendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := VerifyRequestSignature(r, body, clientSecret); err != nil {
+			log.Printf("Warning: Rejected webhook: %v", err)
+			httpkit.SendError(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			httpkit.SendError(w, "Invalid event", http.StatusBadRequest)
+			return
+		}
+
+		if err := handle(event); err != nil {
+			log.Printf("Warning: Webhook %s (%s) failed: %v", event.ID, event.Type, err)
+			httpkit.SendError(w, "Failed to handle event", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
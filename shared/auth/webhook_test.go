@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	const secret = "client-secret"
+	event, _ := json.Marshal(Event{ID: "evt-1", Type: EventUserUpdated, UserID: 7})
+
+	delivery := func(body []byte, secret string) *http.Request {
+		req := httptest.NewRequest("POST", "/api/webhooks/identity", bytes.NewReader(body))
+		SignRequest(req, body, "app_test", secret)
+		return req
+	}
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		handleErr  error
+		wantStatus int
+		wantEvent  bool
+	}{
+		{"signed event", delivery(event, secret), nil, http.StatusNoContent, true},
+		{"handler fails so it is retried", delivery(event, secret), errors.New("database busy"), http.StatusInternalServerError, true},
+		{"wrong secret", delivery(event, "other-secret"), nil, http.StatusUnauthorized, false},
+		{"unsigned", httptest.NewRequest("POST", "/api/webhooks/identity", bytes.NewReader(event)), nil, http.StatusUnauthorized, false},
+		{"signed but not an event", delivery([]byte("not json"), secret), nil, http.StatusBadRequest, false},
+		{
+			name: "body swapped after signing",
+			req: func() *http.Request {
+				req := delivery(event, secret)
+				other, _ := json.Marshal(Event{ID: "evt-1", Type: EventUserDeleted, UserID: 7})
+				req.Body = httptest.NewRequest("POST", "/", bytes.NewReader(other)).Body
+				return req
+			}(),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Event
+			handler := WebhookHandler(secret, func(e Event) error {
+				got = &e
+				return tt.handleErr
+			})
+
+			rec := httptest.NewRecorder()
+			handler(rec, tt.req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if (got != nil) != tt.wantEvent {
+				t.Fatalf("handler called = %v, want %v", got != nil, tt.wantEvent)
+			}
+			if got != nil && (got.ID != "evt-1" || got.Type != EventUserUpdated || got.UserID != 7) {
+				t.Errorf("event = %+v, want evt-1 user.updated for user 7", got)
+			}
+		})
+	}
+}
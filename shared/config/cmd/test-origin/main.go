@@ -0,0 +1,66 @@
+// Command test-origin checks origins against the shared CORS rules and
+// explains the result:
+//
+//	go run ./cmd/test-origin http://192.168.1.45:30010 http://evil.com
+//	go run ./cmd/test-origin -file ./cors-config.json http://localhost:3001
+//
+// It exits with status 1 if any origin is rejected or the file is invalid.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"pubgames/shared/config"
+)
+
+func main() {
+	file := flag.String("file", "", "CORS config file (default: the shared cors-config.json)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: test-origin [-file path] origin...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	path := *file
+	if path == "" {
+		var err error
+		if path, err = config.CORSConfigPath(); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	corsConfig, err := config.ReadCORSConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("📖 %s (mode=%s)\n\n", path, corsConfig.CORS.Mode)
+
+	rejected := false
+	for _, origin := range flag.Args() {
+		check := corsConfig.ExplainOrigin(origin)
+		if check.Allowed {
+			fmt.Printf("✅ ALLOW %s\n   matched %s\n", origin, check.Rule)
+		} else {
+			rejected = true
+			fmt.Printf("❌ BLOCK %s\n   %s\n", origin, check.Reason)
+		}
+		for _, rule := range check.Rules {
+			if !rule.Matched {
+				fmt.Printf("   - %-30s %s\n", rule.Rule, rule.Reason)
+			}
+		}
+		fmt.Println()
+	}
+
+	if rejected {
+		os.Exit(1)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 )
 
@@ -18,6 +17,9 @@ type CORSConfig struct {
 	CORS        CORSRules `json:"cors"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	UpdatedBy   string    `json:"updated_by"`
+
+	// rules are the parsed patterns or origins (see origin.go)
+	rules []*originRule
 }
 
 // CORSRules contains the actual CORS rules
@@ -27,42 +29,100 @@ type CORSRules struct {
 	ExplicitOrigins []string `json:"explicit_origins"`
 }
 
+// CORSConfigPath returns where the shared CORS config file lives: in the
+// service's config_dir when one is set (see ServiceConfig), otherwise
+// under the home directory
+func CORSConfigPath() (string, error) {
+	if configDir != "" {
+		return filepath.Join(configDir, "cors-config.json"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine home directory: %w", err)
+	}
+	return filepath.Join(homeDir, "pubgames-v2", "shared", "config", "cors-config.json"), nil
+}
+
 // LoadCORSConfig loads the CORS configuration from the shared config file
 // Falls back to safe defaults if file is missing or invalid
 func LoadCORSConfig() (*CORSConfig, error) {
 	// Try to find config file in shared directory
-	homeDir, err := os.UserHomeDir()
+	configPath, err := CORSConfigPath()
 	if err != nil {
-		log.Printf("Warning: Could not determine home directory: %v", err)
+		log.Printf("Warning: %v", err)
 		return getDefaultConfig(), nil
 	}
 
-	configPath := filepath.Join(homeDir, "pubgames-v2", "shared", "config", "cors-config.json")
-
 	// Check if file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Printf("Warning: CORS config file not found at %s, using defaults", configPath)
 		return getDefaultConfig(), nil
 	}
 
-	// Read file
-	data, err := os.ReadFile(configPath)
+	config, err := ReadCORSConfig(configPath)
 	if err != nil {
-		log.Printf("Warning: Could not read CORS config: %v, using defaults", err)
+		log.Printf("Warning: %v, using defaults", err)
 		return getDefaultConfig(), nil
 	}
 
-	// Parse JSON
+	log.Printf("✅ Loaded CORS config: mode=%s, environment=%s", config.CORS.Mode, config.Environment)
+	return config, nil
+}
+
+// ReadCORSConfig reads, parses and validates a config file. Unlike
+// LoadCORSConfig it never falls back to defaults.
+func ReadCORSConfig(path string) (*CORSConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CORS config: %w", err)
+	}
+
 	var config CORSConfig
 	if err := json.Unmarshal(data, &config); err != nil {
-		log.Printf("Warning: Could not parse CORS config: %v, using defaults", err)
-		return getDefaultConfig(), nil
+		return nil, fmt.Errorf("could not parse CORS config: %w", err)
 	}
 
-	log.Printf("✅ Loaded CORS config: mode=%s, environment=%s", config.CORS.Mode, config.Environment)
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid CORS config: %w", err)
+	}
+	config.compile()
 	return &config, nil
 }
 
+// Validate checks the rules make sense: a known mode, and patterns and
+// origins that parse as scheme://host[:port] with no path. Explicit
+// origins may not use wildcards, subnets or port ranges.
+func (c *CORSConfig) Validate() error {
+	switch c.CORS.Mode {
+	case "pattern":
+		if len(c.CORS.Patterns) == 0 {
+			return fmt.Errorf("pattern mode needs at least one pattern")
+		}
+		for _, pattern := range c.CORS.Patterns {
+			if _, err := parseOriginRule(pattern); err != nil {
+				return fmt.Errorf("pattern %q: %w", pattern, err)
+			}
+		}
+	case "explicit":
+		if len(c.CORS.ExplicitOrigins) == 0 {
+			return fmt.Errorf("explicit mode needs at least one origin")
+		}
+		for _, origin := range c.CORS.ExplicitOrigins {
+			rule, err := parseOriginRule(origin)
+			if err != nil {
+				return fmt.Errorf("origin %q: %w", origin, err)
+			}
+			if rule.hasWildcards {
+				return fmt.Errorf("origin %q: wildcards, subnets and port ranges are only allowed in pattern mode", origin)
+			}
+		}
+	default:
+		return fmt.Errorf("mode must be \"pattern\" or \"explicit\", not %q", c.CORS.Mode)
+	}
+	return nil
+}
+
 // getDefaultConfig returns safe default configuration for development
 func getDefaultConfig() *CORSConfig {
 	config := &CORSConfig{
@@ -75,83 +135,30 @@ func getDefaultConfig() *CORSConfig {
 	config.CORS.Mode = "pattern"
 	config.CORS.Patterns = []string{"http://localhost:*"}
 	config.CORS.ExplicitOrigins = []string{}
+	config.compile()
 
 	log.Println("⚠️  Using default CORS config (localhost only)")
 	return config
 }
 
-// IsOriginAllowed checks if an origin is allowed based on configuration
+// IsOriginAllowed checks if an origin is allowed based on configuration.
+// Scheme, host and port are matched separately (see origin.go), so
+// "http://192.168.1.*:*" does not let in http://192.168.1.evil.com.
 func (c *CORSConfig) IsOriginAllowed(origin string) bool {
-	if c.CORS.Mode == "explicit" {
-		// Explicit mode - must match exactly
-		for _, allowed := range c.CORS.ExplicitOrigins {
-			if origin == allowed {
-				return true
-			}
-		}
+	o, err := parseOrigin(origin)
+	if err != nil {
 		return false
 	}
 
-	// Pattern mode - match against patterns
-	for _, pattern := range c.CORS.Patterns {
-		if matchPattern(origin, pattern) {
+	rules, errs := c.compiledRules()
+	for i, rule := range rules {
+		if errs[i] == nil && rule.mismatch(o) == "" {
 			return true
 		}
 	}
 	return false
 }
 
-// matchPattern checks if origin matches a pattern with * wildcard
-// Supports patterns like:
-//   - "http://localhost:*" (any port on localhost)
-//   - "http://192.168.1.*:*" (any host/port in subnet)
-//   - "https://example.com" (exact match)
-func matchPattern(origin, pattern string) bool {
-	// Exact wildcard
-	if pattern == "*" {
-		return true
-	}
-
-	// No wildcards - exact match
-	if !strings.Contains(pattern, "*") {
-		return origin == pattern
-	}
-
-	// Split into parts for wildcard matching
-	// Simple implementation: split by "*" and check if all non-wildcard parts match in order
-	parts := strings.Split(pattern, "*")
-
-	// Origin must start with first part
-	if !strings.HasPrefix(origin, parts[0]) {
-		return false
-	}
-
-	// Check remaining parts appear in order
-	currentPos := len(parts[0])
-	for i := 1; i < len(parts); i++ {
-		part := parts[i]
-		if part == "" {
-			continue // consecutive wildcards or trailing wildcard
-		}
-
-		// Find part in remaining origin string
-		idx := strings.Index(origin[currentPos:], part)
-		if idx == -1 {
-			return false
-		}
-		currentPos += idx + len(part)
-	}
-
-	// If pattern ends with *, we're done
-	// If not, origin must end with the last part
-	lastPart := parts[len(parts)-1]
-	if lastPart != "" && !strings.HasSuffix(origin, lastPart) {
-		return false
-	}
-
-	return true
-}
-
 // GetAllowedOrigins returns a list of all allowed origins for logging/debugging
 // For pattern mode, returns the patterns themselves
 // For explicit mode, returns the explicit list
@@ -163,14 +170,17 @@ func (c *CORSConfig) GetAllowedOrigins() []string {
 }
 
 // SaveCORSConfig saves the configuration back to the file
-// This can be used by an admin UI to update configuration
+// This can be used by an admin UI to update configuration. Services
+// watching the file (see WatchCORSConfig) pick the change up.
 func SaveCORSConfig(config *CORSConfig) error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("could not determine home directory: %w", err)
+	if err := config.Validate(); err != nil {
+		return err
 	}
 
-	configPath := filepath.Join(homeDir, "pubgames-v2", "shared", "config", "cors-config.json")
+	configPath, err := CORSConfigPath()
+	if err != nil {
+		return err
+	}
 
 	// Update timestamp
 	config.UpdatedAt = time.Now()
@@ -181,8 +191,17 @@ func SaveCORSConfig(config *CORSConfig) error {
 		return fmt.Errorf("could not marshal config: %w", err)
 	}
 
-	// Write file
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	// Write to a temporary file and rename it over the old one, so
+	// watchers never read a half-written file
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("could not create config directory: %w", err)
+	}
+	tmpPath := configPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("could not write config file: %w", err)
+	}
+	if err := os.Rename(tmpPath, configPath); err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("could not write config file: %w", err)
 	}
 
@@ -0,0 +1,369 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CORS rules are parsed into scheme, host and port parts and compared
+// part by part, so a wildcard can never spill over into another part of
+// the origin. A rule is written scheme://host[:port]:
+//
+//	scheme  http, https or * (either)
+//	host    localhost                 exact name or IP address
+//	        *                         any host
+//	        *.example.com             any subdomain of example.com
+//	        192.168.1.*               IPv4 addresses with * for whole octets
+//	        192.168.1.0/24            IP addresses in a subnet ([fd00::]/8 for IPv6)
+//	port    omitted                   the scheme's default port (80 or 443)
+//	        *                         any port
+//	        30000                     exactly that port
+//	        30000-30099               a range
+//
+// A rule of just "*" allows every origin. In explicit mode every rule must
+// be a single origin (no wildcards, subnets or ranges).
+
+// originRule is one parsed pattern or explicit origin
+type originRule struct {
+	raw      string
+	anything bool
+
+	scheme string // "" for any
+
+	hostAny    bool
+	hostExact  string
+	hostSuffix string   // "*.example.com" is stored as ".example.com"
+	hostOctets []string // "192.168.1.*" is stored as ["192" "168" "1" "*"]
+	hostNet    *net.IPNet
+
+	portAny      bool
+	portDefault  bool
+	portMin      int
+	portMax      int
+	hasWildcards bool
+}
+
+// origin is a parsed Origin header
+type origin struct {
+	scheme string
+	host   string
+	ip     net.IP // nil unless host is an IP address
+	port   int
+}
+
+// RuleResult is how one rule compared to an origin
+type RuleResult struct {
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// OriginCheck explains whether an origin is allowed, and which rule let it
+// in or why each rule turned it away
+type OriginCheck struct {
+	Origin  string       `json:"origin"`
+	Allowed bool         `json:"allowed"`
+	Mode    string       `json:"mode"`
+	Rule    string       `json:"rule,omitempty"`
+	Reason  string       `json:"reason,omitempty"`
+	Rules   []RuleResult `json:"rules"`
+}
+
+// ExplainOrigin checks an origin against every rule and reports the result
+func (c *CORSConfig) ExplainOrigin(raw string) OriginCheck {
+	check := OriginCheck{Origin: raw, Mode: c.CORS.Mode, Rules: []RuleResult{}}
+
+	o, err := parseOrigin(raw)
+	if err != nil {
+		check.Reason = err.Error()
+		return check
+	}
+
+	raws := c.GetAllowedOrigins()
+	rules, errs := c.compiledRules()
+	for i, rule := range rules {
+		result := RuleResult{Rule: raws[i]}
+		if errs[i] != nil {
+			result.Reason = "invalid rule: " + errs[i].Error()
+		} else if reason := rule.mismatch(o); reason != "" {
+			result.Reason = reason
+		} else {
+			result.Matched = true
+			if !check.Allowed {
+				check.Allowed = true
+				check.Rule = rule.raw
+			}
+		}
+		check.Rules = append(check.Rules, result)
+	}
+
+	if !check.Allowed {
+		check.Reason = "no rule matches"
+	}
+	return check
+}
+
+// compiledRules returns the parsed rules for the current mode, parsing
+// them now if the config wasn't loaded through ReadCORSConfig. errs[i] is
+// set for rules that don't parse.
+func (c *CORSConfig) compiledRules() ([]*originRule, []error) {
+	raws := c.GetAllowedOrigins()
+	if c.rules != nil && len(c.rules) == len(raws) {
+		return c.rules, make([]error, len(raws))
+	}
+
+	rules := make([]*originRule, len(raws))
+	errs := make([]error, len(raws))
+	for i, raw := range raws {
+		rules[i], errs[i] = parseOriginRule(raw)
+	}
+	return rules, errs
+}
+
+// compile parses the rules once so origin checks don't have to. The config
+// must already be valid.
+func (c *CORSConfig) compile() {
+	rules, _ := c.compiledRules()
+	c.rules = rules
+}
+
+// parseOrigin splits an Origin header into its parts
+func parseOrigin(raw string) (*origin, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Opaque != "" {
+		return nil, fmt.Errorf("%q is not a valid origin", raw)
+	}
+	if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("an origin is only scheme://host[:port]")
+	}
+
+	o := &origin{scheme: strings.ToLower(u.Scheme), host: strings.ToLower(u.Hostname())}
+	if o.scheme != "http" && o.scheme != "https" {
+		return nil, fmt.Errorf("scheme %q is not http or https", u.Scheme)
+	}
+	o.ip = net.ParseIP(o.host)
+
+	if p := u.Port(); p != "" {
+		o.port, err = strconv.Atoi(p)
+		if err != nil || o.port < 1 || o.port > 65535 {
+			return nil, fmt.Errorf("port %q is not valid", p)
+		}
+	} else {
+		o.port = defaultPort(o.scheme)
+	}
+	return o, nil
+}
+
+// parseOriginRule parses a pattern or explicit origin
+func parseOriginRule(raw string) (*originRule, error) {
+	rule := &originRule{raw: raw}
+	if raw == "*" {
+		rule.anything = true
+		rule.hasWildcards = true
+		return rule, nil
+	}
+
+	scheme, rest, ok := strings.Cut(raw, "://")
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("must start with http://, https:// or *://")
+	case scheme == "*":
+		rule.hasWildcards = true
+	case scheme == "http" || scheme == "https":
+		rule.scheme = scheme
+	default:
+		return nil, fmt.Errorf("scheme %q is not http, https or *", scheme)
+	}
+
+	host, port, err := splitRuleHostPort(rest)
+	if err != nil {
+		return nil, err
+	}
+	if err := rule.parseHost(strings.ToLower(host)); err != nil {
+		return nil, err
+	}
+	if err := rule.parsePort(port); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// splitRuleHostPort splits "host[:port]", allowing [IPv6] hosts and CIDR
+// suffixes like 192.168.1.0/24
+func splitRuleHostPort(s string) (string, string, error) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return "", "", fmt.Errorf("missing ] after IPv6 address")
+		}
+		host, after := s[1:end], s[end+1:]
+		// [fd00::]/8 puts the prefix length outside the brackets
+		if prefix, ok := strings.CutPrefix(after, "/"); ok {
+			bits, port, _ := strings.Cut(prefix, ":")
+			host += "/" + bits
+			return host, port, nil
+		}
+		if after == "" {
+			return host, "", nil
+		}
+		port, ok := strings.CutPrefix(after, ":")
+		if !ok {
+			return "", "", fmt.Errorf("unexpected %q after IPv6 address", after)
+		}
+		return host, port, nil
+	}
+
+	if strings.ContainsAny(s, "?#") {
+		return "", "", fmt.Errorf("must not have a path")
+	}
+	host, port := s, ""
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		host, port = s[:i], s[i+1:]
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("missing host")
+	}
+	return host, port, nil
+}
+
+func (r *originRule) parseHost(host string) error {
+	switch {
+	case host == "*":
+		r.hostAny = true
+		r.hasWildcards = true
+
+	case strings.Contains(host, "/"):
+		_, network, err := net.ParseCIDR(host)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid subnet (and a rule must not have a path)", host)
+		}
+		r.hostNet = network
+		r.hasWildcards = true
+
+	case strings.HasPrefix(host, "*."):
+		suffix := host[1:]
+		if strings.Contains(suffix, "*") || len(suffix) < 2 {
+			return fmt.Errorf("host %q may only have * as its first label", host)
+		}
+		r.hostSuffix = suffix
+		r.hasWildcards = true
+
+	case strings.Contains(host, "*"):
+		octets := strings.Split(host, ".")
+		if len(octets) != 4 {
+			return fmt.Errorf("host %q: * is only allowed as a whole IPv4 octet or first label", host)
+		}
+		for _, octet := range octets {
+			if octet == "*" {
+				continue
+			}
+			if n, err := strconv.Atoi(octet); err != nil || n < 0 || n > 255 {
+				return fmt.Errorf("host %q: * is only allowed as a whole IPv4 octet or first label", host)
+			}
+		}
+		r.hostOctets = octets
+		r.hasWildcards = true
+
+	default:
+		if ip := net.ParseIP(host); ip != nil {
+			host = ip.String()
+		}
+		r.hostExact = host
+	}
+	return nil
+}
+
+func (r *originRule) parsePort(port string) error {
+	switch {
+	case port == "":
+		r.portDefault = true
+	case port == "*":
+		r.portAny = true
+		r.hasWildcards = true
+	case strings.Contains(port, "-"):
+		lo, hi, _ := strings.Cut(port, "-")
+		min, err1 := strconv.Atoi(lo)
+		max, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || min < 1 || max > 65535 || min > max {
+			return fmt.Errorf("port range %q is not valid", port)
+		}
+		r.portMin, r.portMax = min, max
+		r.hasWildcards = true
+	default:
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("port %q is not valid", port)
+		}
+		r.portMin, r.portMax = n, n
+	}
+	return nil
+}
+
+// mismatch returns why the rule doesn't match an origin, or "" if it does
+func (r *originRule) mismatch(o *origin) string {
+	if r.anything {
+		return ""
+	}
+
+	if r.scheme != "" && r.scheme != o.scheme {
+		return fmt.Sprintf("scheme is %s, rule needs %s", o.scheme, r.scheme)
+	}
+
+	switch {
+	case r.hostAny:
+	case r.hostNet != nil:
+		if o.ip == nil {
+			return fmt.Sprintf("host %s is not an IP address in %s", o.host, r.hostNet)
+		}
+		if !r.hostNet.Contains(o.ip) {
+			return fmt.Sprintf("host %s is not in %s", o.host, r.hostNet)
+		}
+	case r.hostSuffix != "":
+		if !strings.HasSuffix(o.host, r.hostSuffix) {
+			return fmt.Sprintf("host %s is not a subdomain of %s", o.host, r.hostSuffix[1:])
+		}
+	case r.hostOctets != nil:
+		ip4 := o.ip.To4()
+		if ip4 == nil {
+			return fmt.Sprintf("host %s is not an IPv4 address", o.host)
+		}
+		for i, octet := range r.hostOctets {
+			if octet != "*" && octet != strconv.Itoa(int(ip4[i])) {
+				return fmt.Sprintf("host %s does not match %s", o.host, strings.Join(r.hostOctets, "."))
+			}
+		}
+	default:
+		host := o.host
+		if o.ip != nil {
+			host = o.ip.String()
+		}
+		if host != r.hostExact {
+			return fmt.Sprintf("host is %s, rule needs %s", o.host, r.hostExact)
+		}
+	}
+
+	switch {
+	case r.portAny:
+	case r.portDefault:
+		if o.port != defaultPort(o.scheme) {
+			return fmt.Sprintf("port %d is not the default %s port %d", o.port, o.scheme, defaultPort(o.scheme))
+		}
+	case o.port < r.portMin || o.port > r.portMax:
+		if r.portMin == r.portMax {
+			return fmt.Sprintf("port is %d, rule needs %d", o.port, r.portMin)
+		}
+		return fmt.Sprintf("port %d is outside %d-%d", o.port, r.portMin, r.portMax)
+	}
+
+	return ""
+}
+
+func defaultPort(scheme string) int {
+	if scheme == "https" {
+		return 443
+	}
+	return 80
+}
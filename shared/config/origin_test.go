@@ -0,0 +1,134 @@
+package config
+
+import "testing"
+
+func TestIsOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   string
+		origin string
+		want   bool
+	}{
+		{"anything", "*", "https://evil.example:8443", true},
+
+		// Exact hosts and default ports
+		{"exact host default port", "http://localhost", "http://localhost", true},
+		{"exact host explicit default port", "http://localhost", "http://localhost:80", true},
+		{"exact host other port", "http://localhost", "http://localhost:3000", false},
+		{"exact host is case-insensitive", "http://LocalHost:3000", "http://localhost:3000", true},
+		{"exact host not a suffix", "http://localhost:3000", "http://evillocalhost:3000", false},
+		{"https default port", "https://pub.example.com", "https://pub.example.com:443", true},
+
+		// Schemes
+		{"scheme must match", "https://pub.example.com", "http://pub.example.com", false},
+		{"any scheme", "*://pub.example.com:*", "http://pub.example.com:8080", true},
+
+		// Subdomains
+		{"subdomain", "https://*.example.com", "https://pub.example.com", true},
+		{"nested subdomain", "https://*.example.com", "https://a.b.example.com", true},
+		{"subdomain wildcard needs a subdomain", "https://*.example.com", "https://example.com", false},
+		{"subdomain wildcard stops at the dot", "https://*.example.com", "https://evilexample.com", false},
+		{"subdomain wildcard doesn't spill into the port", "https://*.example.com", "https://pub.example.com:8443", false},
+
+		// IPv4 octets
+		{"octet wildcard", "http://192.168.1.*:3000", "http://192.168.1.42:3000", true},
+		{"octet wildcard other subnet", "http://192.168.1.*:3000", "http://192.168.2.42:3000", false},
+		{"octet wildcard needs an IP", "http://192.168.1.*:3000", "http://192.168.1.evil.com:3000", false},
+
+		// CIDR
+		{"cidr inside", "http://192.168.0.0/16:*", "http://192.168.44.7:30000", true},
+		{"cidr outside", "http://192.168.0.0/16:*", "http://10.0.0.1:30000", false},
+		{"cidr edge", "http://10.0.0.0/30:80", "http://10.0.0.3", true},
+		{"cidr past edge", "http://10.0.0.0/30:80", "http://10.0.0.4", false},
+		{"cidr needs an IP", "http://10.0.0.0/8:*", "http://10.example.com:80", false},
+		{"ipv6 cidr", "http://[fd00::]/8:*", "http://[fd12::1]:3000", true},
+		{"ipv6 cidr outside", "http://[fd00::]/8:*", "http://[fe80::1]:3000", false},
+		{"ipv6 exact", "http://[::1]:3000", "http://[0:0:0:0:0:0:0:1]:3000", true},
+
+		// Ports
+		{"any port", "http://localhost:*", "http://localhost:65535", true},
+		{"port range low", "http://localhost:30000-30099", "http://localhost:30000", true},
+		{"port range high", "http://localhost:30000-30099", "http://localhost:30099", true},
+		{"port range below", "http://localhost:30000-30099", "http://localhost:29999", false},
+		{"port range above", "http://localhost:30000-30099", "http://localhost:30100", false},
+		{"port range without default", "http://localhost:30000-30099", "http://localhost", false},
+		{"exact port", "http://localhost:3000", "http://localhost:3000", true},
+
+		// Bad origins are never allowed
+		{"origin with path", "*", "http://localhost:3000/app", false},
+		{"origin with credentials", "http://localhost:*", "http://user@localhost:3000", false},
+		{"origin with other scheme", "*://localhost:*", "ftp://localhost:21", false},
+		{"origin with bad port", "http://localhost:*", "http://localhost:70000", false},
+		{"null origin", "http://localhost:*", "null", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &CORSConfig{CORS: CORSRules{Mode: "pattern", Patterns: []string{tt.rule}}}
+			if err := c.Validate(); err != nil {
+				t.Fatalf("rule %q: %v", tt.rule, err)
+			}
+			if got := c.IsOriginAllowed(tt.origin); got != tt.want {
+				t.Errorf("rule %q, origin %q: got %v, want %v (%s)",
+					tt.rule, tt.origin, got, tt.want, c.ExplainOrigin(tt.origin).Reason)
+			}
+		})
+	}
+}
+
+func TestParseOriginRuleErrors(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr bool
+	}{
+		{"http://localhost:3000", false},
+		{"http://192.168.1.0/24:30000-30099", false},
+		{"http://[fd00::]/8:*", false},
+		{"localhost:3000", true},
+		{"ftp://localhost", true},
+		{"http://local*host", true},
+		{"http://*.*.example.com", true},
+		{"http://192.168.*:80", true},
+		{"http://192.168.1.0/33", true},
+		{"http://localhost:0", true},
+		{"http://localhost:99999", true},
+		{"http://localhost:30099-30000", true},
+		{"http://localhost:a-b", true},
+		{"http://[::1:3000", true},
+		{"http://:3000", true},
+		{"http://localhost/app", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			_, err := parseOriginRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseOriginRule(%q) error = %v, want error %v", tt.rule, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExplicitModeRejectsWildcards(t *testing.T) {
+	tests := []struct {
+		origin  string
+		wantErr bool
+	}{
+		{"http://localhost:3000", false},
+		{"https://pub.example.com", false},
+		{"http://localhost:*", true},
+		{"http://*.example.com", true},
+		{"http://192.168.1.0/24:80", true},
+		{"http://localhost:3000-3001", true},
+		{"*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			c := &CORSConfig{CORS: CORSRules{Mode: "explicit", ExplicitOrigins: []string{tt.origin}}}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ServiceConfig is a backend's deployment settings. LoadServiceConfig
+// builds it in layers, each overriding the one before:
+//
+//  1. defaults passed in by the service's main.go
+//  2. a JSON file named by -config or PUBGAMES_CONFIG
+//  3. environment variables (BACKEND_PORT, FRONTEND_PORT, DB_PATH,
+//     IDENTITY_SERVICE_URL, PUBGAMES_CONFIG_DIR, APP_CLIENT_ID,
+//     APP_CLIENT_SECRET, OIDC_ISSUER, WEBAUTHN_RP_ID, BOOTSTRAP_ADMIN,
+//     WEBHOOK_HOSTS, APP_HOST, MAIL_DRIVER, MAIL_FROM, MAIL_FILE,
+//     SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD)
+//  4. command-line flags (-port, -frontend-port, -db, -identity-url,
+//     -config-dir, -issuer, -rp-id, -bootstrap-admin, -webhook-hosts,
+//     -app-host, -mail-driver)
+//
+// so the same binary can run on the pub PC, on a dev machine and in tests.
+type ServiceConfig struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+
+	Port         string `json:"port"`
+	FrontendPort string `json:"frontend_port,omitempty"`
+	DBPath       string `json:"db_path"`
+
+	// IdentityServiceURL is where tokens are verified; empty for the
+	// Identity Service itself
+	IdentityServiceURL string `json:"identity_service_url,omitempty"`
+
+	// ConfigDir holds the shared cors-config.json; empty means
+	// ~/pubgames-v2/shared/config
+	ConfigDir string `json:"config_dir,omitempty"`
+
+	// ClientID and ClientSecret are the app's credentials for signed calls
+	// to the Identity Service. The secret is never included in Public.
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	// The rest are only used by the Identity Service
+
+	// Issuer is the OpenID Connect issuer URL put in ID tokens and the
+	// discovery document, e.g. http://192.168.1.10:3001
+	Issuer string `json:"oidc_issuer,omitempty"`
+
+	// WebAuthnRPID pins the passkey relying party ID, a hostname such as
+	// pub.example.com; empty means the hostname of the page asking
+	WebAuthnRPID string `json:"webauthn_rp_id,omitempty"`
+
+	// BootstrapAdmin is the email of an existing user to make admin at
+	// startup, used only while nobody holds the admin role
+	BootstrapAdmin string `json:"bootstrap_admin,omitempty"`
+
+	// WebhookHosts are the only hosts app webhooks are sent to, each
+	// "host" (any port) or "host:port". Kept apart from the CORS rules,
+	// which admit whole networks. WEBHOOK_HOSTS and -webhook-hosts take
+	// a comma-separated list.
+	WebhookHosts []string `json:"webhook_hosts,omitempty"`
+
+	// AppHost is the host the sample apps are registered on when the
+	// database is first created
+	AppHost string `json:"app_host,omitempty"`
+
+	// Outgoing email: MailDriver is smtp, file or log, and empty picks
+	// smtp when SMTPHost is set. SMTPPassword is never included in Public.
+	MailDriver   string `json:"mail_driver,omitempty"`
+	MailFrom     string `json:"mail_from,omitempty"`
+	MailFile     string `json:"mail_file,omitempty"`
+	SMTPHost     string `json:"smtp_host,omitempty"`
+	SMTPPort     string `json:"smtp_port,omitempty"`
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+}
+
+// configDir overrides where CORSConfigPath looks, set by LoadServiceConfig
+var configDir string
+
+// LoadServiceConfig layers the config file, environment and args (usually
+// os.Args[1:]) over defaults and validates the result. Every problem found
+// is reported in the error so they can all be fixed at once.
+func LoadServiceConfig(defaults ServiceConfig, args []string) (*ServiceConfig, error) {
+	cfg := defaults
+
+	fs := flag.NewFlagSet(defaults.Name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("PUBGAMES_CONFIG"), "JSON config file")
+	port := fs.String("port", "", "backend port")
+	frontendPort := fs.String("frontend-port", "", "frontend port")
+	dbPath := fs.String("db", "", "SQLite database path")
+	identityURL := fs.String("identity-url", "", "Identity Service URL")
+	dir := fs.String("config-dir", "", "directory holding cors-config.json")
+	issuer := fs.String("issuer", "", "OpenID Connect issuer URL (Identity Service)")
+	rpID := fs.String("rp-id", "", "passkey relying party ID (Identity Service)")
+	bootstrapAdmin := fs.String("bootstrap-admin", "", "email of a user to make admin while there is none (Identity Service)")
+	webhookHosts := fs.String("webhook-hosts", "", "comma-separated hosts webhooks may be sent to (Identity Service)")
+	appHost := fs.String("app-host", "", "host the sample apps are registered on (Identity Service)")
+	mailDriver := fs.String("mail-driver", "", "smtp, file or log (Identity Service)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// File
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("could not parse config file %s: %w", *configFile, err)
+		}
+	}
+
+	// Environment
+	for env, target := range map[string]*string{
+		"BACKEND_PORT":         &cfg.Port,
+		"FRONTEND_PORT":        &cfg.FrontendPort,
+		"DB_PATH":              &cfg.DBPath,
+		"IDENTITY_SERVICE_URL": &cfg.IdentityServiceURL,
+		"PUBGAMES_CONFIG_DIR":  &cfg.ConfigDir,
+		"APP_CLIENT_ID":        &cfg.ClientID,
+		"APP_CLIENT_SECRET":    &cfg.ClientSecret,
+		"OIDC_ISSUER":          &cfg.Issuer,
+		"WEBAUTHN_RP_ID":       &cfg.WebAuthnRPID,
+		"BOOTSTRAP_ADMIN":      &cfg.BootstrapAdmin,
+		"APP_HOST":             &cfg.AppHost,
+		"MAIL_DRIVER":          &cfg.MailDriver,
+		"MAIL_FROM":            &cfg.MailFrom,
+		"MAIL_FILE":            &cfg.MailFile,
+		"SMTP_HOST":            &cfg.SMTPHost,
+		"SMTP_PORT":            &cfg.SMTPPort,
+		"SMTP_USERNAME":        &cfg.SMTPUsername,
+		"SMTP_PASSWORD":        &cfg.SMTPPassword,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*target = value
+		}
+	}
+	if value := os.Getenv("WEBHOOK_HOSTS"); value != "" {
+		cfg.WebhookHosts = splitList(value)
+	}
+
+	// Flags, only where given
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "frontend-port":
+			cfg.FrontendPort = *frontendPort
+		case "db":
+			cfg.DBPath = *dbPath
+		case "identity-url":
+			cfg.IdentityServiceURL = *identityURL
+		case "config-dir":
+			cfg.ConfigDir = *dir
+		case "issuer":
+			cfg.Issuer = *issuer
+		case "rp-id":
+			cfg.WebAuthnRPID = *rpID
+		case "bootstrap-admin":
+			cfg.BootstrapAdmin = *bootstrapAdmin
+		case "webhook-hosts":
+			cfg.WebhookHosts = splitList(*webhookHosts)
+		case "app-host":
+			cfg.AppHost = *appHost
+		case "mail-driver":
+			cfg.MailDriver = *mailDriver
+		}
+	})
+
+	cfg.IdentityServiceURL = strings.TrimRight(cfg.IdentityServiceURL, "/")
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	configDir = cfg.ConfigDir
+	return &cfg, nil
+}
+
+// Validate reports every invalid setting
+func (c *ServiceConfig) Validate() error {
+	var problems []string
+
+	if msg := validatePort(c.Port); msg != "" {
+		problems = append(problems, "port "+msg)
+	}
+	if c.FrontendPort != "" {
+		if msg := validatePort(c.FrontendPort); msg != "" {
+			problems = append(problems, "frontend_port "+msg)
+		}
+	}
+	if c.DBPath == "" {
+		problems = append(problems, "db_path is required")
+	}
+	if c.IdentityServiceURL != "" {
+		u, err := url.Parse(c.IdentityServiceURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("identity_service_url %q must be an http(s) URL", c.IdentityServiceURL))
+		}
+	}
+	if c.Issuer != "" {
+		u, err := url.Parse(c.Issuer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			problems = append(problems, fmt.Sprintf("oidc_issuer %q must be an http(s) URL without a query", c.Issuer))
+		}
+	}
+	if c.WebAuthnRPID != "" && strings.ContainsAny(c.WebAuthnRPID, ":/ ") {
+		problems = append(problems, fmt.Sprintf("webauthn_rp_id %q must be a bare hostname", c.WebAuthnRPID))
+	}
+	for _, host := range c.WebhookHosts {
+		if host == "" || strings.ContainsAny(host, "/@ ") {
+			problems = append(problems, fmt.Sprintf("webhook_hosts entry %q must be a host or host:port", host))
+		}
+	}
+	if c.AppHost != "" && strings.ContainsAny(c.AppHost, "/ ") {
+		problems = append(problems, fmt.Sprintf("app_host %q must be a host or host:port", c.AppHost))
+	}
+	switch c.MailDriver {
+	case "", "log", "file":
+	case "smtp":
+		if c.SMTPHost == "" {
+			problems = append(problems, "smtp_host is required for the smtp mail_driver")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("mail_driver %q must be smtp, file or log", c.MailDriver))
+	}
+	if strings.ContainsAny(c.MailFrom, "\r\n") {
+		problems = append(problems, "mail_from must be a single line")
+	}
+	if c.SMTPPort != "" {
+		if msg := validatePort(c.SMTPPort); msg != "" {
+			problems = append(problems, "smtp_port "+msg)
+		}
+	}
+	if c.ConfigDir != "" {
+		if info, err := os.Stat(c.ConfigDir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("config_dir %q is not a directory", c.ConfigDir))
+		}
+	}
+	if (c.ClientID == "") != (c.ClientSecret == "") {
+		problems = append(problems, "client_id and client_secret must be set together")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid %s config: %s", c.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// HasClientCredentials reports whether the app can make signed calls to
+// the Identity Service
+func (c *ServiceConfig) HasClientCredentials() bool {
+	return c.ClientID != "" && c.ClientSecret != ""
+}
+
+// Public returns the settings safe to show in /api/config, which anyone
+// can read. Filesystem paths and client credentials are left out.
+func (c *ServiceConfig) Public() map[string]interface{} {
+	return map[string]interface{}{
+		"name":                 c.Name,
+		"version":              c.Version,
+		"port":                 c.Port,
+		"frontend_port":        c.FrontendPort,
+		"identity_service_url": c.IdentityServiceURL,
+	}
+}
+
+// WebhookHostAllowed reports whether a webhook may be sent to hostname
+// and port, as returned by url.URL's Hostname and Port
+func (c *ServiceConfig) WebhookHostAllowed(hostname, port string) bool {
+	for _, entry := range c.WebhookHosts {
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		entryHost = strings.Trim(entryHost, "[]")
+		if strings.EqualFold(entryHost, hostname) && (entryPort == "" || entryPort == port) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated setting, dropping blanks
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validatePort returns what's wrong with a port, or ""
+func validatePort(port string) string {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Sprintf("%q is not a number", port)
+	}
+	if n < 1 || n > 65535 {
+		return fmt.Sprintf("%d is out of range", n)
+	}
+	return ""
+}
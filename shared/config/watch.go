@@ -0,0 +1,134 @@
+package config
+
+import (
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CORS_RELOAD_INTERVAL is how often a watched config file is checked for
+// changes
+const CORS_RELOAD_INTERVAL = 2 * time.Second
+
+// CORSWatcher keeps a service's CORS rules in step with the shared config
+// file. Edits (by hand or through SaveCORSConfig) are picked up within a
+// few seconds and swapped in atomically, so requests always see either the
+// old rules or the new ones. A file that fails to parse or validate is
+// ignored and the previous rules stay in force.
+type CORSWatcher struct {
+	path    string
+	current atomic.Pointer[CORSConfig]
+
+	mu      sync.Mutex // serialises reloads
+	modTime time.Time
+	size    int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// WatchCORSConfig loads the CORS config like LoadCORSConfig and starts
+// watching the file for changes. Use it in place of LoadCORSConfig:
+//
+//	corsConfig := config.WatchCORSConfig()
+//	handlers.AllowedOriginValidator(corsConfig.IsOriginAllowed)
+func WatchCORSConfig() *CORSWatcher {
+	w := &CORSWatcher{stop: make(chan struct{})}
+
+	initial, _ := LoadCORSConfig()
+	w.current.Store(initial)
+
+	path, err := CORSConfigPath()
+	if err != nil {
+		log.Printf("Warning: Not watching CORS config: %v", err)
+		return w
+	}
+	w.path = path
+	if info, err := os.Stat(path); err == nil {
+		w.modTime = info.ModTime()
+		w.size = info.Size()
+	}
+
+	go w.watch()
+	return w
+}
+
+// Current returns the rules in force. The returned config must not be
+// modified.
+func (w *CORSWatcher) Current() *CORSConfig {
+	return w.current.Load()
+}
+
+// IsOriginAllowed checks an origin against the current rules
+func (w *CORSWatcher) IsOriginAllowed(origin string) bool {
+	return w.Current().IsOriginAllowed(origin)
+}
+
+// GetAllowedOrigins returns the current patterns or origins for logging
+func (w *CORSWatcher) GetAllowedOrigins() []string {
+	return w.Current().GetAllowedOrigins()
+}
+
+// Reload reads the file now rather than waiting for the next check, e.g.
+// straight after SaveCORSConfig. The current rules are kept on error.
+func (w *CORSWatcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	return w.reloadLocked(info)
+}
+
+// Stop ends the background checks
+func (w *CORSWatcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+// watch polls the file's modification time and size
+func (w *CORSWatcher) watch() {
+	ticker := time.NewTicker(CORS_RELOAD_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(w.path)
+		if err != nil {
+			continue
+		}
+
+		w.mu.Lock()
+		if !info.ModTime().Equal(w.modTime) || info.Size() != w.size {
+			if err := w.reloadLocked(info); err != nil {
+				log.Printf("Warning: Keeping previous CORS rules: %v", err)
+			}
+		}
+		w.mu.Unlock()
+	}
+}
+
+// reloadLocked reads and swaps in the file; w.mu must be held
+func (w *CORSWatcher) reloadLocked(info os.FileInfo) error {
+	// Remember this version even if it's invalid, so a bad edit is
+	// reported once rather than on every check
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+
+	config, err := ReadCORSConfig(w.path)
+	if err != nil {
+		return err
+	}
+
+	w.current.Store(config)
+	log.Printf("🔄 Reloaded CORS config: mode=%s, origins=%v", config.CORS.Mode, config.GetAllowedOrigins())
+	return nil
+}
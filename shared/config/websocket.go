@@ -0,0 +1,41 @@
+package config
+
+import (
+	"log"
+	"net/http"
+)
+
+// WebSocket handshakes aren't covered by the CORS middleware, so realtime
+// apps check the Origin header themselves. CheckOrigin builds that check
+// from the same rules as every other route, for use as
+// websocket.Upgrader.CheckOrigin:
+//
+//	upgrader.CheckOrigin = corsConfig.CheckOrigin()
+//
+// Requests with no Origin header aren't from a browser and are allowed,
+// as in gorilla/websocket's own default.
+
+// CheckOrigin returns an origin check that uses whatever rules are in force
+// at each handshake, so edits to the file apply without a restart
+func (w *CORSWatcher) CheckOrigin() func(r *http.Request) bool {
+	return checkOrigin(w.IsOriginAllowed)
+}
+
+// CheckOrigin returns an origin check against this config's rules
+func (c *CORSConfig) CheckOrigin() func(r *http.Request) bool {
+	return checkOrigin(c.IsOriginAllowed)
+}
+
+func checkOrigin(allowed func(origin string) bool) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if !allowed(origin) {
+			log.Printf("Warning: WebSocket origin blocked: %s", origin)
+			return false
+		}
+		return true
+	}
+}
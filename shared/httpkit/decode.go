@@ -0,0 +1,139 @@
+package httpkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// MAX_BODY_BYTES is the largest request body Decode accepts
+const MAX_BODY_BYTES = 1 << 20
+
+// ErrEmptyBody is returned by Decode when the request has no body, so
+// handlers with optional bodies can tell it apart from bad JSON
+var ErrEmptyBody = NewError(http.StatusBadRequest, CodeInvalidJSON, "Request body is empty")
+
+// Validator is implemented by request types that check their own fields;
+// Decode calls it after decoding. Plain errors become validation errors.
+type Validator interface {
+	Validate() error
+}
+
+// Decode reads a single JSON object from the request body into dst.
+// It rejects bodies over MAX_BODY_BYTES, unknown fields and trailing data,
+// and runs dst's Validate method if it has one. Errors are *Error values
+// ready for WriteError:
+//
+//	var req CreateThingRequest
+//	if err := httpkit.Decode(w, r, &req); err != nil {
+//		httpkit.WriteError(w, err)
+//		return
+//	}
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	return DecodeLimit(w, r, dst, MAX_BODY_BYTES)
+}
+
+// DecodeLimit is Decode with a different size limit
+func DecodeLimit(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64) error {
+	return decode(w, r, dst, limit, true)
+}
+
+// DecodeLenient is Decode but ignores unknown fields, for bodies whose
+// fields aren't ours to define (e.g. OAuth parameters, which clients may
+// extend and servers must ignore)
+func DecodeLenient(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	return decode(w, r, dst, MAX_BODY_BYTES, false)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64, strict bool) error {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	dec := json.NewDecoder(r.Body)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return decodeError(err)
+		}
+		return NewError(http.StatusBadRequest, CodeInvalidJSON, "Request body must be a single JSON object")
+	}
+
+	if v, ok := dst.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			var e *Error
+			if errors.As(err, &e) {
+				return e
+			}
+			return NewError(http.StatusBadRequest, CodeValidation, err.Error())
+		}
+	}
+	return nil
+}
+
+// decodeError turns a json or body error into a message the client can act on
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return ErrEmptyBody
+
+	case errors.As(err, &tooLarge):
+		return NewError(http.StatusRequestEntityTooLarge, CodeTooLarge,
+			fmt.Sprintf("Request body must be at most %d bytes", tooLarge.Limit))
+
+	case errors.As(err, &syntaxErr):
+		return NewError(http.StatusBadRequest, CodeInvalidJSON,
+			fmt.Sprintf("Request body is not valid JSON (at byte %d)", syntaxErr.Offset))
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return NewError(http.StatusBadRequest, CodeInvalidJSON, "Request body is not valid JSON")
+
+	case errors.As(err, &typeErr):
+		want := jsonKind(typeErr.Type)
+		if typeErr.Field == "" {
+			return NewError(http.StatusBadRequest, CodeInvalidJSON, "Request body must be "+want)
+		}
+		e := NewError(http.StatusBadRequest, CodeInvalidJSON, typeErr.Field+" must be "+want)
+		e.Fields = map[string]string{typeErr.Field: "must be " + want}
+		return e
+
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		e := NewError(http.StatusBadRequest, CodeInvalidJSON, fmt.Sprintf("Unknown field %q", field))
+		e.Fields = map[string]string{field: "unknown field"}
+		return e
+	}
+
+	return NewError(http.StatusBadRequest, CodeInvalidJSON, "Invalid request body")
+}
+
+// jsonKind describes a Go type in JSON terms, e.g. "a number"
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.String()
+}
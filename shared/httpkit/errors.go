@@ -0,0 +1,111 @@
+// Package httpkit is the JSON plumbing every PubGames backend shares:
+// error responses with typed codes, strict request decoding and field
+// validation, so clients see the same shapes from every service.
+package httpkit
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Code says what kind of error a response is, for clients that need more
+// than the HTTP status
+type Code string
+
+const (
+	CodeBadRequest   Code = "bad_request"
+	CodeInvalidJSON  Code = "invalid_json"
+	CodeValidation   Code = "validation_failed"
+	CodeUnauthorized Code = "unauthorized"
+	CodeForbidden    Code = "forbidden"
+	CodeNotFound     Code = "not_found"
+	CodeConflict     Code = "conflict"
+	CodeTooLarge     Code = "payload_too_large"
+	CodeRateLimited  Code = "rate_limited"
+	CodeInternal     Code = "internal_error"
+	CodeUnavailable  Code = "service_unavailable"
+)
+
+// CodeForStatus returns the usual code for an HTTP status
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Error is an error meant for the client. Fields maps request fields to
+// what's wrong with them, for validation errors.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Fields  map[string]string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError returns an error with the given status, code and message
+func NewError(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// ErrorResponse is the JSON body of every error. Code is the HTTP status,
+// as it always has been; ErrorCode is the typed code.
+type ErrorResponse struct {
+	Error     string            `json:"error"`
+	Code      int               `json:"code"`
+	ErrorCode Code              `json:"error_code"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// SendError sends a JSON error response, with the code chosen from the
+// status
+func SendError(w http.ResponseWriter, message string, status int) {
+	WriteError(w, &Error{Status: status, Code: CodeForStatus(status), Message: message})
+}
+
+// WriteError sends err as a JSON error response. Errors that aren't an
+// *Error are logged and sent as a plain 500, so internals never reach the
+// client.
+func WriteError(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		log.Printf("Warning: Internal error: %v", err)
+		e = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error"}
+	}
+
+	JSON(w, e.Status, ErrorResponse{
+		Error:     e.Message,
+		Code:      e.Status,
+		ErrorCode: e.Code,
+		Fields:    e.Fields,
+	})
+}
+
+// JSON sends v as a JSON response with the given status
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
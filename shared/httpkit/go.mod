@@ -0,0 +1,5 @@
+module pubgames/shared/httpkit
+
+go 1.25
+
+// No external dependencies needed for httpkit module
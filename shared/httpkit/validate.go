@@ -0,0 +1,104 @@
+package httpkit
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validation collects problems with a request's fields so they can all be
+// reported at once:
+//
+//	var v httpkit.Validation
+//	v.Required("name", req.Name)
+//	v.MaxLength("name", req.Name, 100)
+//	v.OneOf("status", req.Status, "open", "closed")
+//	return v.Err()
+//
+// Only the first problem with each field is kept.
+type Validation struct {
+	fields map[string]string
+}
+
+// Add records a problem with a field, e.g. ("name", "is required")
+func (v *Validation) Add(field, problem string) {
+	if v.fields == nil {
+		v.fields = make(map[string]string)
+	}
+	if _, exists := v.fields[field]; !exists {
+		v.fields[field] = problem
+	}
+}
+
+// Check records the problem unless ok
+func (v *Validation) Check(ok bool, field, problem string) {
+	if !ok {
+		v.Add(field, problem)
+	}
+}
+
+// Required checks a string isn't blank
+func (v *Validation) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// MaxLength checks a string has at most max characters
+func (v *Validation) MaxLength(field, value string, max int) {
+	v.Check(utf8.RuneCountInString(value) <= max, field, fmt.Sprintf("must be at most %d characters", max))
+}
+
+// Positive checks a number (usually an ID) is greater than zero
+func (v *Validation) Positive(field string, value int) {
+	v.Check(value > 0, field, "must be a positive number")
+}
+
+// Range checks min <= value <= max
+func (v *Validation) Range(field string, value, min, max int) {
+	v.Check(value >= min && value <= max, field, fmt.Sprintf("must be between %d and %d", min, max))
+}
+
+// OneOf checks a string is one of the allowed values
+func (v *Validation) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Add(field, "must be one of "+strings.Join(allowed, ", "))
+}
+
+// Email checks a string is a bare email address
+func (v *Validation) Email(field, value string) {
+	addr, err := mail.ParseAddress(value)
+	v.Check(err == nil && addr.Address == value, field, "must be a valid email address")
+}
+
+// Valid reports whether no problems were found
+func (v *Validation) Valid() bool {
+	return len(v.fields) == 0
+}
+
+// Err returns the problems as a validation *Error, or nil if there are none
+func (v *Validation) Err() error {
+	if v.Valid() {
+		return nil
+	}
+
+	names := make([]string, 0, len(v.fields))
+	for field := range v.fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	problems := make([]string, len(names))
+	for i, field := range names {
+		problems[i] = field + " " + v.fields[field]
+	}
+
+	e := NewError(http.StatusBadRequest, CodeValidation, strings.Join(problems, "; "))
+	e.Fields = v.fields
+	return e
+}
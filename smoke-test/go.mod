@@ -9,10 +9,16 @@ require (
 	golang.org/x/crypto v0.46.0
 	pubgames/shared/auth v0.0.0
 	pubgames/shared/config v0.0.0
+	pubgames/shared/httpkit v0.0.0
 )
 
-require github.com/felixge/httpsnoop v1.0.3 // indirect
+require (
+	github.com/felixge/httpsnoop v1.0.3 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.0 // indirect
+)
 
 replace pubgames/shared/auth => ../shared/auth
 
 replace pubgames/shared/config => ../shared/config
+
+replace pubgames/shared/httpkit => ../shared/httpkit
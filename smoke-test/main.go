@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -13,18 +14,32 @@ import (
 
 var db *sql.DB
 
+// serviceConfig holds the ports and paths this instance runs with
+var serviceConfig *config.ServiceConfig
+
 const (
-	APP_NAME         = "Smoke test"
-	APP_ICON         = "🃏"
-	BACKEND_PORT     = "30011" // Replace X with app number
-	FRONTEND_PORT    = "30010"
-	DB_PATH          = "./data/smoke-test.db"
-	IDENTITY_SERVICE = "http://localhost:3001"
+	APP_NAME    = "Smoke test"
+	APP_ICON    = "🃏"
+	APP_VERSION = "1.0.0"
 )
 
 func main() {
 	log.Printf("🚀 Starting %s...", APP_NAME)
 
+	// Settings: these defaults, then a config file, environment and flags
+	var err error
+	serviceConfig, err = config.LoadServiceConfig(config.ServiceConfig{
+		Name:               APP_NAME,
+		Version:            APP_VERSION,
+		Port:               "30011", // Replace X with app number
+		FrontendPort:       "30010",
+		DBPath:             "./data/smoke-test.db",
+		IdentityServiceURL: "http://localhost:3001",
+	}, os.Args[1:])
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
 	// Initialize database
 	initDB()
 	defer db.Close()
@@ -38,7 +53,7 @@ func main() {
 
 	// Protected routes (require authentication)
 	authMw := auth.AuthMiddleware(auth.Config{
-		IdentityServiceURL: IDENTITY_SERVICE,
+		IdentityServiceURL: serviceConfig.IdentityServiceURL,
 	})
 	api.HandleFunc("/data", authMw(getDataHandler)).Methods("GET")
 	api.HandleFunc("/items", authMw(getItemsHandler)).Methods("GET")
@@ -48,12 +63,10 @@ func main() {
 	adminMw := auth.AdminMiddleware
 	api.HandleFunc("/admin/stats", authMw(adminMw(getAdminStatsHandler))).Methods("GET")
 
-	// Load CORS configuration from shared config
-	corsConfig, err := config.LoadCORSConfig()
-	if err != nil {
-		log.Printf("Warning: CORS config load error: %v", err)
-	}
-	log.Printf("📋 CORS Mode: %s", corsConfig.CORS.Mode)
+	// Load CORS configuration from shared config, reloading it when the
+	// file changes
+	corsConfig := config.WatchCORSConfig()
+	log.Printf("📋 CORS Mode: %s", corsConfig.Current().CORS.Mode)
 	log.Printf("📋 Allowed Origins: %v", corsConfig.GetAllowedOrigins())
 
 	// CORS configuration using shared config
@@ -70,7 +83,7 @@ func main() {
 		handlers.AllowCredentials(),
 	)
 
-	log.Printf("✅ Backend running on :%s", BACKEND_PORT)
-	log.Printf("   Frontend should be at :%s", FRONTEND_PORT)
-	log.Fatal(http.ListenAndServe(":"+BACKEND_PORT, corsHandler(r)))
+	log.Printf("✅ Backend running on :%s", serviceConfig.Port)
+	log.Printf("   Frontend should be at :%s", serviceConfig.FrontendPort)
+	log.Fatal(http.ListenAndServe(":"+serviceConfig.Port, corsHandler(r)))
 }
\ No newline at end of file
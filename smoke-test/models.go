@@ -1,6 +1,10 @@
 package main
 
-import "time"
+import (
+	"time"
+
+	"pubgames/shared/httpkit"
+)
 
 // User represents a user in the system (from Identity Service)
 type User struct {
@@ -16,6 +20,10 @@ type Config struct {
 	AppName    string `json:"app_name"`
 	AppIcon    string `json:"app_icon"`
 	BackendURL string `json:"backend_url"`
+	Version    string `json:"version"`
+
+	// Settings are this instance's non-secret settings
+	Settings map[string]interface{} `json:"settings"`
 }
 
 // Item represents a sample data item (replace with your app's models)
@@ -26,9 +34,17 @@ type Item struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Details string `json:"details,omitempty"`
+// CreateItemRequest is the body of POST /api/items
+type CreateItemRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Validate checks the fields; httpkit.Decode calls it
+func (req CreateItemRequest) Validate() error {
+	var v httpkit.Validation
+	v.Required("name", req.Name)
+	v.MaxLength("name", req.Name, 100)
+	v.MaxLength("description", req.Description, 1000)
+	return v.Err()
 }
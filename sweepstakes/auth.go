@@ -5,8 +5,9 @@ package main
 // This file uses the shared authentication library from pubgames/shared/auth
 //
 // The shared library provides:
-// - AuthMiddleware: Validates JWT tokens with Identity Service
-// - AdminMiddleware: Ensures user has admin privileges
+// - AuthMiddleware: Validates JWT tokens locally using Identity Service signing keys
+// - RequireRole / RequireAny: Ensure the user holds the given roles
+// - Optional: Validates a token if one is sent, for public routes
 //
 // No need to reimplement authentication logic here.
 // Identity Service handles token generation.
@@ -17,7 +18,8 @@ package main
 //   Protected route (requires valid token):
 //   api.HandleFunc("/data", authMw(handler)).Methods("GET")
 //
-//   Admin route (requires valid token + admin flag):
+//   Admin route (requires valid token + admin role):
+//   adminMw := auth.RequireAny("admin")
 //   api.HandleFunc("/admin", authMw(adminMw(handler))).Methods("POST")
 //
 // See main.go for implementation examples.
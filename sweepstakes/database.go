@@ -13,14 +13,14 @@ import (
 // initDB initializes the database connection and creates tables
 func initDB() {
 	// Ensure data directory exists
-	dataDir := filepath.Dir(DB_PATH)
+	dataDir := filepath.Dir(serviceConfig.DBPath)
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
 	// Open database connection
 	var err error
-	db, err = sql.Open("sqlite3", DB_PATH)
+	db, err = sql.Open("sqlite3", serviceConfig.DBPath)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -43,6 +43,7 @@ func initDB() {
 		start_date DATETIME,
 		end_date DATETIME,
 		description TEXT,
+		venue_id INTEGER DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -62,10 +63,13 @@ func initDB() {
 	);
 
 	-- Draws table (user selections/assignments)
-	-- Note: user_email is the JWT sub (email) from Identity Service, not a local user_id
+	-- Note: user_id is the Identity Service user ID from the JWT; user_email
+	-- and user_name are as they were when the entry was drawn
 	CREATE TABLE IF NOT EXISTS draws (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
 		user_email TEXT NOT NULL,
+		user_name TEXT,
 		competition_id INTEGER NOT NULL,
 		entry_id INTEGER NOT NULL,
 		drawn_at DATETIME DEFAULT CURRENT_TIMESTAMP,
@@ -93,6 +97,9 @@ func ensureTableIntegrity() {
 	}{
 		{"entries", "eliminated_date", "DATETIME"},
 		{"entries", "position", "INTEGER"},
+		{"competitions", "venue_id", "INTEGER DEFAULT 1"},
+		{"draws", "user_id", "INTEGER"},
+		{"draws", "user_name", "TEXT"},
 	}
 
 	for _, col := range columns {
@@ -111,4 +118,8 @@ func ensureTableIntegrity() {
 			}
 		}
 	}
+
+	// Draws made before user IDs were stored have a NULL user_id until
+	// backfillDrawUserIDs, started from main, resolves their emails
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_draws_user ON draws(user_id, competition_id)")
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
@@ -13,6 +12,8 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
 )
 
 // getConfigHandler returns app configuration (public endpoint)
@@ -20,7 +21,9 @@ func getConfigHandler(w http.ResponseWriter, r *http.Request) {
 	config := Config{
 		AppName:    APP_NAME,
 		AppIcon:    APP_ICON,
-		BackendURL: "http://localhost:" + BACKEND_PORT,
+		Version:    APP_VERSION,
+		BackendURL: "http://localhost:" + serviceConfig.Port,
+		Settings:   serviceConfig.Public(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -33,10 +36,11 @@ func getCompetitionsHandler(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.Query(`
 		SELECT id, name, type, status, start_date, end_date, description, created_at
 		FROM competitions
+		WHERE venue_id = ?
 		ORDER BY created_at DESC
-	`)
+	`, auth.GetVenueID(r))
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	defer rows.Close()
@@ -69,9 +73,8 @@ func getCompetitionsHandler(w http.ResponseWriter, r *http.Request) {
 
 func createCompetitionHandler(w http.ResponseWriter, r *http.Request) {
 	var req Competition
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding competition request: %v", err)
-		sendError(w, "Invalid request body: "+err.Error(), 400)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 
@@ -79,16 +82,25 @@ func createCompetitionHandler(w http.ResponseWriter, r *http.Request) {
 		req.Status = "draft"
 	}
 
+	var v httpkit.Validation
+	v.Required("name", req.Name)
+	v.OneOf("type", req.Type, "knockout", "race")
+	v.OneOf("status", req.Status, COMPETITION_STATUSES...)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
 	log.Printf("Creating competition: %+v", req)
 
 	result, err := db.Exec(`
-		INSERT INTO competitions (name, type, status, start_date, end_date, description)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, req.Name, req.Type, req.Status, req.StartDate, req.EndDate, req.Description)
+		INSERT INTO competitions (name, type, status, start_date, end_date, description, venue_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, req.Name, req.Type, req.Status, req.StartDate, req.EndDate, req.Description, auth.GetVenueID(r))
 
 	if err != nil {
 		log.Printf("Error inserting competition: %v", err)
-		sendError(w, "Failed to create competition: "+err.Error(), 400)
+		httpkit.SendError(w, "Failed to create competition: "+err.Error(), 400)
 		return
 	}
 
@@ -104,12 +116,22 @@ func createCompetitionHandler(w http.ResponseWriter, r *http.Request) {
 func updateCompetitionHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if !competitionInVenue(w, r, id) {
+		return
+	}
 
 	var req Competition
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		log.Printf("Error decoding competition update: %v", err)
-		sendError(w, "Invalid request body: "+err.Error(), 400)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	var v httpkit.Validation
+	v.Required("name", req.Name)
+	v.OneOf("type", req.Type, "knockout", "race")
+	v.OneOf("status", req.Status, COMPETITION_STATUSES...)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 
@@ -128,12 +150,12 @@ func updateCompetitionHandler(w http.ResponseWriter, r *http.Request) {
 		`, id).Scan(&first, &second, &third)
 
 		if !first.Valid || first.Int64 == 0 {
-			sendError(w, "Cannot complete: No 1st place winner set. At least one entry must have position 1.", 400)
+			httpkit.SendError(w, "Cannot complete: No 1st place winner set. At least one entry must have position 1.", 400)
 			return
 		}
 	}
 
-	_, err = db.Exec(`
+	_, err := db.Exec(`
 		UPDATE competitions 
 		SET name = ?, type = ?, status = ?, start_date = ?, end_date = ?, description = ?
 		WHERE id = ?
@@ -141,7 +163,7 @@ func updateCompetitionHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("Error updating competition: %v", err)
-		sendError(w, "Failed to update: "+err.Error(), 500)
+		httpkit.SendError(w, "Failed to update: "+err.Error(), 500)
 		return
 	}
 
@@ -154,6 +176,9 @@ func updateCompetitionHandler(w http.ResponseWriter, r *http.Request) {
 func getEntriesHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	compID := vars["id"]
+	if !competitionInVenue(w, r, compID) {
+		return
+	}
 
 	rows, err := db.Query(`
 		SELECT id, competition_id, name, seed, number, status, eliminated_date, position
@@ -172,7 +197,7 @@ func getEntriesHandler(w http.ResponseWriter, r *http.Request) {
 	`, compID)
 	if err != nil {
 		log.Printf("Error querying entries: %v", err)
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
@@ -219,17 +244,20 @@ func getEntriesHandler(w http.ResponseWriter, r *http.Request) {
 
 func uploadEntriesHandler(w http.ResponseWriter, r *http.Request) {
 	compID := r.FormValue("competition_id")
+	if !competitionInVenue(w, r, compID) {
+		return
+	}
 
 	var compType string
 	err := db.QueryRow("SELECT type FROM competitions WHERE id = ?", compID).Scan(&compType)
 	if err != nil {
-		sendError(w, "Competition not found", 404)
+		httpkit.SendError(w, "Competition not found", 404)
 		return
 	}
 
 	file, _, err := r.FormFile("file")
 	if err != nil {
-		sendError(w, "No file uploaded", 400)
+		httpkit.SendError(w, "No file uploaded", 400)
 		return
 	}
 	defer file.Close()
@@ -237,7 +265,7 @@ func uploadEntriesHandler(w http.ResponseWriter, r *http.Request) {
 	reader := csv.NewReader(file)
 	records, err := reader.ReadAll()
 	if err != nil {
-		sendError(w, "Invalid CSV file", 400)
+		httpkit.SendError(w, "Invalid CSV file", 400)
 		return
 	}
 
@@ -300,16 +328,30 @@ func uploadEntriesHandler(w http.ResponseWriter, r *http.Request) {
 func updateEntryHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if !entryInVenue(w, r, id) {
+		return
+	}
 
 	var req Entry
-	json.NewDecoder(r.Body).Decode(&req)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	var v httpkit.Validation
+	v.Required("name", req.Name)
+	v.OneOf("status", req.Status, ENTRY_STATUSES...)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
 	// Prevent changing taken entries back to available
 	if req.Status == "available" {
 		var currentStatus string
 		db.QueryRow("SELECT status FROM entries WHERE id = ?", id).Scan(&currentStatus)
 		if currentStatus == "taken" {
-			sendError(w, "Cannot change a picked entry back to available. The entry has been selected by a user.", 400)
+			httpkit.SendError(w, "Cannot change a picked entry back to available. The entry has been selected by a user.", 400)
 			return
 		}
 	}
@@ -321,7 +363,7 @@ func updateEntryHandler(w http.ResponseWriter, r *http.Request) {
 	`, req.Name, req.Seed, req.Number, req.Status, id)
 
 	if err != nil {
-		sendError(w, err.Error(), 400)
+		httpkit.SendError(w, err.Error(), 400)
 		return
 	}
 
@@ -331,12 +373,25 @@ func updateEntryHandler(w http.ResponseWriter, r *http.Request) {
 func updateEntryPositionHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	compID := vars["id"]
+	if !competitionInVenue(w, r, compID) {
+		return
+	}
 
 	var req struct {
 		EntryID  int  `json:"entry_id"`
 		Position *int `json:"position"` // null to clear, or 1-5, 999
 	}
-	json.NewDecoder(r.Body).Decode(&req)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	var v httpkit.Validation
+	v.Positive("entry_id", req.EntryID)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
 	_, err := db.Exec(`
 		UPDATE entries 
@@ -345,7 +400,7 @@ func updateEntryPositionHandler(w http.ResponseWriter, r *http.Request) {
 	`, req.Position, req.EntryID, compID)
 
 	if err != nil {
-		sendError(w, err.Error(), 400)
+		httpkit.SendError(w, err.Error(), 400)
 		return
 	}
 
@@ -355,10 +410,13 @@ func updateEntryPositionHandler(w http.ResponseWriter, r *http.Request) {
 func deleteEntryHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if !entryInVenue(w, r, id) {
+		return
+	}
 
 	_, err := db.Exec("DELETE FROM entries WHERE id = ?", id)
 	if err != nil {
-		sendError(w, err.Error(), 400)
+		httpkit.SendError(w, err.Error(), 400)
 		return
 	}
 
@@ -368,6 +426,9 @@ func deleteEntryHandler(w http.ResponseWriter, r *http.Request) {
 func getAvailableCountHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	compID := vars["id"]
+	if !competitionInVenue(w, r, compID) {
+		return
+	}
 
 	var count int
 	db.QueryRow(`
@@ -384,19 +445,21 @@ func getAvailableCountHandler(w http.ResponseWriter, r *http.Request) {
 func getBlindBoxesHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	compID := vars["id"]
+	if !competitionInVenue(w, r, compID) {
+		return
+	}
 	
-	// Get user email from context (set by auth middleware)
-	userEmail := r.Context().Value("user_email").(string)
+	user := auth.GetUser(r)
 
 	// Check if user already has a selection
 	var existingCount int
 	err := db.QueryRow(`
 		SELECT COUNT(*) FROM draws 
-		WHERE user_email = ? AND competition_id = ?
-	`, userEmail, compID).Scan(&existingCount)
+		WHERE user_id = ? AND competition_id = ?
+	`, user.ID, compID).Scan(&existingCount)
 
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 
@@ -414,7 +477,7 @@ func getBlindBoxesHandler(w http.ResponseWriter, r *http.Request) {
 	`, compID).Scan(&totalAvailable)
 
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 
@@ -433,27 +496,39 @@ func getBlindBoxesHandler(w http.ResponseWriter, r *http.Request) {
 func chooseBlindBoxHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	compID := vars["id"]
+	if !competitionInVenue(w, r, compID) {
+		return
+	}
 
-	// Get user info from context
-	userEmail := r.Context().Value("user_email").(string)
+	user := auth.GetUser(r)
 
 	var req struct {
 		BoxNumber int `json:"box_number"`
 	}
-	json.NewDecoder(r.Body).Decode(&req)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
+
+	var v httpkit.Validation
+	v.Positive("box_number", req.BoxNumber)
+	if err := v.Err(); err != nil {
+		httpkit.WriteError(w, err)
+		return
+	}
 
 	tx, err := db.Begin()
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	defer tx.Rollback()
 
 	// Check if user already has an entry
 	var existingCount int
-	tx.QueryRow("SELECT COUNT(*) FROM draws WHERE user_email = ? AND competition_id = ?", userEmail, compID).Scan(&existingCount)
+	tx.QueryRow("SELECT COUNT(*) FROM draws WHERE user_id = ? AND competition_id = ?", user.ID, compID).Scan(&existingCount)
 	if existingCount > 0 {
-		sendError(w, "You already have an entry", 400)
+		httpkit.SendError(w, "You already have an entry", 400)
 		return
 	}
 
@@ -464,7 +539,7 @@ func chooseBlindBoxHandler(w http.ResponseWriter, r *http.Request) {
 		ORDER BY id
 	`, compID)
 	if err != nil {
-		sendError(w, "Failed to fetch entries", 500)
+		httpkit.SendError(w, "Failed to fetch entries", 500)
 		return
 	}
 	defer rows.Close()
@@ -477,7 +552,7 @@ func chooseBlindBoxHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.BoxNumber < 1 || req.BoxNumber > len(availableIDs) {
-		sendError(w, "Invalid box number", 400)
+		httpkit.SendError(w, "Invalid box number", 400)
 		return
 	}
 
@@ -485,23 +560,23 @@ func chooseBlindBoxHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Create draw
 	_, err = tx.Exec(`
-		INSERT INTO draws (user_email, competition_id, entry_id)
-		VALUES (?, ?, ?)
-	`, userEmail, compID, selectedEntryID)
+		INSERT INTO draws (user_id, user_email, user_name, competition_id, entry_id)
+		VALUES (?, ?, ?, ?, ?)
+	`, user.ID, user.Email, user.Name, compID, selectedEntryID)
 	if err != nil {
-		sendError(w, "Failed to assign entry", 500)
+		httpkit.SendError(w, "Failed to assign entry", 500)
 		return
 	}
 
 	// Mark entry as taken
 	_, err = tx.Exec("UPDATE entries SET status = 'taken' WHERE id = ?", selectedEntryID)
 	if err != nil {
-		sendError(w, "Failed to update entry", 500)
+		httpkit.SendError(w, "Failed to update entry", 500)
 		return
 	}
 
 	if err = tx.Commit(); err != nil {
-		sendError(w, "Failed to complete selection", 500)
+		httpkit.SendError(w, "Failed to complete selection", 500)
 		return
 	}
 
@@ -528,22 +603,24 @@ func chooseBlindBoxHandler(w http.ResponseWriter, r *http.Request) {
 func randomPickHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	compID := vars["id"]
+	if !competitionInVenue(w, r, compID) {
+		return
+	}
 
-	// Get user info from context
-	userEmail := r.Context().Value("user_email").(string)
+	user := auth.GetUser(r)
 
 	tx, err := db.Begin()
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	defer tx.Rollback()
 
 	// Check if user already has an entry
 	var existingCount int
-	tx.QueryRow("SELECT COUNT(*) FROM draws WHERE user_email = ? AND competition_id = ?", userEmail, compID).Scan(&existingCount)
+	tx.QueryRow("SELECT COUNT(*) FROM draws WHERE user_id = ? AND competition_id = ?", user.ID, compID).Scan(&existingCount)
 	if existingCount > 0 {
-		sendError(w, "You already have an entry", 400)
+		httpkit.SendError(w, "You already have an entry", 400)
 		return
 	}
 
@@ -557,29 +634,29 @@ func randomPickHandler(w http.ResponseWriter, r *http.Request) {
 	`, compID).Scan(&selectedEntryID)
 
 	if err != nil {
-		sendError(w, "No available entries", 400)
+		httpkit.SendError(w, "No available entries", 400)
 		return
 	}
 
 	// Create draw
 	_, err = tx.Exec(`
-		INSERT INTO draws (user_email, competition_id, entry_id)
-		VALUES (?, ?, ?)
-	`, userEmail, compID, selectedEntryID)
+		INSERT INTO draws (user_id, user_email, user_name, competition_id, entry_id)
+		VALUES (?, ?, ?, ?, ?)
+	`, user.ID, user.Email, user.Name, compID, selectedEntryID)
 	if err != nil {
-		sendError(w, "Failed to assign entry", 500)
+		httpkit.SendError(w, "Failed to assign entry", 500)
 		return
 	}
 
 	// Mark entry as taken
 	_, err = tx.Exec("UPDATE entries SET status = 'taken' WHERE id = ?", selectedEntryID)
 	if err != nil {
-		sendError(w, "Failed to update entry", 500)
+		httpkit.SendError(w, "Failed to update entry", 500)
 		return
 	}
 
 	if err = tx.Commit(); err != nil {
-		sendError(w, "Failed to complete selection", 500)
+		httpkit.SendError(w, "Failed to complete selection", 500)
 		return
 	}
 
@@ -608,9 +685,12 @@ func randomPickHandler(w http.ResponseWriter, r *http.Request) {
 func getCompetitionDrawsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	compID := vars["id"]
+	if !competitionInVenue(w, r, compID) {
+		return
+	}
 
 	rows, err := db.Query(`
-		SELECT d.id, d.user_email, d.competition_id, d.entry_id, d.drawn_at,
+		SELECT d.id, COALESCE(d.user_id, 0), COALESCE(d.user_name, d.user_email), d.competition_id, d.entry_id, d.drawn_at,
 		       e.name, e.status, e.seed, e.number, e.position
 		FROM draws d
 		JOIN entries e ON d.entry_id = e.id
@@ -622,22 +702,22 @@ func getCompetitionDrawsHandler(w http.ResponseWriter, r *http.Request) {
 				WHEN 'eliminated' THEN 2 
 			END,
 			CASE WHEN e.position IS NOT NULL THEN e.position ELSE 999 END,
-			d.user_email
+			COALESCE(d.user_name, d.user_email)
 	`, compID)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
 
 	draws := []map[string]interface{}{}
 	for rows.Next() {
-		var id, compID, entryID int
-		var userEmail, entryName, status string
+		var id, userID, compID, entryID int
+		var userName, entryName, status string
 		var drawnAt time.Time
 		var seed, number, position sql.NullInt64
 
-		err := rows.Scan(&id, &userEmail, &compID, &entryID, &drawnAt,
+		err := rows.Scan(&id, &userID, &userName, &compID, &entryID, &drawnAt,
 			&entryName, &status, &seed, &number, &position)
 
 		if err != nil {
@@ -646,7 +726,8 @@ func getCompetitionDrawsHandler(w http.ResponseWriter, r *http.Request) {
 
 		draw := map[string]interface{}{
 			"id":             id,
-			"user_email":     userEmail,
+			"user_id":        userID,
+			"user_name":      userName,
 			"competition_id": compID,
 			"entry_id":       entryID,
 			"entry_name":     entryName,
@@ -672,19 +753,17 @@ func getCompetitionDrawsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getUserDrawsHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user email from context
-	userEmail := r.Context().Value("user_email").(string)
+	user := auth.GetUser(r)
 	compID := r.URL.Query().Get("competition_id")
 
 	query := `
-		SELECT d.id, d.user_email, d.competition_id, d.entry_id, d.drawn_at,
+		SELECT d.id, d.user_id, COALESCE(d.user_name, d.user_email), d.competition_id, d.entry_id, d.drawn_at,
 		       e.name, e.status, c.status as comp_status, e.seed, e.number
 		FROM draws d
 		JOIN entries e ON d.entry_id = e.id
 		JOIN competitions c ON d.competition_id = c.id
-		WHERE d.user_email = ?
-	`
-	args := []interface{}{userEmail}
+		WHERE c.venue_id = ? AND d.user_id = ?`
+	args := []interface{}{user.Venue(), user.ID}
 
 	if compID != "" {
 		query += " AND d.competition_id = ?"
@@ -695,19 +774,19 @@ func getUserDrawsHandler(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
-		sendError(w, err.Error(), 500)
+		httpkit.SendError(w, err.Error(), 500)
 		return
 	}
 	defer rows.Close()
 
 	draws := []map[string]interface{}{}
 	for rows.Next() {
-		var id, compID, entryID int
-		var userEmail, entryName, status, compStatus string
+		var id, userID, compID, entryID int
+		var userName, entryName, status, compStatus string
 		var drawnAt time.Time
 		var seed, number sql.NullInt64
 
-		err := rows.Scan(&id, &userEmail, &compID, &entryID, &drawnAt,
+		err := rows.Scan(&id, &userID, &userName, &compID, &entryID, &drawnAt,
 			&entryName, &status, &compStatus, &seed, &number)
 
 		if err != nil {
@@ -719,7 +798,8 @@ func getUserDrawsHandler(w http.ResponseWriter, r *http.Request) {
 			"competition_id": compID,
 			"entry_id":       entryID,
 			"drawn_at":       drawnAt,
-			"user_email":     userEmail,
+			"user_id":        userID,
+			"user_name":      userName,
 			"entry_name":     entryName,
 			"entry_status":   status,
 		}
@@ -742,18 +822,19 @@ func getUserDrawsHandler(w http.ResponseWriter, r *http.Request) {
 
 func acquireSelectionLockHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	if !competitionInVenue(w, r, vars["id"]) {
+		return
+	}
 	compID, _ := strconv.Atoi(vars["id"])
 
-	// Get user info from context
-	userEmail := r.Context().Value("user_email").(string)
-	userName := r.Context().Value("user_name").(string)
+	user := auth.GetUser(r)
 
 	lockMutex.Lock()
 	defer lockMutex.Unlock()
 
 	if lock, exists := selectionLocks[compID]; exists {
 		if time.Since(lock.LockedAt) < 2*time.Minute {
-			if lock.UserEmail == userEmail {
+			if lock.UserID == user.ID {
 				lock.LockedAt = time.Now()
 				w.WriteHeader(http.StatusOK)
 				json.NewEncoder(w).Encode(map[string]bool{"acquired": true})
@@ -772,8 +853,8 @@ func acquireSelectionLockHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	selectionLocks[compID] = &SelectionLock{
-		UserEmail:     userEmail,
-		UserName:      userName,
+		UserID:        user.ID,
+		UserName:      user.Name,
 		LockedAt:      time.Now(),
 		CompetitionID: compID,
 	}
@@ -784,16 +865,18 @@ func acquireSelectionLockHandler(w http.ResponseWriter, r *http.Request) {
 
 func releaseSelectionLockHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	if !competitionInVenue(w, r, vars["id"]) {
+		return
+	}
 	compID, _ := strconv.Atoi(vars["id"])
 
-	// Get user email from context
-	userEmail := r.Context().Value("user_email").(string)
+	user := auth.GetUser(r)
 
 	lockMutex.Lock()
 	defer lockMutex.Unlock()
 
 	if lock, exists := selectionLocks[compID]; exists {
-		if lock.UserEmail == userEmail {
+		if lock.UserID == user.ID {
 			delete(selectionLocks, compID)
 		}
 	}
@@ -803,10 +886,12 @@ func releaseSelectionLockHandler(w http.ResponseWriter, r *http.Request) {
 
 func checkSelectionLockHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	if !competitionInVenue(w, r, vars["id"]) {
+		return
+	}
 	compID, _ := strconv.Atoi(vars["id"])
 	
-	// Get user email from context
-	userEmail := r.Context().Value("user_email").(string)
+	user := auth.GetUser(r)
 
 	lockMutex.Lock()
 	defer lockMutex.Unlock()
@@ -826,7 +911,7 @@ func checkSelectionLockHandler(w http.ResponseWriter, r *http.Request) {
 			"locked":     true,
 			"locked_by":  lock.UserName,
 			"locked_at":  lock.LockedAt,
-			"is_me":      lock.UserEmail == userEmail,
+			"is_me":      lock.UserID == user.ID,
 			"locked_for": int(time.Since(lock.LockedAt).Seconds()),
 		})
 		return
@@ -837,28 +922,3 @@ func checkSelectionLockHandler(w http.ResponseWriter, r *http.Request) {
 		"locked": false,
 	})
 }
-
-// ===== UTILITY FUNCTIONS =====
-
-func sendError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{
-		Error: message,
-		Code:  code,
-	})
-}
-
-// Helper to get user info from context (set by auth middleware)
-func getUserFromContext(ctx context.Context) (email string, name string, isAdmin bool) {
-	if val := ctx.Value("user_email"); val != nil {
-		email = val.(string)
-	}
-	if val := ctx.Value("user_name"); val != nil {
-		name = val.(string)
-	}
-	if val := ctx.Value("is_admin"); val != nil {
-		isAdmin = val.(bool)
-	}
-	return
-}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"pubgames/shared/auth"
+)
+
+// Draws are keyed by the player's Identity Service user ID. Draws made
+// before that only have the email they were made under; at startup
+// backfillDrawUserIDs asks the Identity Service who those emails belong
+// to and fills in user_id once, so requests never have to.
+
+// directory looks up players in the Identity Service. It is nil without
+// client credentials, in which case old draws keep a NULL user_id.
+var directory *auth.Directory
+
+// initDirectory sets up the user directory. It needs client credentials
+// created by an admin with POST /api/admin/clients, granted the
+// users:emails scope to match old draws, set as client_id/client_secret
+// in the service config (or APP_CLIENT_ID and APP_CLIENT_SECRET).
+func initDirectory() {
+	if !serviceConfig.HasClientCredentials() {
+		log.Println("ℹ️  APP_CLIENT_ID/APP_CLIENT_SECRET not set; old draws won't be matched to user IDs")
+		return
+	}
+
+	client := auth.NewServiceClient(serviceConfig.IdentityServiceURL, serviceConfig.ClientID, serviceConfig.ClientSecret)
+	directory = auth.NewDirectory(client, 0)
+}
+
+// backfillDrawUserIDs gives email-only draws the user ID their email
+// resolves to. Emails the Identity Service can't pin to one account are
+// left alone rather than guessed. The Identity Service may still be
+// starting, so failures are retried.
+func backfillDrawUserIDs() {
+	rows, err := db.Query("SELECT DISTINCT lower(user_email) FROM draws WHERE user_id IS NULL AND user_email IS NOT NULL")
+	if err != nil {
+		log.Printf("Warning: Could not find draws without a user ID: %v", err)
+		return
+	}
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err == nil {
+			emails = append(emails, email)
+		}
+	}
+	rows.Close()
+
+	if len(emails) == 0 {
+		return
+	}
+	if directory == nil {
+		log.Printf("ℹ️  %d players' draws have no user ID; set client credentials to match them", len(emails))
+		return
+	}
+
+	var owners map[string]int
+	for attempt, wait := 1, 2*time.Second; ; attempt, wait = attempt+1, wait*2 {
+		owners, err = directory.LookupEmails(emails)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, auth.ErrLookupForbidden) {
+			log.Printf("ℹ️  %d players' draws have no user ID; grant this app's client the users:emails scope to match them", len(emails))
+			return
+		}
+		if attempt == 5 {
+			log.Printf("❌ Could not match old draws to users: %v", err)
+			return
+		}
+		log.Printf("Warning: Draw backfill attempt %d failed: %v", attempt, err)
+		time.Sleep(wait)
+	}
+
+	ids := make([]int, 0, len(owners))
+	for _, id := range owners {
+		ids = append(ids, id)
+	}
+	users, err := directory.Lookup(ids)
+	if err != nil {
+		log.Printf("Warning: Could not look up names for old draws: %v", err)
+	}
+
+	claimed := 0
+	for email, id := range owners {
+		var name interface{}
+		if u, ok := users[id]; ok {
+			name = u.Name
+		}
+		result, err := db.Exec(`
+			UPDATE draws SET user_id = ?, user_name = COALESCE(?, user_name)
+			WHERE user_id IS NULL AND lower(user_email) = ?
+		`, id, name, strings.ToLower(email))
+		if err != nil {
+			log.Printf("Warning: Could not backfill draws for user %d: %v", id, err)
+			continue
+		}
+		n, _ := result.RowsAffected()
+		claimed += int(n)
+	}
+
+	log.Printf("✅ Matched %d old draws to user IDs", claimed)
+	if unresolved := len(emails) - len(owners); unresolved > 0 {
+		log.Printf("ℹ️  %d emails on old draws don't belong to exactly one user and were left unmatched", unresolved)
+	}
+}
+
+// identityEventHandler keeps the names shown on draws up to date when a
+// player renames themselves. Draws of a deleted player lose their name and
+// email, as the Identity Service's copy has; those of a player merged into
+// another account move across to it.
+func identityEventHandler(event auth.Event) error {
+	switch event.Type {
+	case auth.EventUserUpdated:
+		return refreshDrawNames(event.UserID)
+	case auth.EventUserDeleted:
+		directory.Forget(event.UserID)
+		if event.MergedInto != 0 {
+			if _, err := db.Exec("UPDATE draws SET user_id = ? WHERE user_id = ?", event.MergedInto, event.UserID); err != nil {
+				return err
+			}
+			return refreshDrawNames(event.MergedInto)
+		}
+		_, err := db.Exec("UPDATE draws SET user_email = '', user_name = 'Deleted user' WHERE user_id = ?", event.UserID)
+		return err
+	}
+	return nil
+}
+
+// refreshDrawNames copies a player's current name onto their draws
+func refreshDrawNames(userID int) error {
+	directory.Forget(userID)
+	users, err := directory.Lookup([]int{userID})
+	if err != nil {
+		return err
+	}
+	u, ok := users[userID]
+	if !ok {
+		return nil
+	}
+	_, err = db.Exec("UPDATE draws SET user_name = ? WHERE user_id = ?", u.Name, userID)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
 	"sync"
 
 	"github.com/gorilla/handlers"
@@ -14,35 +15,59 @@ import (
 
 var db *sql.DB
 
+// serviceConfig holds the ports and paths this instance runs with
+var serviceConfig *config.ServiceConfig
+
 // Selection locks - in-memory store for blind box selection
 var selectionLocks = make(map[int]*SelectionLock)
 var lockMutex sync.Mutex
 
 const (
-	APP_NAME         = "Sweepstakes"
-	APP_ICON         = "⌨️"
-	BACKEND_PORT     = "30031"
-	FRONTEND_PORT    = "30030"
-	DB_PATH          = "./data/sweepstakes.db"
-	IDENTITY_SERVICE = "http://localhost:3001"
+	APP_NAME    = "Sweepstakes"
+	APP_ICON    = "⌨️"
+	APP_VERSION = "1.0.0"
 )
 
 func main() {
 	log.Printf("🚀 Starting %s...", APP_NAME)
 
+	// Settings: these defaults, then a config file, environment and flags
+	var err error
+	serviceConfig, err = config.LoadServiceConfig(config.ServiceConfig{
+		Name:               APP_NAME,
+		Version:            APP_VERSION,
+		Port:               "30031",
+		FrontendPort:       "30030",
+		DBPath:             "./data/sweepstakes.db",
+		IdentityServiceURL: "http://localhost:3001",
+	}, os.Args[1:])
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	// User directory, for names and avatars
+	initDirectory()
+
 	// Initialize database
 	initDB()
 	defer db.Close()
 
+	// Needs both the directory and the database
+	go backfillDrawUserIDs()
+
 	// Setup router
 	r := mux.NewRouter()
 	api := r.PathPrefix("/api").Subrouter()
 
 	// Setup auth middleware
-	authMw := auth.AuthMiddleware(auth.Config{
-		IdentityServiceURL: IDENTITY_SERVICE,
-	})
-	adminMw := auth.AdminMiddleware
+	authConfig := auth.Config{
+		IdentityServiceURL: serviceConfig.IdentityServiceURL,
+	}
+	authMw := auth.AuthMiddleware(authConfig)
+	adminMw := auth.RequireAny("admin")
+	// Guests can look around but taking part needs the player role, which
+	// guests don't have
+	playerMw := auth.RequireRole("player")
 
 	// ===== PUBLIC ROUTES =====
 	api.HandleFunc("/config", getConfigHandler).Methods("GET")
@@ -56,9 +81,9 @@ func main() {
 	
 	// Blind box selection routes
 	api.HandleFunc("/competitions/{id}/blind-boxes", authMw(getBlindBoxesHandler)).Methods("GET")
-	api.HandleFunc("/competitions/{id}/choose-blind-box", authMw(chooseBlindBoxHandler)).Methods("POST")
-	api.HandleFunc("/competitions/{id}/random-pick", authMw(randomPickHandler)).Methods("POST")
-	api.HandleFunc("/competitions/{id}/lock", authMw(acquireSelectionLockHandler)).Methods("POST")
+	api.HandleFunc("/competitions/{id}/choose-blind-box", authMw(playerMw(chooseBlindBoxHandler))).Methods("POST")
+	api.HandleFunc("/competitions/{id}/random-pick", authMw(playerMw(randomPickHandler))).Methods("POST")
+	api.HandleFunc("/competitions/{id}/lock", authMw(playerMw(acquireSelectionLockHandler))).Methods("POST")
 	api.HandleFunc("/competitions/{id}/unlock", authMw(releaseSelectionLockHandler)).Methods("POST")
 	api.HandleFunc("/competitions/{id}/lock-status", authMw(checkSelectionLockHandler)).Methods("GET")
 	
@@ -76,12 +101,17 @@ func main() {
 	api.HandleFunc("/entries/{id}", authMw(adminMw(updateEntryHandler))).Methods("PUT")
 	api.HandleFunc("/entries/{id}", authMw(adminMw(deleteEntryHandler))).Methods("DELETE")
 
-	// Load CORS configuration from shared config
-	corsConfig, err := config.LoadCORSConfig()
-	if err != nil {
-		log.Printf("Warning: CORS config load error: %v", err)
+	// ===== IDENTITY EVENTS (signed with this app's client secret) =====
+	// Register http://<host>:30031/api/webhooks/identity as the app's
+	// webhook_url in the Identity Service admin
+	if serviceConfig.HasClientCredentials() {
+		api.HandleFunc("/webhooks/identity", auth.WebhookHandler(serviceConfig.ClientSecret, identityEventHandler)).Methods("POST")
 	}
-	log.Printf("📋 CORS Mode: %s", corsConfig.CORS.Mode)
+
+	// Load CORS configuration from shared config, reloading it when the
+	// file changes
+	corsConfig := config.WatchCORSConfig()
+	log.Printf("📋 CORS Mode: %s", corsConfig.Current().CORS.Mode)
 	log.Printf("📋 Allowed Origins: %v", corsConfig.GetAllowedOrigins())
 
 	// Enable CORS using shared config
@@ -99,7 +129,7 @@ func main() {
 	)(r)
 
 	// Start server
-	log.Printf("✅ %s backend running on http://localhost:%s", APP_NAME, BACKEND_PORT)
+	log.Printf("✅ %s backend running on http://localhost:%s", APP_NAME, serviceConfig.Port)
 	log.Printf("🎯 Blind box selection mode enabled")
-	log.Fatal(http.ListenAndServe(":"+BACKEND_PORT, corsHandler))
+	log.Fatal(http.ListenAndServe(":"+serviceConfig.Port, corsHandler))
 }
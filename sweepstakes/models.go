@@ -7,6 +7,10 @@ type Config struct {
 	AppName    string `json:"app_name"`
 	AppIcon    string `json:"app_icon"`
 	BackendURL string `json:"backend_url"`
+	Version    string `json:"version"`
+
+	// Settings are this instance's non-secret settings
+	Settings map[string]interface{} `json:"settings"`
 }
 
 // Competition represents a sweepstake competition
@@ -30,13 +34,21 @@ type Entry struct {
 	Seed          *int      `json:"seed"` // For knockout-type competitions
 	Status        string    `json:"status"` // "available", "taken", "active", "eliminated", "winner"
 	Position      *int      `json:"position"` // Final position (1st, 2nd, 3rd, etc.)
+	EliminatedDate *string  `json:"eliminated_date,omitempty"` // Read-only, sent back by the admin UI
 	CreatedAt     time.Time `json:"created_at"`
 }
 
+// Statuses allowed by the competitions and entries tables
+var (
+	COMPETITION_STATUSES = []string{"draft", "open", "locked", "completed", "archived"}
+	ENTRY_STATUSES       = []string{"available", "taken", "active", "eliminated", "winner"}
+)
+
 // Draw represents a user's selection/assignment of an entry
 type Draw struct {
 	ID            int       `json:"id"`
-	UserEmail     string    `json:"user_email"` // From JWT token
+	UserID        int       `json:"user_id"`    // From JWT token
+	UserEmail     string    `json:"user_email"` // Email at the time of the draw
 	CompetitionID int       `json:"competition_id"`
 	EntryID       int       `json:"entry_id"`
 	DrawnAt       time.Time `json:"drawn_at"`
@@ -48,14 +60,7 @@ type Draw struct {
 // SelectionLock represents an in-memory lock for blind box selection
 type SelectionLock struct {
 	CompetitionID int       `json:"competition_id"`
-	UserEmail     string    `json:"user_email"`
+	UserID        int       `json:"user_id"`
 	UserName      string    `json:"user_name"`
 	LockedAt      time.Time `json:"locked_at"`
 }
-
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Details string `json:"details,omitempty"`
-}
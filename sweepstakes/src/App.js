@@ -637,7 +637,7 @@ function LeaderboardView({ competitions, leaderboardData, selectedComp, onSelect
                 const hasPosition = draw.position && draw.position !== null;
                 return (
                   <div key={idx} className={`result-card result-${draw.entry_status}`} style={isEliminated ? {opacity: 0.6, filter: 'grayscale(30%)'} : {}}>
-                    <h3>{draw.user_email}</h3>
+                    <h3>{draw.user_name}</h3>
                     <p className="entry-name" style={hasPosition ? {fontWeight: 'bold', fontSize: '22px'} : {}}>{draw.entry_name}</p>
                     {hasPosition && (
                       <div style={{fontSize: '24px', fontWeight: 'bold', margin: '10px 0'}}>
@@ -839,7 +839,7 @@ function AdminParticipantsView({ competitions, leaderboardData, selectedComp, on
             const hasPosition = draw.position && draw.position !== null;
             return (
               <div key={idx} className={`result-card result-${draw.entry_status}`} style={isEliminated ? {opacity: 0.6, filter: 'grayscale(30%)'} : {}}>
-                <h3>{draw.user_email}</h3>
+                <h3>{draw.user_name}</h3>
                 <p className="entry-name" style={hasPosition ? {fontWeight: 'bold', fontSize: '22px'} : {}}>{draw.entry_name}</p>
                 {hasPosition && (
                   <div style={{fontSize: '24px', fontWeight: 'bold', margin: '10px 0'}}>
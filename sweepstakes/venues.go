@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// Competitions belong to the venue of the admin who created them. Players
+// and admins only see and act on their own venue's competitions.
+
+// competitionInVenue checks that a competition belongs to the user's
+// venue, writing a 404 if it doesn't
+func competitionInVenue(w http.ResponseWriter, r *http.Request, compID string) bool {
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM competitions WHERE id = ? AND venue_id = ?",
+		compID, auth.GetVenueID(r)).Scan(&count)
+	if count == 0 {
+		httpkit.SendError(w, "Competition not found", 404)
+		return false
+	}
+	return true
+}
+
+// entryInVenue checks that an entry's competition belongs to the user's
+// venue, writing a 404 if it doesn't
+func entryInVenue(w http.ResponseWriter, r *http.Request, entryID string) bool {
+	var count int
+	db.QueryRow(`
+		SELECT COUNT(*) FROM entries e
+		JOIN competitions c ON c.id = e.competition_id
+		WHERE e.id = ? AND c.venue_id = ?
+	`, entryID, auth.GetVenueID(r)).Scan(&count)
+	if count == 0 {
+		httpkit.SendError(w, "Entry not found", 404)
+		return false
+	}
+	return true
+}
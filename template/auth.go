@@ -5,7 +5,7 @@ package main
 // This file uses the shared authentication library from pubgames/shared/auth
 //
 // The shared library provides:
-// - AuthMiddleware: Validates JWT tokens with Identity Service
+// - AuthMiddleware: Validates JWT tokens locally using Identity Service signing keys
 // - AdminMiddleware: Ensures user has admin privileges
 //
 // No need to reimplement authentication logic here.
@@ -12,14 +12,14 @@ import (
 // initDB initializes the database connection and creates tables
 func initDB() {
 	// Ensure data directory exists
-	dataDir := filepath.Dir(DB_PATH)
+	dataDir := filepath.Dir(serviceConfig.DBPath)
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
 	// Open database connection
 	var err error
-	db, err = sql.Open("sqlite3", DB_PATH)
+	db, err = sql.Open("sqlite3", serviceConfig.DBPath)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -56,7 +56,7 @@ func initDB() {
 		log.Fatalf("Failed to create schema: %v", err)
 	}
 
-	log.Println("✅ Database initialized at", DB_PATH)
+	log.Println("✅ Database initialized at", serviceConfig.DBPath)
 }
 
 // seedData adds sample data (optional, for testing)
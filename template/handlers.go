@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"pubgames/shared/httpkit"
 )
 
 // getConfigHandler returns app configuration (public endpoint)
@@ -11,7 +13,9 @@ func getConfigHandler(w http.ResponseWriter, r *http.Request) {
 	config := Config{
 		AppName:    APP_NAME,
 		AppIcon:    APP_ICON,
-		BackendURL: "http://localhost:" + BACKEND_PORT,
+		Version:    APP_VERSION,
+		BackendURL: "http://localhost:" + serviceConfig.Port,
+		Settings:   serviceConfig.Public(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -38,7 +42,7 @@ func getItemsHandler(w http.ResponseWriter, r *http.Request) {
 		ORDER BY created_at DESC
 	`)
 	if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	defer rows.Close()
@@ -59,28 +63,28 @@ func getItemsHandler(w http.ResponseWriter, r *http.Request) {
 
 // createItemHandler creates a new item (protected endpoint)
 func createItemHandler(w http.ResponseWriter, r *http.Request) {
-	var item Item
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		sendError(w, "Invalid request body", 400)
+	var req CreateItemRequest
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 
 	result, err := db.Exec(`
 		INSERT INTO items (name, description) 
 		VALUES (?, ?)
-	`, item.Name, item.Description)
+	`, req.Name, req.Description)
 	if err != nil {
-		sendError(w, "Failed to create item", 500)
+		httpkit.SendError(w, "Failed to create item", 500)
 		return
 	}
 
 	id, _ := result.LastInsertId()
-	item.ID = int(id)
-	item.CreatedAt = time.Now()
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(item)
+	httpkit.JSON(w, http.StatusCreated, Item{
+		ID:          int(id),
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedAt:   time.Now(),
+	})
 }
 
 // getAdminStatsHandler returns admin statistics (admin only endpoint)
@@ -96,13 +100,3 @@ func getAdminStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
-
-// sendError sends a JSON error response
-func sendError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{
-		Error: message,
-		Code:  code,
-	})
-}
\ No newline at end of file
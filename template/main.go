@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -13,22 +15,40 @@ import (
 
 var db *sql.DB
 
+// serviceConfig holds the ports and paths this instance runs with
+var serviceConfig *config.ServiceConfig
+
 const (
-	APP_NAME         = "PLACEHOLDER_APP_NAME"
-	APP_ICON         = "PLACEHOLDER_ICON"
-	BACKEND_PORT     = "30X1" // Replace X with app number
-	FRONTEND_PORT    = "30X0"
-	DB_PATH          = "./data/app.db"
-	IDENTITY_SERVICE = "http://localhost:3001"
+	APP_NAME        = "PLACEHOLDER_APP_NAME"
+	APP_ICON        = "PLACEHOLDER_ICON"
+	APP_DESCRIPTION = "PLACEHOLDER_DESCRIPTION"
+	APP_VERSION     = "1.0.0"
 )
 
 func main() {
 	log.Printf("🚀 Starting %s...", APP_NAME)
 
+	// Settings: these defaults, then a config file, environment and flags
+	var err error
+	serviceConfig, err = config.LoadServiceConfig(config.ServiceConfig{
+		Name:               APP_NAME,
+		Version:            APP_VERSION,
+		Port:               "30X1", // Replace X with app number
+		FrontendPort:       "30X0",
+		DBPath:             "./data/app.db",
+		IdentityServiceURL: "http://localhost:3001",
+	}, os.Args[1:])
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
 	// Initialize database
 	initDB()
 	defer db.Close()
 
+	// Add (or update) this app in the Identity Service app launcher
+	go registerWithIdentity()
+
 	// Setup router
 	r := mux.NewRouter()
 	api := r.PathPrefix("/api").Subrouter()
@@ -38,7 +58,7 @@ func main() {
 
 	// Protected routes (require authentication)
 	authMw := auth.AuthMiddleware(auth.Config{
-		IdentityServiceURL: IDENTITY_SERVICE,
+		IdentityServiceURL: serviceConfig.IdentityServiceURL,
 	})
 	api.HandleFunc("/data", authMw(getDataHandler)).Methods("GET")
 	api.HandleFunc("/items", authMw(getItemsHandler)).Methods("GET")
@@ -48,12 +68,10 @@ func main() {
 	adminMw := auth.AdminMiddleware
 	api.HandleFunc("/admin/stats", authMw(adminMw(getAdminStatsHandler))).Methods("GET")
 
-	// Load CORS configuration from shared config
-	corsConfig, err := config.LoadCORSConfig()
-	if err != nil {
-		log.Printf("Warning: CORS config load error: %v", err)
-	}
-	log.Printf("📋 CORS Mode: %s", corsConfig.CORS.Mode)
+	// Load CORS configuration from shared config, reloading it when the
+	// file changes
+	corsConfig := config.WatchCORSConfig()
+	log.Printf("📋 CORS Mode: %s", corsConfig.Current().CORS.Mode)
 	log.Printf("📋 Allowed Origins: %v", corsConfig.GetAllowedOrigins())
 
 	// CORS configuration using shared config
@@ -70,7 +88,40 @@ func main() {
 		handlers.AllowCredentials(),
 	)
 
-	log.Printf("✅ Backend running on :%s", BACKEND_PORT)
-	log.Printf("   Frontend should be at :%s", FRONTEND_PORT)
-	log.Fatal(http.ListenAndServe(":"+BACKEND_PORT, corsHandler(r)))
-}
\ No newline at end of file
+	log.Printf("✅ Backend running on :%s", serviceConfig.Port)
+	log.Printf("   Frontend should be at :%s", serviceConfig.FrontendPort)
+	log.Fatal(http.ListenAndServe(":"+serviceConfig.Port, corsHandler(r)))
+}
+
+// registerWithIdentity upserts this app's entry in the Identity Service
+// app registry. It needs client credentials created by an admin with
+// POST /api/admin/clients, set as client_id/client_secret in the service
+// config (or APP_CLIENT_ID and APP_CLIENT_SECRET).
+// The Identity Service may still be starting, so failures are retried.
+func registerWithIdentity() {
+	if !serviceConfig.HasClientCredentials() {
+		log.Println("ℹ️  APP_CLIENT_ID/APP_CLIENT_SECRET not set; skipping app registration")
+		return
+	}
+
+	client := auth.NewServiceClient(serviceConfig.IdentityServiceURL, serviceConfig.ClientID, serviceConfig.ClientSecret)
+	registration := auth.AppRegistration{
+		Name:        APP_NAME,
+		Icon:        APP_ICON,
+		URL:         "http://localhost:" + serviceConfig.FrontendPort,
+		APIURL:      "http://localhost:" + serviceConfig.Port,
+		Description: APP_DESCRIPTION,
+		Version:     APP_VERSION,
+	}
+
+	for attempt, wait := 1, 2*time.Second; attempt <= 5; attempt, wait = attempt+1, wait*2 {
+		err := client.RegisterApp(registration)
+		if err == nil {
+			log.Printf("✅ Registered with Identity Service")
+			return
+		}
+		log.Printf("Warning: App registration attempt %d failed: %v", attempt, err)
+		time.Sleep(wait)
+	}
+	log.Printf("❌ Could not register with Identity Service; add the app by hand in the admin panel")
+}
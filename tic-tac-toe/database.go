@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -13,14 +14,14 @@ import (
 // initDB initializes the database connection and creates tables
 func initDB() {
 	// Ensure data directory exists
-	dataDir := filepath.Dir(DB_PATH)
+	dataDir := filepath.Dir(serviceConfig.DBPath)
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("Failed to create data directory: %v", err)
 	}
 
 	// Open database connection
 	var err error
-	db, err = sql.Open("sqlite3", DB_PATH)
+	db, err = sql.Open("sqlite3", serviceConfig.DBPath)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -52,7 +53,8 @@ func initDB() {
 		current_round INTEGER DEFAULT 1,
 		last_move_at TIMESTAMP,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		completed_at TIMESTAMP
+		completed_at TIMESTAMP,
+		venue_id INTEGER DEFAULT 1
 	);
 
 	-- Moves table - stores all moves made in games
@@ -71,18 +73,22 @@ func initDB() {
 		user_id INTEGER PRIMARY KEY,
 		user_name TEXT NOT NULL,
 		last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		in_game INTEGER DEFAULT 0
+		in_game INTEGER DEFAULT 0,
+		venue_id INTEGER DEFAULT 1
 	);
 
 	-- Player stats table - aggregated statistics
+	-- One row per player per venue they have played at
 	CREATE TABLE IF NOT EXISTS player_stats (
-		user_id INTEGER PRIMARY KEY,
+		user_id INTEGER NOT NULL,
 		user_name TEXT NOT NULL,
 		games_played INTEGER DEFAULT 0,
 		games_won INTEGER DEFAULT 0,
 		games_lost INTEGER DEFAULT 0,
 		games_draw INTEGER DEFAULT 0,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		venue_id INTEGER NOT NULL DEFAULT 1,
+		PRIMARY KEY (user_id, venue_id)
 	);
 
 	-- Rematch requests table
@@ -112,7 +118,9 @@ func initDB() {
 		log.Fatalf("Failed to create schema: %v", err)
 	}
 
-	log.Println("✅ Database initialized at", DB_PATH)
+	ensureTableIntegrity()
+
+	log.Println("✅ Database initialized at", serviceConfig.DBPath)
 	
 	// Clean up state from previous server run
 	cleanupOnServerRestart()
@@ -124,6 +132,86 @@ func initDB() {
 	cleanupExpiredRematches()
 }
 
+// ensureTableIntegrity adds missing columns for older databases
+func ensureTableIntegrity() {
+	columns := []struct {
+		table  string
+		column string
+		def    string
+	}{
+		{"games", "venue_id", "INTEGER DEFAULT 1"},
+		{"online_users", "venue_id", "INTEGER DEFAULT 1"},
+		{"player_stats", "venue_id", "INTEGER DEFAULT 1"},
+	}
+
+	for _, col := range columns {
+		var count int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name='%s'", col.table, col.column)
+		err := db.QueryRow(query).Scan(&count)
+		if err != nil {
+			continue
+		}
+
+		if count == 0 {
+			alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.def)
+			_, err := db.Exec(alterSQL)
+			if err == nil {
+				log.Printf("✅ Added column: %s.%s", col.table, col.column)
+			}
+		}
+	}
+
+	migratePlayerStatsKey()
+}
+
+// migratePlayerStatsKey rebuilds player_stats from older databases, which
+// kept one row per player, with a row per player per venue. SQLite can't
+// change a primary key in place. Existing stats stay with the venue the
+// row was last stamped with.
+func migratePlayerStatsKey() {
+	var keyColumns int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('player_stats') WHERE pk > 0").Scan(&keyColumns); err != nil || keyColumns != 1 {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Warning: Failed to migrate player_stats: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	steps := []string{
+		`CREATE TABLE player_stats_new (
+			user_id INTEGER NOT NULL,
+			user_name TEXT NOT NULL,
+			games_played INTEGER DEFAULT 0,
+			games_won INTEGER DEFAULT 0,
+			games_lost INTEGER DEFAULT 0,
+			games_draw INTEGER DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			venue_id INTEGER NOT NULL DEFAULT 1,
+			PRIMARY KEY (user_id, venue_id)
+		)`,
+		`INSERT INTO player_stats_new (user_id, user_name, games_played, games_won, games_lost, games_draw, updated_at, venue_id)
+			SELECT user_id, user_name, games_played, games_won, games_lost, games_draw, updated_at, COALESCE(venue_id, 1)
+			FROM player_stats`,
+		`DROP TABLE player_stats`,
+		`ALTER TABLE player_stats_new RENAME TO player_stats`,
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step); err != nil {
+			log.Printf("Warning: Failed to migrate player_stats: %v", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Warning: Failed to migrate player_stats: %v", err)
+		return
+	}
+	log.Println("✅ Migrated player_stats to per-venue rows")
+}
+
 // cleanupOnServerRestart cleans up stale state from previous server run
 func cleanupOnServerRestart() {
 	// Mark all active games as abandoned - can't continue after restart
@@ -212,8 +300,8 @@ func cleanupExpiredChallenges() {
 	}
 }
 
-// markUserOnline marks a user as online
-func markUserOnline(userID int, userName string, inGame bool) error {
+// markUserOnline marks a user as online at their venue
+func markUserOnline(userID, venueID int, userName string, inGame bool) error {
 	inGameInt := 0
 	if inGame {
 		inGameInt = 1
@@ -230,25 +318,26 @@ func markUserOnline(userID int, userName string, inGame bool) error {
 	}
 	
 	_, err := db.Exec(`
-		INSERT INTO online_users (user_id, user_name, last_seen_at, in_game)
-		VALUES (?, ?, CURRENT_TIMESTAMP, ?)
+		INSERT INTO online_users (user_id, user_name, last_seen_at, in_game, venue_id)
+		VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?)
 		ON CONFLICT(user_id) DO UPDATE SET
 			user_name = excluded.user_name,
 			last_seen_at = CURRENT_TIMESTAMP,
-			in_game = excluded.in_game
-	`, userID, userName, inGameInt)
+			in_game = excluded.in_game,
+			venue_id = excluded.venue_id
+	`, userID, userName, inGameInt, venueID)
 	
 	return err
 }
 
-// updatePlayerStats updates player statistics after a game
-func updatePlayerStats(userID int, userName string, won bool, lost bool, draw bool) error {
+// updatePlayerStats updates player statistics after a game played at a venue
+func updatePlayerStats(userID, venueID int, userName string, won bool, lost bool, draw bool) error {
 	// First ensure the player exists in stats
 	_, err := db.Exec(`
-		INSERT INTO player_stats (user_id, user_name, games_played, games_won, games_lost, games_draw)
-		VALUES (?, ?, 0, 0, 0, 0)
-		ON CONFLICT(user_id) DO UPDATE SET user_name = excluded.user_name
-	`, userID, userName)
+		INSERT INTO player_stats (user_id, user_name, games_played, games_won, games_lost, games_draw, venue_id)
+		VALUES (?, ?, 0, 0, 0, 0, ?)
+		ON CONFLICT(user_id, venue_id) DO UPDATE SET user_name = excluded.user_name
+	`, userID, userName, venueID)
 	if err != nil {
 		return err
 	}
@@ -273,8 +362,8 @@ func updatePlayerStats(userID int, userName string, won bool, lost bool, draw bo
 			games_lost = games_lost + ?,
 			games_draw = games_draw + ?,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE user_id = ?
-	`, wonInt, lostInt, drawInt, userID)
+		WHERE user_id = ? AND venue_id = ?
+	`, wonInt, lostInt, drawInt, userID, venueID)
 
 	return err
 }
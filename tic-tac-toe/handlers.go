@@ -10,6 +10,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
 )
 
 const (
@@ -21,7 +22,9 @@ func getConfigHandler(w http.ResponseWriter, r *http.Request) {
 	config := Config{
 		AppName:              APP_NAME,
 		AppIcon:              APP_ICON,
-		BackendURL:           "http://localhost:" + BACKEND_PORT,
+		Version:              APP_VERSION,
+		BackendURL:           "http://localhost:" + serviceConfig.Port,
+		Settings:             serviceConfig.Public(),
 		DefaultSessionMinutes: DEFAULT_SESSION_TIMEOUT,
 		DefaultMoveSeconds:   DEFAULT_MOVE_TIMEOUT,
 	}
@@ -30,25 +33,15 @@ func getConfigHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func heartbeatHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{
-		ID:      authUser.ID,
-		Email:   authUser.Email,
-		Name:    authUser.Name,
-		IsAdmin: authUser.IsAdmin,
-	}
+	user := auth.GetPrincipal(r)
 	var inGame bool
 	err := db.QueryRow(`SELECT COUNT(*) > 0 FROM games WHERE (player1_id = ? OR player2_id = ?) AND status = 'active'`, user.ID, user.ID).Scan(&inGame)
 	if err != nil {
 		inGame = false
 	}
-	err = markUserOnline(user.ID, user.Name, inGame)
+	err = markUserOnline(user.ID, user.Venue(), user.Name, inGame)
 	if err != nil {
-		sendError(w, "Failed to update online status", 500)
+		httpkit.SendError(w, "Failed to update online status", 500)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -57,13 +50,7 @@ func heartbeatHandler(w http.ResponseWriter, r *http.Request) {
 
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	authUser := auth.GetUser(r)
-	if authUser == nil {
-		// Already logged out or invalid token
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]bool{"success": true})
-		return
-	}
-	
+
 	// Remove user from online_users
 	_, err := db.Exec(`DELETE FROM online_users WHERE user_id = ?`, authUser.ID)
 	if err != nil {
@@ -80,16 +67,11 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getOnlineUsersHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	cleanupOnlineUsers()
-	rows, err := db.Query(`SELECT user_id, user_name, last_seen_at, in_game FROM online_users WHERE user_id != ? AND datetime(last_seen_at) > datetime('now', '-5 minutes') ORDER BY user_name`, user.ID)
+	rows, err := db.Query(`SELECT user_id, user_name, last_seen_at, in_game FROM online_users WHERE user_id != ? AND venue_id = ? AND datetime(last_seen_at) > datetime('now', '-5 minutes') ORDER BY user_name`, user.ID, user.Venue())
 	if err != nil {
-		sendError(w, "Failed to get online users", 500)
+		httpkit.SendError(w, "Failed to get online users", 500)
 		return
 	}
 	defer rows.Close()
@@ -109,49 +91,44 @@ func getOnlineUsersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func createChallengeHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	var settings struct {
 		OpponentID    int      `json:"opponent_id"`
 		Mode          GameMode `json:"mode"`
 		MoveTimeLimit int      `json:"move_time_limit"`
 		FirstTo       int      `json:"first_to"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
-		sendError(w, "Invalid request body", 400)
+	if err := httpkit.Decode(w, r, &settings); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 	validFirstTo := map[int]bool{1: true, 2: true, 3: true, 5: true, 10: true, 20: true}
 	if !validFirstTo[settings.FirstTo] {
-		sendError(w, "Invalid first_to value", 400)
+		httpkit.SendError(w, "Invalid first_to value", 400)
 		return
 	}
 	var opponentName string
-	err := db.QueryRow(`SELECT user_name FROM online_users WHERE user_id = ? AND datetime(last_seen_at) > datetime('now', '-5 minutes')`, settings.OpponentID).Scan(&opponentName)
+	err := db.QueryRow(`SELECT user_name FROM online_users WHERE user_id = ? AND venue_id = ? AND datetime(last_seen_at) > datetime('now', '-5 minutes')`, settings.OpponentID, user.Venue()).Scan(&opponentName)
 	if err == sql.ErrNoRows {
-		sendError(w, "Opponent is not online", 400)
+		httpkit.SendError(w, "Opponent is not online", 400)
 		return
 	} else if err != nil {
-		sendError(w, "Failed to verify opponent", 500)
+		httpkit.SendError(w, "Failed to verify opponent", 500)
 		return
 	}
 	var existingGame int
 	err = db.QueryRow(`SELECT COUNT(*) FROM games WHERE (player1_id = ? OR player2_id = ? OR player1_id = ? OR player2_id = ?) AND status IN ('waiting', 'active')`, user.ID, user.ID, settings.OpponentID, settings.OpponentID).Scan(&existingGame)
 	if err != nil {
-		sendError(w, "Failed to check existing games", 500)
+		httpkit.SendError(w, "Failed to check existing games", 500)
 		return
 	}
 	if existingGame > 0 {
-		sendError(w, "One of the players is already in a game", 400)
+		httpkit.SendError(w, "One of the players is already in a game", 400)
 		return
 	}
-	result, err := db.Exec(`INSERT INTO games (player1_id, player1_name, player2_id, player2_name, mode, status, current_turn, move_time_limit, session_timeout, first_to) VALUES (?, ?, ?, ?, ?, 'waiting', 1, ?, ?, ?)`, user.ID, user.Name, settings.OpponentID, opponentName, settings.Mode, settings.MoveTimeLimit, DEFAULT_SESSION_TIMEOUT, settings.FirstTo)
+	result, err := db.Exec(`INSERT INTO games (player1_id, player1_name, player2_id, player2_name, mode, status, current_turn, move_time_limit, session_timeout, first_to, venue_id) VALUES (?, ?, ?, ?, ?, 'waiting', 1, ?, ?, ?, ?)`, user.ID, user.Name, settings.OpponentID, opponentName, settings.Mode, settings.MoveTimeLimit, DEFAULT_SESSION_TIMEOUT, settings.FirstTo, user.Venue())
 	if err != nil {
-		sendError(w, "Failed to create challenge", 500)
+		httpkit.SendError(w, "Failed to create challenge", 500)
 		return
 	}
 	gameID, _ := result.LastInsertId()
@@ -176,19 +153,14 @@ func createChallengeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getPendingChallengesHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	
 	// Cleanup expired challenges before querying
 	cleanupExpiredChallenges()
 	
 	rows, err := db.Query(`SELECT id, player1_id, player1_name, player2_id, player2_name, mode, move_time_limit, first_to, created_at FROM games WHERE player2_id = ? AND status = 'waiting' ORDER BY created_at DESC`, user.ID)
 	if err != nil {
-		sendError(w, "Failed to get challenges", 500)
+		httpkit.SendError(w, "Failed to get challenges", 500)
 		return
 	}
 	defer rows.Close()
@@ -206,37 +178,32 @@ func getPendingChallengesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func respondToChallengeHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	vars := mux.Vars(r)
 	gameID, _ := strconv.Atoi(vars["id"])
 	var response struct {
 		Accept bool `json:"accept"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
-		sendError(w, "Invalid request body", 400)
+	if err := httpkit.Decode(w, r, &response); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 	var currentStatus string
 	var player2ID int
 	err := db.QueryRow(`SELECT status, player2_id FROM games WHERE id = ?`, gameID).Scan(&currentStatus, &player2ID)
 	if err == sql.ErrNoRows {
-		sendError(w, "Game not found", 404)
+		httpkit.SendError(w, "Game not found", 404)
 		return
 	} else if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	if player2ID != user.ID {
-		sendError(w, "Not your challenge", 403)
+		httpkit.SendError(w, "Not your challenge", 403)
 		return
 	}
 	if currentStatus != "waiting" {
-		sendError(w, "Challenge already responded to", 400)
+		httpkit.SendError(w, "Challenge already responded to", 400)
 		return
 	}
 	
@@ -247,16 +214,16 @@ func respondToChallengeHandler(w http.ResponseWriter, r *http.Request) {
 	newStatus := "declined"
 	if response.Accept {
 		newStatus = "active"
-		markUserOnline(user.ID, user.Name, true)
+		markUserOnline(user.ID, user.Venue(), user.Name, true)
 		db.QueryRow("SELECT player1_id, player1_name FROM games WHERE id = ?", gameID).Scan(&player1ID, &player1Name)
-		markUserOnline(player1ID, player1Name, true)
+		markUserOnline(player1ID, user.Venue(), player1Name, true)
 	} else {
 		// For decline, we still need player1ID to notify them
 		db.QueryRow("SELECT player1_id FROM games WHERE id = ?", gameID).Scan(&player1ID)
 	}
 	_, err = db.Exec(`UPDATE games SET status = ?, last_move_at = CURRENT_TIMESTAMP WHERE id = ?`, newStatus, gameID)
 	if err != nil {
-		sendError(w, "Failed to update challenge", 500)
+		httpkit.SendError(w, "Failed to update challenge", 500)
 		return
 	}
 	
@@ -287,12 +254,7 @@ func respondToChallengeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getActiveGameHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	var game Game
 	var player2ID sql.NullInt64
 	var winnerID sql.NullInt64
@@ -304,7 +266,7 @@ func getActiveGameHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(nil)
 		return
 	} else if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	if player2ID.Valid {
@@ -326,37 +288,33 @@ func getActiveGameHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func makeMoveHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	var moveReq struct {
 		GameID   int `json:"game_id"`
 		Position int `json:"position"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&moveReq); err != nil {
-		sendError(w, "Invalid request body", 400)
+	if err := httpkit.Decode(w, r, &moveReq); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 	if moveReq.Position < 0 || moveReq.Position > 8 {
-		sendError(w, "Invalid position", 400)
+		httpkit.SendError(w, "Invalid position", 400)
 		return
 	}
 	var game Game
 	var player2ID sql.NullInt64
 	var winnerID sql.NullInt64
-	err := db.QueryRow(`SELECT id, player1_id, player2_id, status, current_turn, board, winner_id, first_to, player1_score, player2_score, current_round FROM games WHERE id = ?`, moveReq.GameID).Scan(&game.ID, &game.Player1ID, &player2ID, &game.Status, &game.CurrentTurn, &game.Board, &winnerID, &game.FirstTo, &game.Player1Score, &game.Player2Score, &game.CurrentRound)
+	var venueID int
+	err := db.QueryRow(`SELECT id, player1_id, player2_id, status, current_turn, board, winner_id, first_to, player1_score, player2_score, current_round, COALESCE(venue_id, 1) FROM games WHERE id = ?`, moveReq.GameID).Scan(&game.ID, &game.Player1ID, &player2ID, &game.Status, &game.CurrentTurn, &game.Board, &winnerID, &game.FirstTo, &game.Player1Score, &game.Player2Score, &game.CurrentRound, &venueID)
 	if err == sql.ErrNoRows {
-		sendError(w, "Game not found", 404)
+		httpkit.SendError(w, "Game not found", 404)
 		return
 	} else if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	if game.Status != "active" {
-		sendError(w, "Game is not active", 400)
+		httpkit.SendError(w, "Game is not active", 400)
 		return
 	}
 	var playerNumber int
@@ -368,27 +326,27 @@ func makeMoveHandler(w http.ResponseWriter, r *http.Request) {
 		playerNumber = 2
 		symbol = "O"
 	} else {
-		sendError(w, "You are not in this game", 403)
+		httpkit.SendError(w, "You are not in this game", 403)
 		return
 	}
 	if game.CurrentTurn != playerNumber {
-		sendError(w, "Not your turn", 400)
+		httpkit.SendError(w, "Not your turn", 400)
 		return
 	}
 	var board []string
 	if err := json.Unmarshal([]byte(game.Board), &board); err != nil {
-		sendError(w, "Invalid board state", 500)
+		httpkit.SendError(w, "Invalid board state", 500)
 		return
 	}
 	if board[moveReq.Position] != "" {
-		sendError(w, "Position already taken", 400)
+		httpkit.SendError(w, "Position already taken", 400)
 		return
 	}
 	board[moveReq.Position] = symbol
 	boardJSON, _ := json.Marshal(board)
 	_, err = db.Exec(`INSERT INTO moves (game_id, player_id, position, symbol) VALUES (?, ?, ?, ?)`, moveReq.GameID, user.ID, moveReq.Position, symbol)
 	if err != nil {
-		sendError(w, "Failed to record move", 500)
+		httpkit.SendError(w, "Failed to record move", 500)
 		return
 	}
 	hasWinner, isDraw := checkWinner(board)
@@ -417,18 +375,20 @@ func makeMoveHandler(w http.ResponseWriter, r *http.Request) {
 			_, err = db.Exec(`UPDATE games SET board = ?, status = 'completed', winner_id = ?, player1_score = ?, player2_score = ?, last_move_at = CURRENT_TIMESTAMP, completed_at = CURRENT_TIMESTAMP WHERE id = ?`, string(boardJSON), finalWinnerID, game.Player1Score, game.Player2Score, moveReq.GameID)
 			if player2ID.Valid {
 				player2IDInt := int(player2ID.Int64)
+				// Stats count at the venue the game was played at, whoever
+				// made the last move
 				if finalWinnerID != nil {
-					updatePlayerStats(*finalWinnerID, "", true, false, false)
+					updatePlayerStats(*finalWinnerID, venueID, "", true, false, false)
 					loserID := game.Player1ID
 					if *finalWinnerID == game.Player1ID {
 						loserID = player2IDInt
 					}
-					updatePlayerStats(loserID, "", false, true, false)
+					updatePlayerStats(loserID, venueID, "", false, true, false)
 				}
 			}
-			markUserOnline(game.Player1ID, "", false)
+			markUserOnline(game.Player1ID, venueID, "", false)
 			if player2ID.Valid {
-				markUserOnline(int(player2ID.Int64), "", false)
+				markUserOnline(int(player2ID.Int64), venueID, "", false)
 			}
 			
 			// Broadcast game ended via WebSocket
@@ -450,7 +410,7 @@ func makeMoveHandler(w http.ResponseWriter, r *http.Request) {
 		_, err = db.Exec(`UPDATE games SET board = ?, current_turn = ?, last_move_at = CURRENT_TIMESTAMP WHERE id = ?`, string(boardJSON), nextTurn, moveReq.GameID)
 	}
 	if err != nil {
-		sendError(w, "Failed to update game", 500)
+		httpkit.SendError(w, "Failed to update game", 500)
 		return
 	}
 
@@ -532,31 +492,26 @@ func checkWinner(board []string) (bool, bool) {
 }
 
 func createRematchHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	var req struct {
 		GameID int `json:"game_id"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, "Invalid request body", 400)
+	if err := httpkit.Decode(w, r, &req); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 	var player1ID, player2ID, opponentID int
 	var status string
 	err := db.QueryRow(`SELECT player1_id, player2_id, status FROM games WHERE id = ?`, req.GameID).Scan(&player1ID, &player2ID, &status)
 	if err == sql.ErrNoRows {
-		sendError(w, "Game not found", 404)
+		httpkit.SendError(w, "Game not found", 404)
 		return
 	} else if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	if status != "completed" {
-		sendError(w, "Game is not completed", 400)
+		httpkit.SendError(w, "Game is not completed", 400)
 		return
 	}
 	if user.ID == player1ID {
@@ -564,23 +519,23 @@ func createRematchHandler(w http.ResponseWriter, r *http.Request) {
 	} else if user.ID == player2ID {
 		opponentID = player1ID
 	} else {
-		sendError(w, "You are not in this game", 403)
+		httpkit.SendError(w, "You are not in this game", 403)
 		return
 	}
 	existingRematch, err := getRematchRequest(req.GameID)
 	if err != nil {
-		sendError(w, "Failed to check existing rematch", 500)
+		httpkit.SendError(w, "Failed to check existing rematch", 500)
 		return
 	}
 	if existingRematch != nil {
 		if existingRematch.Status == RematchStatusPending {
-			sendError(w, "Rematch request already pending", 400)
+			httpkit.SendError(w, "Rematch request already pending", 400)
 			return
 		}
 	}
 	rematchID, err := createRematchRequest(req.GameID, user.ID, opponentID)
 	if err != nil {
-		sendError(w, "Failed to create rematch request", 500)
+		httpkit.SendError(w, "Failed to create rematch request", 500)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -590,7 +545,7 @@ func createRematchHandler(w http.ResponseWriter, r *http.Request) {
 func getRematchHandler(w http.ResponseWriter, r *http.Request) {
 	authUser := auth.GetUser(r)
 	if authUser == nil {
-		sendError(w, "User not found", 401)
+		httpkit.SendError(w, "User not found", 401)
 		return
 	}
 	vars := mux.Vars(r)
@@ -598,7 +553,7 @@ func getRematchHandler(w http.ResponseWriter, r *http.Request) {
 	cleanupExpiredRematches()
 	rematch, err := getRematchRequest(gameID)
 	if err != nil {
-		sendError(w, "Failed to get rematch request", 500)
+		httpkit.SendError(w, "Failed to get rematch request", 500)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -606,59 +561,54 @@ func getRematchHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func respondToRematchHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	vars := mux.Vars(r)
 	rematchID, _ := strconv.Atoi(vars["id"])
 	var response struct {
 		Accept bool `json:"accept"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
-		sendError(w, "Invalid request body", 400)
+	if err := httpkit.Decode(w, r, &response); err != nil {
+		httpkit.WriteError(w, err)
 		return
 	}
 	var rm RematchRequest
 	var gameID int
 	err := db.QueryRow(`SELECT id, game_id, requester_id, opponent_id, status FROM rematch_requests WHERE id = ?`, rematchID).Scan(&rm.ID, &gameID, &rm.RequesterID, &rm.OpponentID, &rm.Status)
 	if err == sql.ErrNoRows {
-		sendError(w, "Rematch request not found", 404)
+		httpkit.SendError(w, "Rematch request not found", 404)
 		return
 	} else if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	if rm.OpponentID != user.ID {
-		sendError(w, "Not your rematch request", 403)
+		httpkit.SendError(w, "Not your rematch request", 403)
 		return
 	}
 	if rm.Status != RematchStatusPending {
-		sendError(w, "Rematch already responded to", 400)
+		httpkit.SendError(w, "Rematch already responded to", 400)
 		return
 	}
 	newStatus := RematchStatusDeclined
 	if response.Accept {
 		newStatus = RematchStatusAccepted
 		var mode string
-		var moveTimeLimit, firstTo int
+		var moveTimeLimit, firstTo, venueID int
 		var player1ID, player1Name, player2ID, player2Name string
-		db.QueryRow(`SELECT mode, move_time_limit, first_to, player1_id, player1_name, player2_id, player2_name FROM games WHERE id = ?`, gameID).Scan(&mode, &moveTimeLimit, &firstTo, &player1ID, &player1Name, &player2ID, &player2Name)
-		_, err = db.Exec(`INSERT INTO games (player1_id, player1_name, player2_id, player2_name, mode, status, current_turn, move_time_limit, session_timeout, first_to) VALUES (?, ?, ?, ?, ?, 'active', 1, ?, ?, ?)`, player1ID, player1Name, player2ID, player2Name, mode, moveTimeLimit, DEFAULT_SESSION_TIMEOUT, firstTo)
+		db.QueryRow(`SELECT mode, move_time_limit, first_to, player1_id, player1_name, player2_id, player2_name, COALESCE(venue_id, 1) FROM games WHERE id = ?`, gameID).Scan(&mode, &moveTimeLimit, &firstTo, &player1ID, &player1Name, &player2ID, &player2Name, &venueID)
+		_, err = db.Exec(`INSERT INTO games (player1_id, player1_name, player2_id, player2_name, mode, status, current_turn, move_time_limit, session_timeout, first_to, venue_id) VALUES (?, ?, ?, ?, ?, 'active', 1, ?, ?, ?, ?)`, player1ID, player1Name, player2ID, player2Name, mode, moveTimeLimit, DEFAULT_SESSION_TIMEOUT, firstTo, venueID)
 		if err != nil {
-			sendError(w, "Failed to create new game", 500)
+			httpkit.SendError(w, "Failed to create new game", 500)
 			return
 		}
 		p1ID, _ := strconv.Atoi(player1ID)
 		p2ID, _ := strconv.Atoi(player2ID)
-		markUserOnline(p1ID, player1Name, true)
-		markUserOnline(p2ID, player2Name, true)
+		markUserOnline(p1ID, venueID, player1Name, true)
+		markUserOnline(p2ID, venueID, player2Name, true)
 	}
 	err = updateRematchStatus(rematchID, newStatus)
 	if err != nil {
-		sendError(w, "Failed to update rematch status", 500)
+		httpkit.SendError(w, "Failed to update rematch status", 500)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -666,9 +616,9 @@ func respondToRematchHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query(`SELECT user_id, user_name, games_played, games_won, games_lost, games_draw FROM player_stats WHERE games_played > 0 ORDER BY games_won DESC, games_played ASC LIMIT 20`)
+	rows, err := db.Query(`SELECT user_id, user_name, games_played, games_won, games_lost, games_draw FROM player_stats WHERE games_played > 0 AND venue_id = ? ORDER BY games_won DESC, games_played ASC LIMIT 20`, auth.GetVenueID(r))
 	if err != nil {
-		sendError(w, "Failed to get leaderboard", 500)
+		httpkit.SendError(w, "Failed to get leaderboard", 500)
 		return
 	}
 	defer rows.Close()
@@ -689,18 +639,13 @@ func getLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getPlayerStatsHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	var stats PlayerStats
-	err := db.QueryRow(`SELECT user_id, user_name, games_played, games_won, games_lost, games_draw FROM player_stats WHERE user_id = ?`, user.ID).Scan(&stats.UserID, &stats.UserName, &stats.GamesPlayed, &stats.GamesWon, &stats.GamesLost, &stats.GamesDraw)
+	err := db.QueryRow(`SELECT user_id, user_name, games_played, games_won, games_lost, games_draw FROM player_stats WHERE user_id = ? AND venue_id = ?`, user.ID, user.Venue()).Scan(&stats.UserID, &stats.UserName, &stats.GamesPlayed, &stats.GamesWon, &stats.GamesLost, &stats.GamesDraw)
 	if err == sql.ErrNoRows {
 		stats = PlayerStats{UserID: user.ID, UserName: user.Name, GamesPlayed: 0, GamesWon: 0, GamesLost: 0, GamesDraw: 0, WinRate: 0}
 	} else if err != nil {
-		sendError(w, "Database error", 500)
+		httpkit.SendError(w, "Database error", 500)
 		return
 	}
 	if stats.GamesPlayed > 0 {
@@ -711,15 +656,10 @@ func getPlayerStatsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getGameHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	authUser := auth.GetUser(r)
-	if authUser == nil {
-		sendError(w, "User not found", 401)
-		return
-	}
-	user := &User{ID: authUser.ID, Email: authUser.Email, Name: authUser.Name, IsAdmin: authUser.IsAdmin}
+	user := auth.GetPrincipal(r)
 	rows, err := db.Query(`SELECT id, player1_id, player1_name, player2_id, player2_name, mode, status, winner_id, first_to, player1_score, player2_score, created_at, completed_at FROM games WHERE (player1_id = ? OR player2_id = ?) AND status = 'completed' ORDER BY completed_at DESC LIMIT 20`, user.ID, user.ID)
 	if err != nil {
-		sendError(w, "Failed to get history", 500)
+		httpkit.SendError(w, "Failed to get history", 500)
 		return
 	}
 	defer rows.Close()
@@ -749,9 +689,3 @@ func getGameHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(history)
 }
-
-func sendError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message, Code: code})
-}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -13,17 +14,32 @@ import (
 
 var db *sql.DB
 
+// serviceConfig holds the ports and paths this instance runs with
+var serviceConfig *config.ServiceConfig
+
 const (
-	APP_NAME         = "Tic Tac Toe"
-	APP_ICON         = "📤"
-	BACKEND_PORT     = "30041"
-	FRONTEND_PORT    = "30040"
-	DB_PATH          = "./data/tic-tac-toe.db"
-	IDENTITY_SERVICE = "http://localhost:3001"
+	APP_NAME    = "Tic Tac Toe"
+	APP_ICON    = "📤"
+	APP_VERSION = "1.0.0"
 )
 
 func main() {
 	log.Printf("🚀 Starting %s...", APP_NAME)
+
+	// Settings: these defaults, then a config file, environment and flags
+	var err error
+	serviceConfig, err = config.LoadServiceConfig(config.ServiceConfig{
+		Name:               APP_NAME,
+		Version:            APP_VERSION,
+		Port:               "30041",
+		FrontendPort:       "30040",
+		DBPath:             "./data/tic-tac-toe.db",
+		IdentityServiceURL: "http://localhost:3001",
+	}, os.Args[1:])
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
 	initDB()
 	defer db.Close()
 
@@ -31,7 +47,7 @@ func main() {
 	api := r.PathPrefix("/api").Subrouter()
 
 	authMw := auth.AuthMiddleware(auth.Config{
-		IdentityServiceURL: IDENTITY_SERVICE,
+		IdentityServiceURL: serviceConfig.IdentityServiceURL,
 	})
 
 	api.HandleFunc("/config", getConfigHandler).Methods("GET")
@@ -44,7 +60,8 @@ func main() {
 	api.HandleFunc("/game/{id}/respond", authMw(respondToChallengeHandler)).Methods("POST")
 	api.HandleFunc("/game/move", authMw(makeMoveHandler)).Methods("POST")
 	
-	// WebSocket endpoints (handle auth internally via query param)
+	// WebSocket endpoints (authenticated by a one-time ticket in the query)
+	api.HandleFunc("/ws/ticket", authMw(createWSTicketHandler)).Methods("POST")
 	api.HandleFunc("/ws/lobby", lobbyWebSocketHandler).Methods("GET")
 	api.HandleFunc("/ws/game/{gameId}", gameWebSocketHandler).Methods("GET")
 	
@@ -55,14 +72,15 @@ func main() {
 	api.HandleFunc("/stats/leaderboard", authMw(getLeaderboardHandler)).Methods("GET")
 	api.HandleFunc("/history", authMw(getGameHistoryHandler)).Methods("GET")
 
-	// Load CORS configuration from shared config
-	corsConfig, err := config.LoadCORSConfig()
-	if err != nil {
-		log.Printf("Warning: CORS config load error: %v", err)
-	}
-	log.Printf("📋 CORS Mode: %s", corsConfig.CORS.Mode)
+	// Load CORS configuration from shared config, reloading it when the
+	// file changes
+	corsConfig := config.WatchCORSConfig()
+	log.Printf("📋 CORS Mode: %s", corsConfig.Current().CORS.Mode)
 	log.Printf("📋 Allowed Origins: %v", corsConfig.GetAllowedOrigins())
 
+	// WebSocket handshakes are checked against the same rules
+	upgrader.CheckOrigin = corsConfig.CheckOrigin()
+
 	// CORS configuration using shared config
 	corsHandler := handlers.CORS(
 		handlers.AllowedOriginValidator(func(origin string) bool {
@@ -77,8 +95,8 @@ func main() {
 		handlers.AllowCredentials(),
 	)
 
-	log.Printf("✅ Backend running on :%s", BACKEND_PORT)
-	log.Printf("   Frontend should be at :%s", FRONTEND_PORT)
-	log.Printf("   Identity Service at %s", IDENTITY_SERVICE)
-	log.Fatal(http.ListenAndServe(":"+BACKEND_PORT, corsHandler(r)))
+	log.Printf("✅ Backend running on :%s", serviceConfig.Port)
+	log.Printf("   Frontend should be at :%s", serviceConfig.FrontendPort)
+	log.Printf("   Identity Service at %s", serviceConfig.IdentityServiceURL)
+	log.Fatal(http.ListenAndServe(":"+serviceConfig.Port, corsHandler(r)))
 }
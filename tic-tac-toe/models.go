@@ -16,8 +16,12 @@ type Config struct {
 	AppName              string `json:"app_name"`
 	AppIcon              string `json:"app_icon"`
 	BackendURL           string `json:"backend_url"`
+	Version              string `json:"version"`
 	DefaultSessionMinutes int    `json:"default_session_minutes"`
 	DefaultMoveSeconds   int    `json:"default_move_seconds"`
+
+	// Settings are this instance's non-secret settings
+	Settings map[string]interface{} `json:"settings"`
 }
 
 // GameMode represents the type of game
@@ -129,10 +133,3 @@ type RematchRequest struct {
 	CreatedAt   time.Time     `json:"created_at"`
 	ExpiresAt   *time.Time    `json:"expires_at"`
 }
-
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Details string `json:"details,omitempty"`
-}
\ No newline at end of file
@@ -1,4 +1,5 @@
 import { useState, useEffect, useRef, useCallback } from 'react';
+import { getWebSocketTicket } from '../services/gameApi';
 
 export const useGameWebSocket = (gameId, user, onGameUpdate, onGameEnded) => {
   const [status, setStatus] = useState('disconnected'); // disconnected, connecting, handshaking, connected, error
@@ -8,7 +9,7 @@ export const useGameWebSocket = (gameId, user, onGameUpdate, onGameEnded) => {
   const reconnectTimeoutRef = useRef(null);
   const handshakeTimeoutRef = useRef(null);
 
-  const connect = useCallback(() => {
+  const connect = useCallback(async () => {
     if (!gameId || !user) return;
 
     console.log(`🔌 Connecting WebSocket for Game ${gameId}...`);
@@ -18,9 +19,18 @@ export const useGameWebSocket = (gameId, user, onGameUpdate, onGameEnded) => {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
     const host = window.location.hostname;
     const port = '30041';
-    const token = localStorage.getItem('jwt_token');
+
+    let ticket;
+    try {
+      ticket = await getWebSocketTicket();
+    } catch (err) {
+      console.error('❌ Could not get WebSocket ticket:', err);
+      setError('Connection error');
+      setStatus('error');
+      return;
+    }
     
-    const ws = new WebSocket(`${protocol}//${host}:${port}/api/ws/game/${gameId}?token=${token}`);
+    const ws = new WebSocket(`${protocol}//${host}:${port}/api/ws/game/${gameId}?ticket=${ticket}`);
     
     wsRef.current = ws;
 
@@ -1,4 +1,5 @@
 import { useState, useEffect, useRef, useCallback } from 'react';
+import { getWebSocketTicket } from '../services/gameApi';
 
 export const useLobbyWebSocket = (enabled, user, callbacks) => {
   const [status, setStatus] = useState('disconnected'); // disconnected, connecting, connected, error
@@ -13,7 +14,7 @@ export const useLobbyWebSocket = (enabled, user, callbacks) => {
     onChallengeDeclined,
   } = callbacks || {};
 
-  const connect = useCallback(() => {
+  const connect = useCallback(async () => {
     if (!enabled || !user) return;
 
     console.log('🏛️ Connecting to Lobby WebSocket...');
@@ -23,9 +24,18 @@ export const useLobbyWebSocket = (enabled, user, callbacks) => {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
     const host = window.location.hostname;
     const port = '30041';
-    const token = localStorage.getItem('jwt_token');
+
+    let ticket;
+    try {
+      ticket = await getWebSocketTicket();
+    } catch (err) {
+      console.error('❌ Could not get WebSocket ticket:', err);
+      setError('Connection error');
+      setStatus('error');
+      return;
+    }
     
-    const ws = new WebSocket(`${protocol}//${host}:${port}/api/ws/lobby?token=${token}`);
+    const ws = new WebSocket(`${protocol}//${host}:${port}/api/ws/lobby?ticket=${ticket}`);
     
     wsRef.current = ws;
 
@@ -1,4 +1,5 @@
 import { useState, useEffect, useRef, useCallback } from 'react';
+import { getWebSocketTicket } from '../services/gameApi';
 
 /**
  * Smart Lobby WebSocket - MOBILE-SAFE
@@ -46,7 +47,7 @@ export const useSmartLobbyWebSocket = (shouldConnect, user, callbacks) => {
     setStatus('disconnected');
   }, []); // EMPTY dependencies - this function never changes
 
-  const connect = useCallback(() => {
+  const connect = useCallback(async () => {
     if (!shouldConnect || !user) {
       disconnect();
       return;
@@ -63,9 +64,17 @@ export const useSmartLobbyWebSocket = (shouldConnect, user, callbacks) => {
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
     const host = window.location.hostname;
     const port = '30041';
-    const token = localStorage.getItem('jwt_token');
+
+    let ticket;
+    try {
+      ticket = await getWebSocketTicket();
+    } catch (err) {
+      console.error('❌ Could not get WebSocket ticket:', err);
+      setStatus('error');
+      return;
+    }
     
-    const ws = new WebSocket(`${protocol}//${host}:${port}/api/ws/lobby?token=${token}`);
+    const ws = new WebSocket(`${protocol}//${host}:${port}/api/ws/lobby?ticket=${ticket}`);
     wsRef.current = ws;
 
     // Auto-disconnect failsafe (client-side, in case backend fails)
@@ -24,6 +24,13 @@ export const sendLogout = async () => {
   }
 };
 
+// WebSocket ticket - a one-time pass for opening a WebSocket, which can't
+// send the Authorization header
+export const getWebSocketTicket = async () => {
+  const res = await axios.post(`${API_BASE}/ws/ticket`);
+  return res.data.ticket;
+};
+
 // Online users
 export const getOnlineUsers = async () => {
   const res = await axios.get(`${API_BASE}/online-users`);
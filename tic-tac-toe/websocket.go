@@ -2,7 +2,6 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
@@ -11,7 +10,6 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
-	"pubgames/shared/auth"
 )
 
 // Connection manager - tracks all active WebSocket connections
@@ -34,13 +32,8 @@ type WSMessage struct {
 // Client -> Server: "ping", "ack", "reconnecting"
 // Server -> Client: "pong", "ready", "move_update", "game_ended", "opponent_disconnected"
 
+// CheckOrigin is set in main from the shared CORS rules
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from frontend
-		origin := r.Header.Get("Origin")
-		return origin == "http://localhost:30040" || 
-		       origin == "http://192.168.1.45:30040"
-	},
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 }
@@ -48,17 +41,10 @@ var upgrader = websocket.Upgrader{
 // gameWebSocketHandler handles WebSocket connections for a specific game
 // Endpoint: /api/ws/game/{gameId}
 func gameWebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	// Manually authenticate via token query parameter (WebSockets can't send custom headers)
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		http.Error(w, "Missing token", 401)
-		return
-	}
-
-	// Validate token with Identity Service
-	authUser, err := validateTokenWithIdentity(token)
-	if err != nil {
-		log.Printf("WebSocket auth failed: %v", err)
+	// Authenticate via a ticket from /api/ws/ticket (WebSockets can't send custom headers)
+	authUser := useWSTicket(r.URL.Query().Get("ticket"))
+	if authUser == nil {
+		log.Printf("WebSocket auth failed: missing, expired or used ticket")
 		http.Error(w, "Unauthorized", 401)
 		return
 	}
@@ -430,16 +416,10 @@ var lobbyConnManager = &LobbyConnectionManager{
 // lobbyWebSocketHandler handles temporary WebSocket for challenge notifications
 // Automatically disconnects after 30 seconds to prevent mobile battery drain
 func lobbyWebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	// Authenticate via token query parameter
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		http.Error(w, "Missing token", 401)
-		return
-	}
-
-	authUser, err := validateTokenWithIdentity(token)
-	if err != nil {
-		log.Printf("Lobby WebSocket auth failed: %v", err)
+	// Authenticate via a ticket from /api/ws/ticket
+	authUser := useWSTicket(r.URL.Query().Get("ticket"))
+	if authUser == nil {
+		log.Printf("Lobby WebSocket auth failed: missing, expired or used ticket")
 		http.Error(w, "Unauthorized", 401)
 		return
 	}
@@ -654,30 +634,3 @@ func broadcastUserOffline(userID int, userName string) {
 		}
 	}
 }
-
-// validateTokenWithIdentity validates a JWT token with the Identity Service
-func validateTokenWithIdentity(token string) (*auth.User, error) {
-	req, err := http.NewRequest("GET", IDENTITY_SERVICE+"/api/validate-token", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, http.ErrAbortHandler
-	}
-
-	var user auth.User
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
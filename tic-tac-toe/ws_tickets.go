@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"pubgames/shared/auth"
+	"pubgames/shared/httpkit"
+)
+
+// Browsers can't send an Authorization header when opening a WebSocket,
+// so the frontend first trades its token for a ticket over an ordinary
+// authenticated request and opens the socket with ?ticket=. Tickets are
+// random, work once and only for a few seconds, so one leaking through a
+// URL in a log is harmless, unlike the token itself.
+
+const (
+	WS_TICKET_TTL = 30 * time.Second
+	// Most tickets waiting to be used at once
+	WS_TICKET_MAX = 1000
+)
+
+type wsTicket struct {
+	user      *auth.User
+	expiresAt time.Time
+}
+
+var (
+	wsTickets   = make(map[string]wsTicket)
+	wsTicketsMu sync.Mutex
+)
+
+// createWSTicketHandler issues a ticket for opening one WebSocket
+func createWSTicketHandler(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUser(r)
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		httpkit.SendError(w, "Failed to create ticket", 500)
+		return
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	wsTicketsMu.Lock()
+	if len(wsTickets) >= WS_TICKET_MAX {
+		pruneWSTicketsLocked()
+	}
+	if len(wsTickets) >= WS_TICKET_MAX {
+		wsTicketsMu.Unlock()
+		w.Header().Set("Retry-After", "5")
+		httpkit.SendError(w, "Too many connections being opened, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	wsTickets[ticket] = wsTicket{user: user, expiresAt: time.Now().Add(WS_TICKET_TTL)}
+	wsTicketsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticket":     ticket,
+		"expires_in": int(WS_TICKET_TTL.Seconds()),
+	})
+}
+
+// useWSTicket returns the user a ticket was issued to, or nil if it is
+// unknown, expired or already used. Either way the ticket is spent.
+func useWSTicket(ticket string) *auth.User {
+	if ticket == "" {
+		return nil
+	}
+
+	wsTicketsMu.Lock()
+	defer wsTicketsMu.Unlock()
+
+	t, ok := wsTickets[ticket]
+	delete(wsTickets, ticket)
+	if !ok || time.Now().After(t.expiresAt) {
+		return nil
+	}
+	return t.user
+}
+
+// pruneWSTicketsLocked drops expired tickets. Callers hold wsTicketsMu.
+func pruneWSTicketsLocked() {
+	now := time.Now()
+	for ticket, t := range wsTickets {
+		if now.After(t.expiresAt) {
+			delete(wsTickets, ticket)
+		}
+	}
+}